@@ -1,53 +1,118 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"web-storage-service/internal/config"
+	"web-storage-service/internal/database"
+	"web-storage-service/internal/logging"
 	"web-storage-service/internal/server"
+	"web-storage-service/internal/tracing"
 	"web-storage-service/pkg"
 )
 
-var (
-	certFile string
-	keyFile  string
-)
+func main() {
+	cfg, args, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
 
-func init() {
-	// TODO: Если использовать "github.com/joho/godotenv/autoload",
-	// TODO: можно будет убрать init() функции
-	err := pkg.LoadEnv(".env")
+	logger, err := logging.New(os.Stderr, cfg.LogFormat, cfg.LogLevel)
 	if err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
+		fmt.Fprintf(os.Stderr, "invalid configuration:\n%v\n", err)
+		os.Exit(2)
+	}
+	slog.SetDefault(logger)
+
+	if len(args) > 0 && args[0] == "migrate" {
+		os.Exit(runMigrate(cfg, args[1:]))
 	}
 
-	certFile = os.Getenv("CERT_FILE")
-	keyFile = os.Getenv("KEY_FILE")
+	os.Exit(run(cfg))
 }
 
-func main() {
-	srv := server.NewServer()
+// run запускает сервер и блокируется до SIGINT/SIGTERM или ошибки слушателя
+func run(cfg config.Config) int {
+	tracer, err := tracing.New(tracing.Config{
+		ServiceName: cfg.Tracing.ServiceName,
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		slog.Error("cannot start tracing", "error", err)
+		return 1
+	}
 
-	certAndKeyExist := pkg.DoFilesExist(certFile, keyFile)
+	db, err := database.New(cfg.Database, tracer)
+	if err != nil {
+		slog.Error("cannot start server", "error", err)
+		return 1
+	}
+	defer db.Close()
 
-	if !certAndKeyExist {
-		err := pkg.GenerateCertificate(certFile, keyFile)
+	if !pkg.DoFilesExist(cfg.CertFile, cfg.KeyFile) {
+		err := pkg.GenerateCertificate(cfg.CertFile, cfg.KeyFile)
 		if err != nil {
-			panic(fmt.Sprintf("cannot generate certificate: %s", err))
+			slog.Error("cannot generate certificate", "error", err)
+			return 1
 		}
 	}
 
-	certAndKeyExist = pkg.DoFilesExist(certFile, keyFile)
+	srv, err := server.NewServer(cfg, db, tracer)
+	if err != nil {
+		slog.Error("cannot start server", "error", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	if certAndKeyExist {
-		err := srv.ListenAndServeTLS(certFile, keyFile)
-		if err != nil {
-			panic(fmt.Sprintf("cannot start server: %s", err))
-		}
-	} else {
-		err := srv.ListenAndServe()
-		if err != nil {
-			panic(fmt.Sprintf("cannot start server: %s", err))
-		}
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err = <-serveErr:
+		slog.Error("cannot start server", "error", err)
+		return 1
+	case <-ctx.Done():
 	}
+	// повторный сигнал завершит процесс сразу, не дожидаясь запросов
+	stop()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownDelay+cfg.ShutdownTimeout)
+	defer cancel()
+
+	code := 0
+	if err = srv.Shutdown(shutdownCtx); err != nil {
+		code = 1
+	}
+	if err = <-serveErr; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("server error", "error", err)
+		code = 1
+	}
+	// спаны последних запросов отправляются уже после их завершения,
+	// поэтому у сброса свой таймаут, а не остаток shutdownCtx
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err = tracer.Shutdown(flushCtx); err != nil {
+		slog.Error("error flushing traces", "error", err)
+	}
+
+	slog.Info("server stopped")
+	return code
 }
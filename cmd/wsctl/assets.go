@@ -0,0 +1,312 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"web-storage-service/pkg/client"
+)
+
+const defaultWorkers = 4
+
+func runList(ctx context.Context, a *app, args []string) error {
+	fset := flags("ls")
+	long := fset.Bool("l", false, "show size and modification time")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() > 1 {
+		return errUsage
+	}
+	if err := a.connect(); err != nil {
+		return err
+	}
+	return a.listAssets(a.client.Assets(ctx, client.ListOptions{Prefix: fset.Arg(0)}), *long)
+}
+
+func (a *app) listAssets(it *client.AssetIterator, long bool) error {
+	assets := []client.AssetInfo{}
+	for it.Next() {
+		assets = append(assets, it.Asset())
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+
+	a.print(assets, func() {
+		if !long {
+			for _, asset := range assets {
+				fmt.Println(asset.Name)
+			}
+			return
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', tabwriter.AlignRight)
+		for _, asset := range assets {
+			fmt.Fprintf(tw, "%d\t%s\t%s\t\n", asset.Size, asset.UpdatedAt.Local().Format(time.DateTime), asset.Name)
+		}
+		tw.Flush()
+	})
+	return nil
+}
+
+// remoteName имя файла в хранилище: ведущий / не входит в имя
+func remoteName(parts ...string) string {
+	return strings.TrimPrefix(path.Join(parts...), "/")
+}
+
+func runPut(ctx context.Context, a *app, args []string) error {
+	fset := flags("put")
+	recursive := fset.Bool("r", false, "upload directories recursively")
+	overwrite := fset.Bool("f", false, "replace existing assets")
+	workers := fset.Int("p", defaultWorkers, "parallel uploads")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() < 2 {
+		return errUsage
+	}
+	locals, remote := fset.Args()[:fset.NArg()-1], fset.Arg(fset.NArg()-1)
+	if err := a.connect(); err != nil {
+		return err
+	}
+
+	// как у cp: несколько источников или каталог кладутся внутрь remote
+	intoDir := len(locals) > 1 || strings.HasSuffix(remote, "/")
+	var jobs []*job
+	for _, local := range locals {
+		info, err := os.Stat(local)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			name := remoteName(remote)
+			if intoDir {
+				name = remoteName(remote, filepath.Base(local))
+			}
+			jobs = append(jobs, &job{Name: name, Path: local})
+			continue
+		}
+		if !*recursive {
+			return fmt.Errorf("%s is a directory, use -r", local)
+		}
+		base := filepath.Base(filepath.Clean(local))
+		err = filepath.WalkDir(local, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || !d.Type().IsRegular() {
+				return err
+			}
+			rel, err := filepath.Rel(local, p)
+			if err != nil {
+				return err
+			}
+			jobs = append(jobs, &job{Name: remoteName(remote, base, filepath.ToSlash(rel)), Path: p})
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return a.parallel(ctx, *workers, jobs, func(ctx context.Context, j *job) error {
+		f, err := os.Open(j.Path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		info, err := a.client.Upload(ctx, j.Name, f, &client.UploadOptions{Overwrite: *overwrite})
+		if errors.Is(err, client.ErrAssetExists) {
+			return errors.New("asset already exists, use -f to replace it")
+		}
+		if err != nil {
+			return err
+		}
+		j.Size, j.SHA256, j.Status = info.Size, info.SHA256, "uploaded"
+		return nil
+	})
+}
+
+func runGet(ctx context.Context, a *app, args []string) error {
+	fset := flags("get")
+	recursive := fset.Bool("r", false, "download every asset under the prefix")
+	workers := fset.Int("p", defaultWorkers, "parallel downloads")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() < 1 || fset.NArg() > 2 {
+		return errUsage
+	}
+	remote, local := fset.Arg(0), fset.Arg(1)
+	if err := a.connect(); err != nil {
+		return err
+	}
+
+	if !*recursive {
+		if local == "-" {
+			_, err := a.client.Download(ctx, remote, os.Stdout, nil)
+			return err
+		}
+		if local == "" {
+			local = path.Base(remote)
+		} else if info, err := os.Stat(local); err == nil && info.IsDir() {
+			local = filepath.Join(local, path.Base(remote))
+		}
+		return a.parallel(ctx, 1, []*job{{Name: remote, Path: local}}, a.download)
+	}
+
+	if local == "" {
+		local = "."
+	}
+	// как у cp -r: docs/a.txt из префикса docs попадает в <local>/docs/a.txt
+	prefix := strings.Trim(remote, "/")
+	listPrefix, parent := "", ""
+	if prefix != "" {
+		listPrefix = prefix + "/"
+		if dir := path.Dir(prefix); dir != "." {
+			parent = dir + "/"
+		}
+	}
+	var jobs []*job
+	it := a.client.Assets(ctx, client.ListOptions{Prefix: listPrefix})
+	for it.Next() {
+		name := it.Asset().Name
+		rel := filepath.FromSlash(strings.TrimPrefix(name, parent))
+		// имя файла не должно вывести запись за пределы каталога назначения
+		if !filepath.IsLocal(rel) {
+			fmt.Fprintf(os.Stderr, "wsctl: skipping %s: not a valid local path\n", name)
+			continue
+		}
+		jobs = append(jobs, &job{Name: name, Path: filepath.Join(local, rel)})
+	}
+	if err := it.Err(); err != nil {
+		return err
+	}
+	return a.parallel(ctx, *workers, jobs, a.download)
+}
+
+// download пишет файл во временный рядом с целевым и переименовывает его,
+// чтобы прерванная загрузка не оставила обрезанный файл
+func (a *app) download(ctx context.Context, j *job) error {
+	dir := filepath.Dir(j.Path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(j.Path)+".part-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	j.Size, err = a.client.Download(ctx, j.Name, tmp, nil)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), j.Path); err != nil {
+		return err
+	}
+	j.Status = "downloaded"
+	return nil
+}
+
+// expand имена для пакетной команды; с recursive каждый аргумент считается каталогом
+func (a *app) expand(ctx context.Context, names []string, recursive, trash bool) ([]*job, error) {
+	var jobs []*job
+	for _, name := range names {
+		if !recursive {
+			jobs = append(jobs, &job{Name: name})
+			continue
+		}
+		opts := client.ListOptions{Prefix: strings.TrimSuffix(name, "/") + "/"}
+		it := a.client.Assets(ctx, opts)
+		if trash {
+			it = a.client.Trash(ctx, opts)
+		}
+		for it.Next() {
+			jobs = append(jobs, &job{Name: it.Asset().Name})
+		}
+		if err := it.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return jobs, nil
+}
+
+func runRemove(ctx context.Context, a *app, args []string) error {
+	fset := flags("rm")
+	recursive := fset.Bool("r", false, "remove every asset under the prefix")
+	purge := fset.Bool("purge", false, "delete permanently instead of moving to the trash")
+	workers := fset.Int("p", defaultWorkers, "parallel requests")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() == 0 {
+		return errUsage
+	}
+	if err := a.connect(); err != nil {
+		return err
+	}
+
+	jobs, err := a.expand(ctx, fset.Args(), *recursive, false)
+	if err != nil {
+		return err
+	}
+	return a.parallel(ctx, *workers, jobs, func(ctx context.Context, j *job) error {
+		if *purge {
+			j.Status = "deleted"
+			return a.client.Purge(ctx, j.Name)
+		}
+		j.Status = "trashed"
+		return a.client.Delete(ctx, j.Name)
+	})
+}
+
+func runMove(ctx context.Context, a *app, args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	if err := a.connect(); err != nil {
+		return err
+	}
+	info, err := a.client.Rename(ctx, args[0], args[1])
+	if err != nil {
+		return err
+	}
+	a.print(info, func() {
+		fmt.Printf("renamed %s -> %s\n", args[0], info.Name)
+	})
+	return nil
+}
+
+func runCopy(ctx context.Context, a *app, args []string) error {
+	fset := flags("cp")
+	overwrite := fset.Bool("f", false, "replace an existing asset")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() != 2 {
+		return errUsage
+	}
+	if err := a.connect(); err != nil {
+		return err
+	}
+	info, err := a.client.Copy(ctx, fset.Arg(0), fset.Arg(1), *overwrite)
+	if errors.Is(err, client.ErrAssetExists) {
+		return fmt.Errorf("%s already exists, use -f to replace it", fset.Arg(1))
+	}
+	if err != nil {
+		return err
+	}
+	a.print(info, func() {
+		fmt.Printf("copied %s -> %s\n", fset.Arg(0), info.Name)
+	})
+	return nil
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+	"web-storage-service/pkg/client"
+)
+
+var stdin = bufio.NewReader(os.Stdin)
+
+func runLogin(ctx context.Context, a *app, args []string) error {
+	fset := flags("login")
+	user := fset.String("user", "", "login; asked for when empty")
+	token := fset.String("token", "", "save an API key instead of signing in with a password")
+	insecure := fset.Bool("insecure", false, "do not verify the server certificate")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	creds := a.creds
+	switch fset.NArg() {
+	case 0:
+	case 1:
+		creds.Server = fset.Arg(0)
+	default:
+		return errUsage
+	}
+	if creds.Server == "" {
+		return errors.New("server address is required, e.g. wsctl login https://storage.example.com")
+	}
+	creds.Insecure = *insecure
+
+	if *token != "" {
+		// у API-ключа свой срок, сервер сообщит о его истечении сам
+		creds.Token, creds.ExpiresAt = *token, time.Time{}
+		if err := saveCredentials(creds); err != nil {
+			return err
+		}
+		a.print(map[string]string{"server": creds.Server, "status": "saved"}, func() {
+			fmt.Println("API key saved for", creds.Server)
+		})
+		return nil
+	}
+
+	c, err := newClient(creds)
+	if err != nil {
+		return err
+	}
+	if *user == "" {
+		if *user, err = prompt("Login: ", false); err != nil {
+			return err
+		}
+	}
+	password, err := prompt("Password: ", true)
+	if err != nil {
+		return err
+	}
+
+	err = c.Login(ctx, *user, password)
+	if errors.Is(err, client.ErrTwoFactorRequired) {
+		var code string
+		if code, err = prompt("Two-factor code: ", false); err != nil {
+			return err
+		}
+		err = c.CompleteTwoFactor(ctx, code)
+	}
+	if err != nil {
+		return err
+	}
+
+	creds.Token, creds.ExpiresAt = c.Token()
+	if err = saveCredentials(creds); err != nil {
+		return err
+	}
+	a.print(map[string]interface{}{"server": creds.Server, "login": *user, "expires_at": creds.ExpiresAt}, func() {
+		fmt.Printf("Logged in to %s as %s\n", creds.Server, *user)
+	})
+	return nil
+}
+
+func runLogout(ctx context.Context, a *app, args []string) error {
+	if len(args) != 0 {
+		return errUsage
+	}
+	// сессию на сервере завершаем, если получится; токен забываем в любом случае
+	var err error
+	if a.connect() == nil {
+		err = a.client.Logout(ctx)
+	}
+	if removeErr := removeCredentials(); removeErr != nil {
+		return removeErr
+	}
+	if err != nil && !errors.Is(err, client.ErrUnauthorized) {
+		fmt.Fprintf(os.Stderr, "wsctl: server logout failed: %v\n", err)
+	}
+	a.print(map[string]string{"status": "logged out"}, func() {
+		fmt.Println("Logged out")
+	})
+	return nil
+}
+
+// prompt читает строку со stdin; для пароля эхо отключается через stty,
+// а там, где stty нет, ввод будет виден
+func prompt(label string, secret bool) (string, error) {
+	fmt.Fprint(os.Stderr, label)
+	if secret && isTerminal(os.Stdin) && stty("-echo") == nil {
+		defer func() {
+			_ = stty("echo")
+			fmt.Fprintln(os.Stderr)
+		}()
+	}
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("reading %s: %w", strings.TrimSuffix(strings.ToLower(label), ": "), err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+func stty(arg string) error {
+	cmd := exec.Command("stty", arg)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
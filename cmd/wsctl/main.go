@@ -0,0 +1,166 @@
+// Command wsctl консольный клиент web-storage-service поверх pkg/client
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"web-storage-service/pkg/client"
+)
+
+const usage = `usage: wsctl [-json] <command> [flags] [args]
+
+commands:
+  login [-user name] [-token key] [-insecure] <server>   sign in and save the token
+  logout                                                  end the session and forget the token
+  ls [-l] [prefix]                                        list assets
+  put [-r] [-f] [-p n] <local>... <remote>                upload files or directories
+  get [-r] [-p n] <remote> [local]                        download an asset or a prefix ("-" writes to stdout)
+  rm [-r] [-purge] [-p n] <remote>...                     move assets to the trash or delete them for good
+  mv <remote> <new-name>                                  rename or move an asset
+  cp [-f] <remote> <new-name>                             copy an asset
+  share add [-ttl 24h] <remote> | ls | rm <id>            manage public links
+  trash ls [-l] [prefix] | restore [-r] <remote>... | purge [-r] <remote>...
+  sync [-watch] [-interval 30s] [-dry-run] [-p n] <dir> [prefix]
+                                                          two-way sync of a local directory with a prefix
+
+The server and token come from WSCTL_SERVER and WSCTL_TOKEN, or from the
+credentials saved by login (WSCTL_CONFIG overrides their location).
+Run "wsctl <command> -h" for the flags of a command.`
+
+// errUsage неверные аргументы: печатается usage и код выхода 2
+var errUsage = errors.New("invalid arguments")
+
+// app общее состояние команд
+type app struct {
+	json   bool
+	creds  credentials
+	client *client.Client
+}
+
+type command func(ctx context.Context, a *app, args []string) error
+
+var commands = map[string]command{
+	"login":  runLogin,
+	"logout": runLogout,
+	"ls":     runList,
+	"put":    runPut,
+	"get":    runGet,
+	"rm":     runRemove,
+	"mv":     runMove,
+	"cp":     runCopy,
+	"share":  runShare,
+	"trash":  runTrash,
+	"sync":   runSync,
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	fset := flag.NewFlagSet("wsctl", flag.ContinueOnError)
+	fset.Usage = func() { fmt.Fprintln(os.Stderr, usage) }
+	jsonOutput := fset.Bool("json", false, "print results as JSON")
+	if err := fset.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+	if fset.NArg() == 0 {
+		fset.Usage()
+		return 2
+	}
+	cmd, ok := commands[fset.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "wsctl: unknown command %q\n\n%s\n", fset.Arg(0), usage)
+		return 2
+	}
+
+	a := &app{json: *jsonOutput}
+	var err error
+	if a.creds, err = loadCredentials(); err != nil {
+		fmt.Fprintf(os.Stderr, "wsctl: %v\n", err)
+		return 1
+	}
+	if server := os.Getenv("WSCTL_SERVER"); server != "" {
+		a.creds.Server = server
+	}
+	if token := os.Getenv("WSCTL_TOKEN"); token != "" {
+		a.creds.Token, a.creds.ExpiresAt = token, time.Time{}
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	err = cmd(ctx, a, fset.Args()[1:])
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errUsage):
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	case errors.Is(err, client.ErrUnauthorized):
+		fmt.Fprintf(os.Stderr, "wsctl: %v\nrun \"wsctl login\" to sign in again\n", err)
+		return 1
+	default:
+		fmt.Fprintf(os.Stderr, "wsctl: %v\n", err)
+		return 1
+	}
+}
+
+// connect создает клиент по сохраненному входу; команды, которым нужен сервер, вызывают его первым делом
+func (a *app) connect() error {
+	if a.creds.Server == "" || a.creds.Token == "" {
+		return errors.New("not logged in, run \"wsctl login <server>\" or set WSCTL_SERVER and WSCTL_TOKEN")
+	}
+	if !a.creds.ExpiresAt.IsZero() && time.Now().After(a.creds.ExpiresAt) {
+		return errors.New("session expired, run \"wsctl login\" to sign in again")
+	}
+	c, err := newClient(a.creds, client.WithToken(a.creds.Token))
+	if err != nil {
+		return err
+	}
+	a.client = c
+	return nil
+}
+
+func newClient(creds credentials, opts ...client.Option) (*client.Client, error) {
+	if creds.Insecure {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+		opts = append(opts, client.WithHTTPClient(&http.Client{Transport: transport}))
+	}
+	return client.New(creds.Server, opts...)
+}
+
+// flags FlagSet подкоманды: ошибки разбора возвращаются, а не завершают процесс
+func flags(name string) *flag.FlagSet {
+	fset := flag.NewFlagSet("wsctl "+name, flag.ContinueOnError)
+	fset.SetOutput(os.Stderr)
+	return fset
+}
+
+// print выводит v как JSON с -json, иначе вызывает text
+func (a *app) print(v interface{}, text func()) {
+	if !a.json {
+		text()
+		return
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fmt.Fprintf(os.Stderr, "wsctl: %v\n", err)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+	"web-storage-service/pkg/client"
+)
+
+func runShare(ctx context.Context, a *app, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	if err := a.connect(); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "add":
+		fset := flags("share add")
+		ttl := fset.Duration("ttl", 0, "link lifetime; the server default when zero")
+		if err := fset.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fset.NArg() != 1 {
+			return errUsage
+		}
+		link, err := a.client.Share(ctx, fset.Arg(0), *ttl)
+		if err != nil {
+			return err
+		}
+		a.print(link, func() {
+			fmt.Printf("%s\nexpires %s\n", link.URL, link.ExpiresAt.Local().Format(time.DateTime))
+		})
+	case "ls":
+		if len(args) != 1 {
+			return errUsage
+		}
+		links, err := a.client.ShareLinks(ctx)
+		if err != nil {
+			return err
+		}
+		if links == nil {
+			links = []client.ShareLink{}
+		}
+		a.print(links, func() {
+			tw := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+			fmt.Fprintln(tw, "ID\tNAME\tEXPIRES\tDOWNLOADS")
+			for _, link := range links {
+				fmt.Fprintf(tw, "%s\t%s\t%s\t%d\n", link.ID, link.Name, link.ExpiresAt.Local().Format(time.DateTime), link.Downloads)
+			}
+			tw.Flush()
+		})
+	case "rm":
+		if len(args) < 2 {
+			return errUsage
+		}
+		jobs := make([]*job, 0, len(args)-1)
+		for _, id := range args[1:] {
+			jobs = append(jobs, &job{Name: id})
+		}
+		return a.parallel(ctx, 1, jobs, func(ctx context.Context, j *job) error {
+			j.Status = "revoked"
+			return a.client.RevokeShareLink(ctx, j.Name)
+		})
+	default:
+		return errUsage
+	}
+	return nil
+}
+
+func runTrash(ctx context.Context, a *app, args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	if err := a.connect(); err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "ls":
+		fset := flags("trash ls")
+		long := fset.Bool("l", false, "show size and modification time")
+		if err := fset.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fset.NArg() > 1 {
+			return errUsage
+		}
+		return a.listAssets(a.client.Trash(ctx, client.ListOptions{Prefix: fset.Arg(0)}), *long)
+	case "restore", "purge":
+		fset := flags("trash " + args[0])
+		recursive := fset.Bool("r", false, "every asset in the trash under the prefix")
+		workers := fset.Int("p", defaultWorkers, "parallel requests")
+		if err := fset.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fset.NArg() == 0 {
+			return errUsage
+		}
+		jobs, err := a.expand(ctx, fset.Args(), *recursive, true)
+		if err != nil {
+			return err
+		}
+		restore := args[0] == "restore"
+		return a.parallel(ctx, *workers, jobs, func(ctx context.Context, j *job) error {
+			if restore {
+				j.Status = "restored"
+				return a.client.Restore(ctx, j.Name)
+			}
+			j.Status = "deleted"
+			return a.client.Purge(ctx, j.Name)
+		})
+	default:
+		return errUsage
+	}
+}
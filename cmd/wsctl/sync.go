@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+	"web-storage-service/pkg/dirsync"
+)
+
+// syncEvent действие синхронизации для вывода -json, по одному объекту в строке
+type syncEvent struct {
+	dirsync.Action
+	Error string `json:"error,omitempty"`
+}
+
+func runSync(ctx context.Context, a *app, args []string) error {
+	fset := flags("sync")
+	watch := fset.Bool("watch", false, "keep running and sync on every change")
+	interval := fset.Duration("interval", 30*time.Second, "how often -watch polls the server when its change feed is unavailable")
+	dryRun := fset.Bool("dry-run", false, "only print what would change")
+	workers := fset.Int("p", defaultWorkers, "parallel transfers")
+	if err := fset.Parse(args); err != nil {
+		return err
+	}
+	if fset.NArg() < 1 || fset.NArg() > 2 || (*watch && *dryRun) || *interval <= 0 {
+		return errUsage
+	}
+	if err := a.connect(); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	syncer, err := dirsync.New(a.client, fset.Arg(0), dirsync.Options{
+		Prefix:  fset.Arg(1),
+		Workers: *workers,
+		DryRun:  *dryRun,
+		OnAction: func(action dirsync.Action) {
+			event := syncEvent{Action: action}
+			if action.Err != nil {
+				event.Error = action.Err.Error()
+			}
+			switch {
+			case a.json:
+				_ = enc.Encode(event)
+			case action.Err != nil:
+				fmt.Fprintf(os.Stderr, "wsctl: %s %s: %v\n", action.Op, action.Path, action.Err)
+			case action.Op == dirsync.OpConflict:
+				fmt.Printf("conflict %s: local version kept as %s\n", action.Path, action.Conflict)
+			default:
+				fmt.Println(action.Op, action.Path)
+			}
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	if !*watch {
+		_, err = syncer.Run(ctx)
+		return err
+	}
+	return syncer.Watch(ctx, *interval, func(err error) {
+		fmt.Fprintf(os.Stderr, "wsctl: sync: %v\n", err)
+	})
+}
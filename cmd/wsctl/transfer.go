@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// job один файл в пакетной операции; в -json выводится как есть.
+// Name имя в хранилище, Path локальный путь для put и get.
+type job struct {
+	Name   string `json:"name"`
+	Path   string `json:"path,omitempty"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256,omitempty"`
+	Status string `json:"status,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+func (j *job) String() string {
+	switch {
+	case j.Path == "":
+		return j.Status + " " + j.Name
+	case j.Status == "uploaded":
+		return fmt.Sprintf("%s %s -> %s (%d bytes)", j.Status, j.Path, j.Name, j.Size)
+	default:
+		return fmt.Sprintf("%s %s -> %s (%d bytes)", j.Status, j.Name, j.Path, j.Size)
+	}
+}
+
+// parallel выполняет fn для заданий в workers горутин. Ошибка одного файла не
+// останавливает остальные: она записывается в задание, а в конце возвращается сводка.
+func (a *app) parallel(ctx context.Context, workers int, jobs []*job, fn func(context.Context, *job) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+	queue := make(chan *job)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	failed := 0
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range queue {
+				err := fn(ctx, j)
+
+				mu.Lock()
+				if err != nil {
+					j.Error = err.Error()
+					failed++
+				}
+				if !a.json {
+					if err != nil {
+						fmt.Fprintf(os.Stderr, "wsctl: %s: %v\n", j.Name, err)
+					} else {
+						fmt.Println(j)
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, j := range jobs {
+		select {
+		case queue <- j:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	if a.json {
+		a.print(jobs, nil)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d failed", failed, len(jobs))
+	}
+	return nil
+}
@@ -0,0 +1,529 @@
+package config
+
+import (
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"web-storage-service/pkg"
+)
+
+const (
+	AuthModeSession = "session"
+	AuthModeJWT     = "jwt"
+)
+
+// Config настройки сервиса. Значение каждого поля берется из флага командной
+// строки, затем из переменной окружения, затем из файла конфигурации
+// (формат .env), затем из значения по умолчанию.
+type Config struct {
+	Port     int
+	AppEnv   string
+	CertFile string
+	KeyFile  string
+
+	// LogLevel debug, info, warn или error; LogFormat json или text
+	LogLevel  string
+	LogFormat string
+
+	// ShutdownTimeout сколько ждать завершения текущих запросов при остановке
+	ShutdownTimeout time.Duration
+	// ShutdownDelay пауза между снятием готовности и закрытием слушателя,
+	// чтобы балансировщик успел перестать слать трафик
+	ShutdownDelay time.Duration
+
+	Health HealthConfig
+
+	Tracing TracingConfig
+
+	// MetricsToken если задан, /metrics требует Authorization: Bearer <token>
+	MetricsToken string
+	// MetricsPublic открывает /metrics без токена; иначе без MetricsToken метрики не отдаются
+	MetricsPublic bool
+
+	Database  DatabaseConfig
+	Auth      AuthConfig
+	OIDC      OIDCConfig
+	Lockout   LockoutConfig
+	RateLimit RateLimitConfig
+	Bandwidth BandwidthConfig
+	CORS      CORSConfig
+	Web       WebConfig
+	Changes   ChangesConfig
+}
+
+type HealthConfig struct {
+	// DiskPath файловая система, свободное место на которой проверяет /readyz
+	DiskPath string
+	// DiskMinFreeMB минимум свободного места, ниже которого инстанс не готов
+	DiskMinFreeMB int
+}
+
+// TracingConfig переменные окружения совпадают со стандартными для OpenTelemetry SDK
+type TracingConfig struct {
+	ServiceName string
+	// Exporter none, otlp или stdout
+	Exporter    string
+	Endpoint    string
+	SampleRatio float64
+}
+
+type DatabaseConfig struct {
+	Host        string
+	Port        int
+	Name        string
+	Username    string
+	Password    string
+	Schema      string
+	AutoMigrate bool
+}
+
+type AuthConfig struct {
+	Mode           string
+	JWTAlg         string
+	JWTIssuer      string
+	JWTTTL         time.Duration
+	JWTKeyRotation time.Duration
+	// JWTKeySecret base64 ключа AES-256, которым шифруются закрытые ключи в jwt_keys
+	JWTKeySecret string
+	TOTPIssuer   string
+	// AdminLogins логины, которым при старте назначается роль admin
+	AdminLogins []string
+
+	// CookieSessions разрешает вход с ?cookie=true: токен выдается в HttpOnly cookie, а не в теле ответа
+	CookieSessions bool
+	CookieName     string
+	CookieDomain   string
+	// CookieSameSite lax, strict или none
+	CookieSameSite string
+}
+
+// DecodeJWTKeySecret ключ JWT_KEY_SECRET; nil, если он не задан
+func (a AuthConfig) DecodeJWTKeySecret() ([]byte, error) {
+	if a.JWTKeySecret == "" {
+		return nil, nil
+	}
+	return base64.StdEncoding.DecodeString(a.JWTKeySecret)
+}
+
+type OIDCConfig struct {
+	Issuer        string
+	ClientID      string
+	ClientSecret  string
+	RedirectURL   string
+	Scopes        []string
+	AutoProvision bool
+	LinkExisting  bool
+}
+
+// Enabled вход через OIDC включается заданием издателя
+func (c OIDCConfig) Enabled() bool {
+	return c.Issuer != ""
+}
+
+type LockoutConfig struct {
+	MaxFailures   int
+	IPMaxFailures int
+	FailureWindow time.Duration
+	BaseLockout   time.Duration
+	MaxLockout    time.Duration
+}
+
+const (
+	RateLimitStoreMemory   = "memory"
+	RateLimitStorePostgres = "postgres"
+)
+
+type RateLimitConfig struct {
+	Enabled bool
+	// Store memory (у каждого инстанса свои лимиты) или postgres (общие для всех инстансов)
+	Store string
+	// Auth вход и 2FA, Read GET-запросы, Write остальные
+	Auth  RateLimit
+	Read  RateLimit
+	Write RateLimit
+	// IP все запросы с одного адреса до проверки учетных данных, в том числе с неверным токеном
+	IP RateLimit
+}
+
+// RateLimit корзина токенов: PerMinute скорость пополнения, Burst емкость
+type RateLimit struct {
+	PerMinute int
+	Burst     int
+}
+
+// BandwidthConfig скорость передачи содержимого файлов в KiB/s, 0 без ограничения
+type BandwidthConfig struct {
+	// GlobalKBps на все передачи инстанса вместе
+	GlobalKBps int
+	// AdminKBps, UserKBps и ReadOnlyKBps на одного пользователя с этой ролью
+	AdminKBps    int
+	UserKBps     int
+	ReadOnlyKBps int
+}
+
+// CORSConfig политика для браузерных клиентов с других origin; пустой AllowedOrigins выключает CORS
+type CORSConfig struct {
+	// AllowedOrigins точные origin, * или шаблоны вида https://*.example.com
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	MaxAge           time.Duration
+}
+
+// WebConfig встроенный веб-интерфейс, документация API и публичные ссылки на файлы
+type WebConfig struct {
+	// UIEnabled отдает веб-интерфейс на /ui/
+	UIEnabled bool
+	// DocsEnabled отдает /openapi.json и страницу документации /docs/
+	DocsEnabled bool
+	// ShareLinkTTL срок жизни ссылки по умолчанию, ShareLinkMaxTTL наибольший, который можно запросить
+	ShareLinkTTL    time.Duration
+	ShareLinkMaxTTL time.Duration
+}
+
+// ChangesConfig лента изменений файлов /api/changes
+type ChangesConfig struct {
+	// Retention сколько хранятся события; клиент с более старым курсором перечитывает список
+	Retention time.Duration
+	// MaxWait наибольшее ожидание long-poll запроса
+	MaxWait time.Duration
+}
+
+// setting описывает один параметр: имя переменной окружения, флаг и разбор значения
+type setting struct {
+	env   string
+	flag  string
+	def   string
+	usage string
+	set   func(c *Config, v string) error
+}
+
+func settings() []setting {
+	return []setting{
+		{"PORT", "port", "443", "HTTP(S) port to listen on", intVar(func(c *Config) *int { return &c.Port })},
+		{"APP_ENV", "app-env", "local", "application environment name", stringVar(func(c *Config) *string { return &c.AppEnv })},
+		{"CERT_FILE", "cert-file", "certs/server.crt", "TLS certificate file, generated if missing", stringVar(func(c *Config) *string { return &c.CertFile })},
+		{"KEY_FILE", "key-file", "certs/server.key", "TLS private key file, generated if missing", stringVar(func(c *Config) *string { return &c.KeyFile })},
+		{"LOG_LEVEL", "log-level", "info", "minimum log level: debug, info, warn or error", stringVar(func(c *Config) *string { return &c.LogLevel })},
+		{"LOG_FORMAT", "log-format", "json", "log output format: json or text", stringVar(func(c *Config) *string { return &c.LogFormat })},
+		{"SHUTDOWN_TIMEOUT", "shutdown-timeout", "30s", "how long to wait for in-flight requests on shutdown", durationVar(func(c *Config) *time.Duration { return &c.ShutdownTimeout })},
+		{"SHUTDOWN_DELAY", "shutdown-delay", "0s", "delay between reporting not ready and closing the listener", durationVar(func(c *Config) *time.Duration { return &c.ShutdownDelay })},
+
+		{"HEALTH_DISK_PATH", "health-disk-path", ".", "path whose file system free space is checked by /readyz", stringVar(func(c *Config) *string { return &c.Health.DiskPath })},
+		{"HEALTH_DISK_MIN_FREE_MB", "health-disk-min-free-mb", "100", "free space in MB below which the instance is not ready, 0 disables the check", intVar(func(c *Config) *int { return &c.Health.DiskMinFreeMB })},
+
+		{"METRICS_TOKEN", "metrics-token", "", "bearer token required to scrape /metrics", stringVar(func(c *Config) *string { return &c.MetricsToken })},
+		{"METRICS_PUBLIC", "metrics-public", "false", "serve /metrics without a token when METRICS_TOKEN is empty", boolVar(func(c *Config) *bool { return &c.MetricsPublic })},
+
+		{"OTEL_SERVICE_NAME", "otel-service-name", "web-storage-service", "service.name reported in traces", stringVar(func(c *Config) *string { return &c.Tracing.ServiceName })},
+		{"OTEL_TRACES_EXPORTER", "otel-traces-exporter", "none", "trace exporter: none, otlp or stdout", stringVar(func(c *Config) *string { return &c.Tracing.Exporter })},
+		{"OTEL_EXPORTER_OTLP_ENDPOINT", "otel-exporter-otlp-endpoint", "http://localhost:4318", "OTLP/HTTP collector endpoint", stringVar(func(c *Config) *string { return &c.Tracing.Endpoint })},
+		{"OTEL_TRACES_SAMPLER_ARG", "otel-traces-sampler-arg", "1", "fraction of traces to record, from 0 to 1", floatVar(func(c *Config) *float64 { return &c.Tracing.SampleRatio })},
+
+		{"DB_HOST", "db-host", "localhost", "PostgreSQL host", stringVar(func(c *Config) *string { return &c.Database.Host })},
+		{"DB_PORT", "db-port", "5432", "PostgreSQL port", intVar(func(c *Config) *int { return &c.Database.Port })},
+		{"DB_DATABASE", "db-database", "", "PostgreSQL database name", stringVar(func(c *Config) *string { return &c.Database.Name })},
+		{"DB_USERNAME", "db-username", "", "PostgreSQL user", stringVar(func(c *Config) *string { return &c.Database.Username })},
+		{"DB_PASSWORD", "db-password", "", "PostgreSQL password", stringVar(func(c *Config) *string { return &c.Database.Password })},
+		{"DB_SCHEMA", "db-schema", "public", "PostgreSQL search_path schema", stringVar(func(c *Config) *string { return &c.Database.Schema })},
+		{"DB_AUTO_MIGRATE", "db-auto-migrate", "false", "apply pending migrations on startup", boolVar(func(c *Config) *bool { return &c.Database.AutoMigrate })},
+
+		{"AUTH_MODE", "auth-mode", AuthModeSession, "token type issued on login: session or jwt", stringVar(func(c *Config) *string { return &c.Auth.Mode })},
+		{"JWT_ALG", "jwt-alg", pkg.JWTAlgEdDSA, "JWT signing algorithm: EdDSA or ES256", stringVar(func(c *Config) *string { return &c.Auth.JWTAlg })},
+		{"JWT_ISSUER", "jwt-issuer", "", "JWT iss claim", stringVar(func(c *Config) *string { return &c.Auth.JWTIssuer })},
+		{"JWT_TTL", "jwt-ttl", "15m", "JWT lifetime", durationVar(func(c *Config) *time.Duration { return &c.Auth.JWTTTL })},
+		{"JWT_KEY_ROTATION", "jwt-key-rotation", "24h", "how long a JWT signing key is used before rotation", durationVar(func(c *Config) *time.Duration { return &c.Auth.JWTKeyRotation })},
+		{"JWT_KEY_SECRET", "jwt-key-secret", "", "base64 of a 32-byte key that encrypts JWT signing keys in the database, empty stores them unencrypted", stringVar(func(c *Config) *string { return &c.Auth.JWTKeySecret })},
+		{"TOTP_ISSUER", "totp-issuer", "web-storage-service", "issuer shown in authenticator apps", stringVar(func(c *Config) *string { return &c.Auth.TOTPIssuer })},
+		{"ADMIN_LOGINS", "admin-logins", "", "comma separated logins promoted to admin on startup", listVar(func(c *Config) *[]string { return &c.Auth.AdminLogins })},
+		{"AUTH_COOKIE_SESSIONS", "auth-cookie-sessions", "false", "allow browser logins that keep the token in an HttpOnly cookie", boolVar(func(c *Config) *bool { return &c.Auth.CookieSessions })},
+		{"AUTH_COOKIE_NAME", "auth-cookie-name", "wss_session", "session cookie name; the CSRF cookie gets a _csrf suffix", stringVar(func(c *Config) *string { return &c.Auth.CookieName })},
+		{"AUTH_COOKIE_DOMAIN", "auth-cookie-domain", "", "session cookie Domain attribute, empty for the API host only", stringVar(func(c *Config) *string { return &c.Auth.CookieDomain })},
+		{"AUTH_COOKIE_SAMESITE", "auth-cookie-samesite", "lax", "session cookie SameSite attribute: lax, strict or none", stringVar(func(c *Config) *string { return &c.Auth.CookieSameSite })},
+
+		{"OIDC_ISSUER", "oidc-issuer", "", "OpenID Connect issuer URL, empty disables OIDC login", stringVar(func(c *Config) *string { return &c.OIDC.Issuer })},
+		{"OIDC_CLIENT_ID", "oidc-client-id", "", "OpenID Connect client id", stringVar(func(c *Config) *string { return &c.OIDC.ClientID })},
+		{"OIDC_CLIENT_SECRET", "oidc-client-secret", "", "OpenID Connect client secret", stringVar(func(c *Config) *string { return &c.OIDC.ClientSecret })},
+		{"OIDC_REDIRECT_URL", "oidc-redirect-url", "", "OpenID Connect redirect URL pointing to /api/auth/oidc/callback", stringVar(func(c *Config) *string { return &c.OIDC.RedirectURL })},
+		{"OIDC_SCOPES", "oidc-scopes", "openid profile email", "OpenID Connect scopes", listVar(func(c *Config) *[]string { return &c.OIDC.Scopes })},
+		{"OIDC_AUTO_PROVISION", "oidc-auto-provision", "true", "create users on first OIDC login", boolVar(func(c *Config) *bool { return &c.OIDC.AutoProvision })},
+		{"OIDC_LINK_EXISTING", "oidc-link-existing", "false", "link OIDC accounts to users whose login equals the verified email", boolVar(func(c *Config) *bool { return &c.OIDC.LinkExisting })},
+
+		{"LOGIN_MAX_FAILURES", "login-max-failures", "5", "failed logins per account before lockout", intVar(func(c *Config) *int { return &c.Lockout.MaxFailures })},
+		{"LOGIN_IP_MAX_FAILURES", "login-ip-max-failures", "20", "failed logins per IP before lockout", intVar(func(c *Config) *int { return &c.Lockout.IPMaxFailures })},
+		{"LOGIN_FAILURE_WINDOW", "login-failure-window", "15m", "period after which failure counters reset", durationVar(func(c *Config) *time.Duration { return &c.Lockout.FailureWindow })},
+		{"LOGIN_LOCKOUT_BASE", "login-lockout-base", "1m", "first lockout duration, doubled on each further failure", durationVar(func(c *Config) *time.Duration { return &c.Lockout.BaseLockout })},
+		{"LOGIN_LOCKOUT_MAX", "login-lockout-max", "1h", "maximum lockout duration", durationVar(func(c *Config) *time.Duration { return &c.Lockout.MaxLockout })},
+
+		{"RATE_LIMIT_ENABLED", "rate-limit-enabled", "true", "limit request rate per user and per client IP", boolVar(func(c *Config) *bool { return &c.RateLimit.Enabled })},
+		{"RATE_LIMIT_STORE", "rate-limit-store", RateLimitStoreMemory, "where rate limit buckets are kept: memory or postgres", stringVar(func(c *Config) *string { return &c.RateLimit.Store })},
+		{"RATE_LIMIT_AUTH_PER_MINUTE", "rate-limit-auth-per-minute", "10", "login requests per minute", intVar(func(c *Config) *int { return &c.RateLimit.Auth.PerMinute })},
+		{"RATE_LIMIT_AUTH_BURST", "rate-limit-auth-burst", "5", "login requests allowed in a burst", intVar(func(c *Config) *int { return &c.RateLimit.Auth.Burst })},
+		{"RATE_LIMIT_READ_PER_MINUTE", "rate-limit-read-per-minute", "300", "read requests per minute", intVar(func(c *Config) *int { return &c.RateLimit.Read.PerMinute })},
+		{"RATE_LIMIT_READ_BURST", "rate-limit-read-burst", "60", "read requests allowed in a burst", intVar(func(c *Config) *int { return &c.RateLimit.Read.Burst })},
+		{"RATE_LIMIT_WRITE_PER_MINUTE", "rate-limit-write-per-minute", "60", "write requests per minute", intVar(func(c *Config) *int { return &c.RateLimit.Write.PerMinute })},
+		{"RATE_LIMIT_WRITE_BURST", "rate-limit-write-burst", "20", "write requests allowed in a burst", intVar(func(c *Config) *int { return &c.RateLimit.Write.Burst })},
+		{"RATE_LIMIT_IP_PER_MINUTE", "rate-limit-ip-per-minute", "600", "authenticated endpoint requests per minute from one client IP, checked before authentication", intVar(func(c *Config) *int { return &c.RateLimit.IP.PerMinute })},
+		{"RATE_LIMIT_IP_BURST", "rate-limit-ip-burst", "120", "authenticated endpoint requests from one client IP allowed in a burst", intVar(func(c *Config) *int { return &c.RateLimit.IP.Burst })},
+
+		{"BANDWIDTH_GLOBAL_KBPS", "bandwidth-global-kbps", "0", "total asset transfer rate in KiB/s, 0 is unlimited", intVar(func(c *Config) *int { return &c.Bandwidth.GlobalKBps })},
+		{"BANDWIDTH_ADMIN_KBPS", "bandwidth-admin-kbps", "0", "asset transfer rate per admin in KiB/s, 0 is unlimited", intVar(func(c *Config) *int { return &c.Bandwidth.AdminKBps })},
+		{"BANDWIDTH_USER_KBPS", "bandwidth-user-kbps", "0", "asset transfer rate per user in KiB/s, 0 is unlimited", intVar(func(c *Config) *int { return &c.Bandwidth.UserKBps })},
+		{"BANDWIDTH_READ_ONLY_KBPS", "bandwidth-read-only-kbps", "0", "asset transfer rate per read-only user in KiB/s, 0 is unlimited", intVar(func(c *Config) *int { return &c.Bandwidth.ReadOnlyKBps })},
+
+		{"CORS_ALLOWED_ORIGINS", "cors-allowed-origins", "", "origins allowed to call the API from a browser, * and https://*.example.com patterns allowed, empty disables CORS", listVar(func(c *Config) *[]string { return &c.CORS.AllowedOrigins })},
+		{"CORS_ALLOWED_METHODS", "cors-allowed-methods", "GET,HEAD,POST,PUT,DELETE", "methods allowed in cross-origin requests", listVar(func(c *Config) *[]string { return &c.CORS.AllowedMethods })},
+		{"CORS_ALLOWED_HEADERS", "cors-allowed-headers", "Authorization,Content-Type,X-CSRF-Token,X-Request-ID,traceparent", "request headers allowed in cross-origin requests, * allows any", listVar(func(c *Config) *[]string { return &c.CORS.AllowedHeaders })},
+		{"CORS_EXPOSED_HEADERS", "cors-exposed-headers", "ETag,Content-Range,Location,Retry-After,X-Request-ID,RateLimit-Limit,RateLimit-Remaining,RateLimit-Reset,RateLimit-Policy", "response headers readable by cross-origin scripts", listVar(func(c *Config) *[]string { return &c.CORS.ExposedHeaders })},
+		{"CORS_ALLOW_CREDENTIALS", "cors-allow-credentials", "false", "allow cookies and authorization in cross-origin requests", boolVar(func(c *Config) *bool { return &c.CORS.AllowCredentials })},
+		{"CORS_MAX_AGE", "cors-max-age", "10m", "how long browsers may cache a preflight response", durationVar(func(c *Config) *time.Duration { return &c.CORS.MaxAge })},
+
+		{"WEB_UI_ENABLED", "web-ui-enabled", "true", "serve the web interface at /ui/", boolVar(func(c *Config) *bool { return &c.Web.UIEnabled })},
+		{"API_DOCS_ENABLED", "api-docs-enabled", "true", "serve the OpenAPI document at /openapi.json and API docs at /docs/", boolVar(func(c *Config) *bool { return &c.Web.DocsEnabled })},
+		{"SHARE_LINK_TTL", "share-link-ttl", "24h", "default share link lifetime", durationVar(func(c *Config) *time.Duration { return &c.Web.ShareLinkTTL })},
+		{"SHARE_LINK_MAX_TTL", "share-link-max-ttl", "720h", "longest share link lifetime a user may request", durationVar(func(c *Config) *time.Duration { return &c.Web.ShareLinkMaxTTL })},
+
+		{"CHANGES_RETENTION", "changes-retention", "720h", "how long asset change events are kept", durationVar(func(c *Config) *time.Duration { return &c.Changes.Retention })},
+		{"CHANGES_MAX_WAIT", "changes-max-wait", "60s", "longest time a long-poll request to /api/changes may wait", durationVar(func(c *Config) *time.Duration { return &c.Changes.MaxWait })},
+	}
+}
+
+// Load собирает конфигурацию из флагов args, окружения и файла конфигурации.
+// Аргументы после флагов (например, подкоманда migrate) возвращаются в rest.
+func Load(args []string) (cfg Config, rest []string, err error) {
+	all := settings()
+
+	fs := flag.NewFlagSet("web-storage-service", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	configFile := fs.String("config", "", "configuration file in .env format (env CONFIG_FILE, default .env if present)")
+	flagValues := make(map[string]*string, len(all))
+	for _, st := range all {
+		flagValues[st.flag] = fs.String(st.flag, "", st.usage+" (env "+st.env+", default \""+st.def+"\")")
+	}
+
+	if err = fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			fs.SetOutput(os.Stderr)
+			fs.PrintDefaults()
+		}
+		return cfg, nil, err
+	}
+
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	fileValues, err := readConfigFile(*configFile, explicit["config"])
+	if err != nil {
+		return cfg, nil, err
+	}
+
+	var errs []error
+	for _, st := range all {
+		// пустые значения в окружении и файле считаются незаданными, как раньше в envOrDefault
+		value, ok := st.def, false
+		if v := fileValues[st.env]; v != "" {
+			value = v
+		}
+		if v := os.Getenv(st.env); v != "" {
+			value = v
+		}
+		if explicit[st.flag] {
+			value, ok = *flagValues[st.flag], true
+		}
+
+		if err := st.set(&cfg, value); err != nil {
+			source := st.env
+			if ok {
+				source = "-" + st.flag
+			}
+			errs = append(errs, fmt.Errorf("invalid value %q for %s: %w", value, source, err))
+		}
+	}
+	if len(errs) > 0 {
+		return cfg, nil, errors.Join(errs...)
+	}
+
+	return cfg, fs.Args(), cfg.Validate()
+}
+
+// readConfigFile читает файл из -config или CONFIG_FILE; .env по умолчанию необязателен
+func readConfigFile(path string, explicit bool) (map[string]string, error) {
+	if !explicit {
+		path = os.Getenv("CONFIG_FILE")
+		explicit = path != ""
+	}
+	if path == "" {
+		path = ".env"
+	}
+
+	values, err := pkg.ReadEnvFile(path)
+	if err != nil {
+		if !explicit && errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+	return values, nil
+}
+
+// Validate проверяет согласованность настроек, возвращая все найденные ошибки сразу
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Port > 0 && c.Port < 65536, "PORT must be between 1 and 65535, got %d", c.Port)
+	check((c.CertFile == "") == (c.KeyFile == ""), "CERT_FILE and KEY_FILE must be set together")
+	check(slices.Contains([]string{"debug", "info", "warn", "error"}, c.LogLevel), "LOG_LEVEL must be debug, info, warn or error, got %q", c.LogLevel)
+	check(slices.Contains([]string{"json", "text"}, c.LogFormat), "LOG_FORMAT must be json or text, got %q", c.LogFormat)
+	check(c.ShutdownTimeout > 0, "SHUTDOWN_TIMEOUT must be positive")
+	check(c.ShutdownDelay >= 0, "SHUTDOWN_DELAY must not be negative")
+	check(c.Health.DiskMinFreeMB >= 0, "HEALTH_DISK_MIN_FREE_MB must not be negative")
+
+	check(slices.Contains([]string{"none", "otlp", "stdout"}, c.Tracing.Exporter), "OTEL_TRACES_EXPORTER must be none, otlp or stdout, got %q", c.Tracing.Exporter)
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "OTEL_TRACES_SAMPLER_ARG must be between 0 and 1, got %g", c.Tracing.SampleRatio)
+
+	check(c.Database.Host != "", "DB_HOST is required")
+	check(c.Database.Port > 0 && c.Database.Port < 65536, "DB_PORT must be between 1 and 65535, got %d", c.Database.Port)
+	check(c.Database.Name != "", "DB_DATABASE is required")
+	check(c.Database.Username != "", "DB_USERNAME is required")
+
+	check(slices.Contains([]string{AuthModeSession, AuthModeJWT}, c.Auth.Mode), "AUTH_MODE must be %q or %q, got %q", AuthModeSession, AuthModeJWT, c.Auth.Mode)
+	check(slices.Contains([]string{pkg.JWTAlgEdDSA, pkg.JWTAlgES256}, c.Auth.JWTAlg), "JWT_ALG must be %q or %q, got %q", pkg.JWTAlgEdDSA, pkg.JWTAlgES256, c.Auth.JWTAlg)
+	check(c.Auth.JWTTTL > 0, "JWT_TTL must be positive")
+	check(c.Auth.JWTKeyRotation > 0, "JWT_KEY_ROTATION must be positive")
+	if c.Auth.JWTKeySecret != "" {
+		secret, err := c.Auth.DecodeJWTKeySecret()
+		check(err == nil && len(secret) == 32, "JWT_KEY_SECRET must be 32 bytes in base64")
+	}
+	if c.Auth.CookieSessions {
+		check(c.Auth.CookieName != "", "AUTH_COOKIE_NAME is required when AUTH_COOKIE_SESSIONS is set")
+		check(slices.Contains([]string{"lax", "strict", "none"}, c.Auth.CookieSameSite), "AUTH_COOKIE_SAMESITE must be lax, strict or none, got %q", c.Auth.CookieSameSite)
+	}
+
+	if c.OIDC.Enabled() {
+		check(c.OIDC.ClientID != "", "OIDC_CLIENT_ID is required when OIDC_ISSUER is set")
+		check(c.OIDC.RedirectURL != "", "OIDC_REDIRECT_URL is required when OIDC_ISSUER is set")
+		check(slices.Contains(c.OIDC.Scopes, "openid"), "OIDC_SCOPES must include openid")
+	}
+
+	check(c.Lockout.MaxFailures > 0, "LOGIN_MAX_FAILURES must be positive")
+	check(c.Lockout.IPMaxFailures > 0, "LOGIN_IP_MAX_FAILURES must be positive")
+	check(c.Lockout.FailureWindow > 0, "LOGIN_FAILURE_WINDOW must be positive")
+	check(c.Lockout.BaseLockout > 0, "LOGIN_LOCKOUT_BASE must be positive")
+	check(c.Lockout.MaxLockout >= c.Lockout.BaseLockout, "LOGIN_LOCKOUT_MAX must not be less than LOGIN_LOCKOUT_BASE")
+
+	if c.RateLimit.Enabled {
+		check(slices.Contains([]string{RateLimitStoreMemory, RateLimitStorePostgres}, c.RateLimit.Store), "RATE_LIMIT_STORE must be %q or %q, got %q", RateLimitStoreMemory, RateLimitStorePostgres, c.RateLimit.Store)
+		for _, l := range []struct {
+			name  string
+			limit RateLimit
+		}{{"AUTH", c.RateLimit.Auth}, {"READ", c.RateLimit.Read}, {"WRITE", c.RateLimit.Write}, {"IP", c.RateLimit.IP}} {
+			check(l.limit.PerMinute > 0, "RATE_LIMIT_%s_PER_MINUTE must be positive", l.name)
+			check(l.limit.Burst > 0, "RATE_LIMIT_%s_BURST must be positive", l.name)
+		}
+	}
+
+	check(c.Bandwidth.GlobalKBps >= 0, "BANDWIDTH_GLOBAL_KBPS must not be negative")
+	check(c.Bandwidth.AdminKBps >= 0, "BANDWIDTH_ADMIN_KBPS must not be negative")
+	check(c.Bandwidth.UserKBps >= 0, "BANDWIDTH_USER_KBPS must not be negative")
+	check(c.Bandwidth.ReadOnlyKBps >= 0, "BANDWIDTH_READ_ONLY_KBPS must not be negative")
+
+	if len(c.CORS.AllowedOrigins) > 0 {
+		for _, origin := range c.CORS.AllowedOrigins {
+			check(origin == "*" || validOriginPattern(origin) || !strings.Contains(origin, "*") && strings.Contains(origin, "://"), "CORS_ALLOWED_ORIGINS entry %q must be *, an origin like https://example.com or a pattern like https://*.example.com", origin)
+			// с cookies отражается origin запроса, поэтому шаблон вроде https://* открыл бы сессии любому сайту;
+			// разрешаем только точные origin
+			check(!c.CORS.AllowCredentials || !strings.Contains(origin, "*"), "CORS_ALLOW_CREDENTIALS requires exact origins in CORS_ALLOWED_ORIGINS, got %q", origin)
+		}
+		check(c.CORS.MaxAge >= 0, "CORS_MAX_AGE must not be negative")
+	}
+
+	check(c.Web.ShareLinkTTL > 0, "SHARE_LINK_TTL must be positive")
+	check(c.Web.ShareLinkMaxTTL >= c.Web.ShareLinkTTL, "SHARE_LINK_MAX_TTL must not be less than SHARE_LINK_TTL")
+
+	check(c.Changes.Retention > 0, "CHANGES_RETENTION must be positive")
+	check(c.Changes.MaxWait > 0, "CHANGES_MAX_WAIT must be positive")
+
+	return errors.Join(errs...)
+}
+
+// validOriginPattern шаблон вида https://*.example.com: звездочка заменяет левую часть
+// имени хоста, справа от нее остается домен хотя бы из двух частей
+func validOriginPattern(origin string) bool {
+	scheme, rest, ok := strings.Cut(origin, "://")
+	domain, ok2 := strings.CutPrefix(rest, "*.")
+	return ok && ok2 && scheme != "" && strings.Contains(domain, ".") &&
+		!strings.ContainsAny(domain, "*/") && !strings.HasPrefix(domain, ".") && !strings.HasSuffix(domain, ".")
+}
+
+func stringVar(field func(c *Config) *string) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		*field(c) = v
+		return nil
+	}
+}
+
+func intVar(field func(c *Config) *int) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return errors.New("not an integer")
+		}
+		*field(c) = n
+		return nil
+	}
+}
+
+func floatVar(field func(c *Config) *float64) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return errors.New("not a number")
+		}
+		*field(c) = f
+		return nil
+	}
+}
+
+func boolVar(field func(c *Config) *bool) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return errors.New("not a boolean")
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+func durationVar(field func(c *Config) *time.Duration) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return errors.New("not a duration like 30s, 15m or 24h")
+		}
+		*field(c) = d
+		return nil
+	}
+}
+
+// listVar разбирает список, разделенный запятыми и/или пробелами
+func listVar(field func(c *Config) *[]string) func(c *Config, v string) error {
+	return func(c *Config, v string) error {
+		*field(c) = strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' })
+		return nil
+	}
+}
@@ -3,11 +3,13 @@ package database
 import (
 	"context"
 	"fmt"
-	"log"
-	"os"
+	"log/slog"
+	"net"
+	"net/url"
 	"strconv"
 	"time"
-	"web-storage-service/pkg"
+	"web-storage-service/internal/config"
+	"web-storage-service/internal/tracing"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
@@ -15,22 +17,6 @@ import (
 	_ "github.com/jackc/pgx/v5/stdlib"
 )
 
-func init() {
-	// TODO: Если использовать "github.com/joho/godotenv/autoload",
-	// TODO: можно будет убрать init() функции
-	err := pkg.LoadEnv(".env")
-	if err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
-	}
-
-	database = os.Getenv("DB_DATABASE")
-	password = os.Getenv("DB_PASSWORD")
-	username = os.Getenv("DB_USERNAME")
-	port = os.Getenv("DB_PORT")
-	host = os.Getenv("DB_HOST")
-	schema = os.Getenv("DB_SCHEMA")
-}
-
 // Service represents a service that interacts with a database.
 type Service interface {
 	Exec(ctx context.Context, query string, args ...interface{}) (pgconn.CommandTag, error)
@@ -43,40 +29,74 @@ type Service interface {
 
 	BeginTx(ctx context.Context) (pgx.Tx, error)
 
+	// Listen получает уведомления LISTEN/NOTIFY канала channel на отдельном соединении
+	Listen(ctx context.Context, channel string, handle func(payload string)) error
+
+	// Health возвращает статус соединения и статистику пула
 	Health() map[string]string
 
+	Ping(ctx context.Context) error
+
+	PoolStats() PoolStats
+
+	// MigrateUp применяет все еще не примененные встроенные миграции
+	MigrateUp(ctx context.Context) ([]int, error)
+
+	MigrateDown(ctx context.Context, steps int) ([]int, error)
+
+	MigrationStatus(ctx context.Context) ([]MigrationStatus, error)
+
+	ForceMigrationVersion(ctx context.Context, version int) error
+
 	Close()
 }
 
 type service struct {
 	db *pgxpool.Pool
+
+	name string
 }
 
-var (
-	database   string
-	password   string
-	username   string
-	port       string
-	host       string
-	schema     string
-	dbInstance *service
-)
+// New открывает пул соединений по настройкам cfg и, если включено
+// DB_AUTO_MIGRATE, применяет недостающие миграции
+// tracer может быть nil, тогда запросы не трассируются.
+func New(cfg config.DatabaseConfig, tracer *tracing.Tracer) (Service, error) {
+	// url.URL экранирует спецсимволы в пароле и имени схемы
+	connURL := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.Username, cfg.Password),
+		Host:     net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		Path:     "/" + cfg.Name,
+		RawQuery: url.Values{"sslmode": {"disable"}, "search_path": {cfg.Schema}}.Encode(),
+	}
+	connStr := connURL.String()
 
-func New() Service {
-	// Reuse Connection
-	if dbInstance != nil {
-		return dbInstance
+	poolConfig, err := pgxpool.ParseConfig(connStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database config: %w", err)
+	}
+	if tracer != nil {
+		poolConfig.ConnConfig.Tracer = tracer.QueryTracer()
 	}
-	connStr := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable&search_path=%s", username, password, host, port, database, schema)
 
-	pool, err := pgxpool.New(context.Background(), connStr)
+	pool, err := pgxpool.NewWithConfig(context.Background(), poolConfig)
 	if err != nil {
-		panic(fmt.Sprintf("Unable to connect to database: %v\n", err))
+		return nil, fmt.Errorf("unable to connect to database: %w", err)
 	}
-	dbInstance = &service{
-		db: pool,
+	s := &service{
+		db:   pool,
+		name: cfg.Name,
 	}
-	return dbInstance
+
+	// Новая база без таблиц сразу получает схему, а не падает на первом запросе
+	if cfg.AutoMigrate {
+		if _, err = s.MigrateUp(context.Background()); err != nil {
+			pool.Close()
+			return nil, fmt.Errorf("unable to apply migrations: %w", err)
+		}
+	}
+
+	return s, nil
 }
 
 func (s *service) Exec(ctx context.Context, query string, args ...interface{}) (pgconn.CommandTag, error) {
@@ -118,31 +138,71 @@ func (s *service) Health() map[string]string {
 	if err != nil {
 		stats["status"] = "down"
 		stats["error"] = fmt.Sprintf("db down: %v", err)
-		log.Fatalf(fmt.Sprintf("db down: %v", err))
 		return stats
 	}
 
 	stats["status"] = "up"
 	stats["message"] = "It's healthy"
 
-	dbStats := s.db.Stat()
-	stats["open_connections"] = strconv.Itoa(int(dbStats.NewConnsCount()))
-	stats["idle"] = strconv.Itoa(int(dbStats.IdleConns()))
-	stats["acquire_duration"] = dbStats.AcquireDuration().String()
-	stats["max_lifetime_closed"] = strconv.FormatInt(dbStats.MaxLifetimeDestroyCount(), 10)
-
-	if dbStats.AcquiredConns() > 40 {
+	dbStats := s.PoolStats()
+	stats["open_connections"] = strconv.Itoa(int(dbStats.TotalConns))
+	stats["in_use"] = strconv.Itoa(int(dbStats.AcquiredConns))
+	stats["idle"] = strconv.Itoa(int(dbStats.IdleConns))
+	stats["max_connections"] = strconv.Itoa(int(dbStats.MaxConns))
+	stats["new_connections"] = strconv.FormatInt(dbStats.NewConns, 10)
+	stats["acquire_count"] = strconv.FormatInt(dbStats.AcquireCount, 10)
+	stats["empty_acquire_count"] = strconv.FormatInt(dbStats.EmptyAcquireCount, 10)
+	stats["acquire_duration"] = dbStats.AcquireDuration.String()
+	stats["max_lifetime_closed"] = strconv.FormatInt(dbStats.MaxLifetimeDestroyCount, 10)
+
+	if dbStats.AcquiredConns > 40 {
 		stats["message"] = "The database is experiencing heavy load."
 	}
 
-	if dbStats.MaxLifetimeDestroyCount() > int64(dbStats.AcquiredConns())/2 {
+	if dbStats.MaxLifetimeDestroyCount > int64(dbStats.AcquiredConns)/2 {
 		stats["message"] = "Many connections are being closed due to max lifetime, consider increasing max lifetime or revising the connection usage pattern."
 	}
 
 	return stats
 }
 
+// PoolStats статистика пула соединений; по ней строятся Health и метрики
+type PoolStats struct {
+	TotalConns              int32
+	AcquiredConns           int32
+	IdleConns               int32
+	MaxConns                int32
+	NewConns                int64
+	AcquireCount            int64
+	EmptyAcquireCount       int64
+	CanceledAcquireCount    int64
+	MaxLifetimeDestroyCount int64
+	MaxIdleDestroyCount     int64
+	AcquireDuration         time.Duration
+}
+
+func (s *service) PoolStats() PoolStats {
+	st := s.db.Stat()
+	return PoolStats{
+		TotalConns:              st.TotalConns(),
+		AcquiredConns:           st.AcquiredConns(),
+		IdleConns:               st.IdleConns(),
+		MaxConns:                st.MaxConns(),
+		NewConns:                st.NewConnsCount(),
+		AcquireCount:            st.AcquireCount(),
+		EmptyAcquireCount:       st.EmptyAcquireCount(),
+		CanceledAcquireCount:    st.CanceledAcquireCount(),
+		MaxLifetimeDestroyCount: st.MaxLifetimeDestroyCount(),
+		MaxIdleDestroyCount:     st.MaxIdleDestroyCount(),
+		AcquireDuration:         st.AcquireDuration(),
+	}
+}
+
+func (s *service) Ping(ctx context.Context) error {
+	return s.db.Ping(ctx)
+}
+
 func (s *service) Close() {
-	log.Printf("Disconnected from database: %s", database)
+	slog.Info("disconnected from database", "database", s.name)
 	defer s.db.Close()
 }
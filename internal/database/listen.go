@@ -0,0 +1,30 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Listen подписывается на канал NOTIFY и вызывает handle для каждого уведомления
+// до отмены ctx или обрыва соединения. Соединение забирается из пула насовсем:
+// вернувшись в пул, оно продолжило бы получать уведомления.
+func (s *service) Listen(ctx context.Context, channel string, handle func(payload string)) error {
+	pooled, err := s.db.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err = conn.Exec(ctx, "LISTEN "+pgx.Identifier{channel}.Sanitize()); err != nil {
+		return err
+	}
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		handle(notification.Payload)
+	}
+}
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS assets;
+DROP TABLE IF EXISTS sessions;
+DROP TABLE IF EXISTS users;
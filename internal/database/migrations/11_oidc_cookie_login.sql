@@ -0,0 +1,3 @@
+-- вход через OIDC, начатый с ?cookie=true, завершается выдачей cookie
+ALTER TABLE oidc_login_states
+    ADD COLUMN IF NOT EXISTS cookie BOOLEAN NOT NULL DEFAULT FALSE;
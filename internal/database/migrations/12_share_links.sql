@@ -0,0 +1,11 @@
+-- публичные ссылки на скачивание файлов без входа
+CREATE TABLE IF NOT EXISTS share_links (
+    id         TEXT PRIMARY KEY,                   -- случайный токен из ссылки
+    uid        BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name       TEXT NOT NULL,                      -- имя файла; при переименовании файла обновляется
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    downloads  INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS share_links_uid_name_idx ON share_links (uid, name);
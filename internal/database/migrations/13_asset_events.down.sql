@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS asset_events;
+ALTER TABLE users DROP COLUMN IF EXISTS asset_event_seq;
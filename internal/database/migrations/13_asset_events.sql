@@ -0,0 +1,18 @@
+-- лента изменений файлов: события только добавляются, курсор seq растет у каждого пользователя.
+-- Счетчик в users блокирует строку пользователя до коммита, поэтому события
+-- становятся видны строго в порядке seq и клиент с курсором их не пропустит.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS asset_event_seq BIGINT NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS asset_events (
+    uid        BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    seq        BIGINT NOT NULL,
+    type       TEXT NOT NULL CHECK (type IN ('create', 'update', 'delete', 'restore')),
+    name       TEXT NOT NULL,
+    sha256     TEXT,                               -- NULL для delete
+    size       BIGINT NOT NULL DEFAULT 0,
+    permanent  BOOLEAN NOT NULL DEFAULT FALSE,     -- delete: удален окончательно, а не в корзину
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (uid, seq)
+);
+
+CREATE INDEX IF NOT EXISTS asset_events_created_at_idx ON asset_events (created_at);
@@ -0,0 +1,13 @@
+ALTER TABLE assets
+    DROP CONSTRAINT IF EXISTS fk_assets_users,
+    DROP COLUMN IF EXISTS deleted;
+
+ALTER TABLE sessions
+    DROP CONSTRAINT IF EXISTS fk_sessions_users,
+    DROP COLUMN IF EXISTS active,
+    DROP COLUMN IF EXISTS expires_at,
+    DROP COLUMN IF EXISTS ip_address;
+
+ALTER TABLE users
+    DROP CONSTRAINT IF EXISTS password_hash_length,
+    DROP CONSTRAINT IF EXISTS login_length;
@@ -1,5 +1,3 @@
-BEGIN;
-
 -- Добавить ограничения длины для login и password_hash
 ALTER TABLE users
     ADD CONSTRAINT login_length CHECK (length(login) <= 255),
@@ -21,5 +19,3 @@ ALTER TABLE assets
 
 -- Удалить временное значение по умолчанию из ip_address
 ALTER TABLE sessions ALTER COLUMN ip_address DROP DEFAULT;
-
-COMMIT;
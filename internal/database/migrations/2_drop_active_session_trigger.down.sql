@@ -0,0 +1 @@
+-- триггер был необязательным, восстанавливать нечего: см. optional/set_active_session_trigger.sql
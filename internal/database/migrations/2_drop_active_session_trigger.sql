@@ -0,0 +1,3 @@
+-- сессии переключает CreateNewSessionWithTransaction, триггер из optional/ ему мешает
+DROP TRIGGER IF EXISTS activate_latest_session ON sessions;
+DROP FUNCTION IF EXISTS set_active_session();
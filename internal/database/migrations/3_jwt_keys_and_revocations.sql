@@ -0,0 +1,19 @@
+-- ключи подписи JWT, общие для всех инстансов сервиса
+CREATE TABLE IF NOT EXISTS jwt_keys (
+    kid         TEXT PRIMARY KEY,
+    alg         TEXT NOT NULL,
+    private_key BYTEA NOT NULL,               -- PKCS#8 DER
+    created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    retire_at   TIMESTAMPTZ NOT NULL,         -- после этого ключ не используется для подписи
+    expires_at  TIMESTAMPTZ NOT NULL          -- после этого ключ не публикуется в JWKS
+);
+
+-- отозванные JWT (logout); хранятся до истечения срока действия токена
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti        TEXT PRIMARY KEY,
+    uid        BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS revoked_tokens_expires_at_idx ON revoked_tokens (expires_at);
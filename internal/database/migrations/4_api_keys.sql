@@ -0,0 +1,16 @@
+-- персональные API-ключи пользователей для автоматизации
+CREATE TABLE IF NOT EXISTS api_keys (
+    id           TEXT PRIMARY KEY,                 -- публичная часть ключа, по ней ищем запись
+    uid          BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name         TEXT NOT NULL,
+    key_hash     TEXT NOT NULL,                    -- sha256 от полного ключа, сам ключ не храним
+    scopes       TEXT[] NOT NULL,
+    path_prefix  TEXT NOT NULL DEFAULT '',         -- ключ работает только с файлами с этим префиксом
+    expires_at   TIMESTAMPTZ,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ,
+    revoked      BOOLEAN NOT NULL DEFAULT FALSE,
+    CONSTRAINT api_keys_name_length CHECK (length(name) <= 255)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS api_keys_uid_name_idx ON api_keys (uid, name) WHERE revoked = FALSE;
@@ -0,0 +1,25 @@
+-- двухфакторная аутентификация по TOTP (RFC 6238)
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS totp_secret       TEXT,
+    ADD COLUMN IF NOT EXISTS totp_enabled      BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS totp_last_counter BIGINT NOT NULL DEFAULT 0;  -- защита от повторного использования кода
+
+-- одноразовые коды восстановления
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id        BIGSERIAL PRIMARY KEY,
+    uid       BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash TEXT NOT NULL,
+    used_at   TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS recovery_codes_uid_idx ON recovery_codes (uid);
+
+-- незавершенные входы: пароль проверен, ждем код второго фактора
+CREATE TABLE IF NOT EXISTS login_challenges (
+    id         TEXT PRIMARY KEY,
+    uid        BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    ip_address INET NOT NULL,
+    attempts   INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,20 @@
+-- учетные записи внешних провайдеров OpenID Connect, привязанные к пользователям
+CREATE TABLE IF NOT EXISTS user_identities (
+    issuer     TEXT NOT NULL,
+    subject    TEXT NOT NULL,
+    uid        BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email      TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (issuer, subject)
+);
+
+CREATE INDEX IF NOT EXISTS user_identities_uid_idx ON user_identities (uid);
+
+-- незавершенные входы через OIDC: state, PKCE code_verifier и nonce
+CREATE TABLE IF NOT EXISTS oidc_login_states (
+    state         TEXT PRIMARY KEY,
+    code_verifier TEXT NOT NULL,
+    nonce         TEXT NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at    TIMESTAMPTZ NOT NULL
+);
@@ -0,0 +1,9 @@
+-- счетчики неудачных входов по логину и по IP; общие для всех инстансов
+CREATE TABLE IF NOT EXISTS login_attempts (
+    key             TEXT PRIMARY KEY,            -- 'login:<login>' или 'ip:<address>'
+    failures        INT NOT NULL DEFAULT 0,
+    locked_until    TIMESTAMPTZ,
+    last_failure_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS login_attempts_locked_until_idx ON login_attempts (locked_until);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS user_token_revocations;
+
+ALTER TABLE users
+    DROP CONSTRAINT IF EXISTS users_role_check,
+    DROP COLUMN IF EXISTS disabled,
+    DROP COLUMN IF EXISTS role;
@@ -0,0 +1,13 @@
+-- роли пользователей и блокировка учетных записей администратором
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS role     TEXT NOT NULL DEFAULT 'user',
+    ADD COLUMN IF NOT EXISTS disabled BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE users
+    ADD CONSTRAINT users_role_check CHECK (role IN ('admin', 'user', 'read-only'));
+
+-- отзыв всех JWT пользователя, выпущенных до revoked_before (force logout, смена роли, блокировка)
+CREATE TABLE IF NOT EXISTS user_token_revocations (
+    uid            BIGINT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    revoked_before TIMESTAMPTZ NOT NULL
+);
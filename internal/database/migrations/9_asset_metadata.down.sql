@@ -0,0 +1,3 @@
+ALTER TABLE assets
+    DROP COLUMN IF EXISTS updated_at,
+    DROP COLUMN IF EXISTS sha256;
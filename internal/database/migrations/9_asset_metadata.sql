@@ -0,0 +1,8 @@
+-- метаданные файла: хэш содержимого для ETag и время последнего изменения
+ALTER TABLE assets
+    ADD COLUMN IF NOT EXISTS sha256     TEXT,
+    ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+UPDATE assets SET sha256 = encode(sha256(data), 'hex'), updated_at = created_at;
+
+ALTER TABLE assets ALTER COLUMN sha256 SET NOT NULL;
@@ -0,0 +1,16 @@
+package dto
+
+type ListUsers struct {
+	Query  string `json:"query"`
+	Role   string `json:"role"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+}
+
+type SetUserRole struct {
+	Role string `json:"role"`
+}
+
+type ResetPassword struct {
+	Password string `json:"password"`
+}
@@ -0,0 +1,9 @@
+package dto
+
+type CopyAsset struct {
+	Name    string `json:"-"`
+	NewName string `json:"name"`
+	// Overwrite заменяет существующий файл с именем NewName
+	Overwrite bool `json:"overwrite"`
+	UserID    int  `json:"-"`
+}
@@ -0,0 +1,6 @@
+package dto
+
+type CreateShareLink struct {
+	// ExpiresIn срок жизни ссылки в секундах, 0 означает SHARE_LINK_TTL
+	ExpiresIn int64 `json:"expires_in"`
+}
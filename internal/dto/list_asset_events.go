@@ -0,0 +1,10 @@
+package dto
+
+type ListAssetEvents struct {
+	UserID int
+	// Since курсор клиента, Until последний seq на момент запроса
+	Since  int64
+	Until  int64
+	Prefix string
+	Limit  int
+}
@@ -1,7 +1,8 @@
 package dto
 
 type ListAssets struct {
-	UserID int `json:"user_id"`
-	Limit  int `json:"limit"`
-	Offset int `json:"offset"`
+	UserID int    `json:"user_id"`
+	Limit  int    `json:"limit"`
+	Offset int    `json:"offset"`
+	Prefix string `json:"prefix"`
 }
@@ -0,0 +1,9 @@
+package dto
+
+type PutAsset struct {
+	Name   string `json:"name"`
+	UserID int    `json:"user_id"`
+	Data   []byte `json:"data"`
+	// Overwrite заменяет существующий файл; без него загрузка поверх существующего не выполняется
+	Overwrite bool `json:"overwrite"`
+}
@@ -0,0 +1,7 @@
+package dto
+
+type RenameAsset struct {
+	Name    string `json:"-"`
+	NewName string `json:"name"`
+	UserID  int    `json:"-"`
+}
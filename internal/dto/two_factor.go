@@ -0,0 +1,10 @@
+package dto
+
+type TOTPCode struct {
+	Code string `json:"code"`
+}
+
+type CompleteTwoFactorLogin struct {
+	Challenge string `json:"challenge"`
+	Code      string `json:"code"`
+}
@@ -0,0 +1,351 @@
+// Package metrics реализует счетчики, гистограммы и gauge-метрики
+// с выводом в текстовом формате Prometheus (exposition format 0.0.4).
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefBuckets границы гистограммы по умолчанию, в секундах
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+
+// collector одна метрика со всеми ее сериями
+type collector interface {
+	describe() (name, help, typ string)
+	write(w *bufio.Writer, name string)
+}
+
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+	names      map[string]bool
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+func (r *Registry) register(c collector) {
+	name, _, _ := c.describe()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[name] {
+		panic(fmt.Sprintf("metrics: duplicate metric %q", name))
+	}
+	r.names[name] = true
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteText выводит все метрики в порядке регистрации
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		name, help, typ := c.describe()
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, typ)
+		c.write(bw, name)
+	}
+	return bw.Flush()
+}
+
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		_ = r.WriteText(w)
+	})
+}
+
+// series хранит значения метрики по наборам значений меток
+type series[T any] struct {
+	labels []string
+	mu     sync.Mutex
+	values map[string]*T
+	keys   map[string][]string
+}
+
+func newSeries[T any](labels []string) series[T] {
+	return series[T]{labels: labels, values: make(map[string]*T), keys: make(map[string][]string)}
+}
+
+func (s *series[T]) get(labelValues []string, init func() *T) *T {
+	if len(labelValues) != len(s.labels) {
+		panic(fmt.Sprintf("metrics: expected %d label values, got %d", len(s.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.values[key]
+	if !ok {
+		v = init()
+		s.values[key] = v
+		s.keys[key] = append([]string(nil), labelValues...)
+	}
+	return v
+}
+
+// each обходит серии в отсортированном порядке, чтобы вывод был стабильным
+func (s *series[T]) each(fn func(labelValues []string, v *T)) {
+	s.mu.Lock()
+	keys := make([]string, 0, len(s.values))
+	for key := range s.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	type entry struct {
+		labelValues []string
+		v           *T
+	}
+	entries := make([]entry, len(keys))
+	for i, key := range keys {
+		entries[i] = entry{s.keys[key], s.values[key]}
+	}
+	s.mu.Unlock()
+
+	for _, e := range entries {
+		fn(e.labelValues, e.v)
+	}
+}
+
+type value struct {
+	mu sync.Mutex
+	v  float64
+}
+
+func (v *value) add(delta float64) {
+	v.mu.Lock()
+	v.v += delta
+	v.mu.Unlock()
+}
+
+func (v *value) set(x float64) {
+	v.mu.Lock()
+	v.v = x
+	v.mu.Unlock()
+}
+
+func (v *value) get() float64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.v
+}
+
+type CounterVec struct {
+	name, help string
+	series     series[value]
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, series: newSeries[value](labels)}
+	// метрика без меток видна с нулевым значением сразу, а не после первого события
+	if len(labels) == 0 {
+		c.series.get(nil, func() *value { return &value{} })
+	}
+	r.register(c)
+	return c
+}
+
+// Add увеличивает счетчик; отрицательные delta игнорируются
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		return
+	}
+	c.series.get(labelValues, func() *value { return &value{} }).add(delta)
+}
+
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *CounterVec) describe() (string, string, string) { return c.name, c.help, "counter" }
+
+func (c *CounterVec) write(w *bufio.Writer, name string) {
+	c.series.each(func(labelValues []string, v *value) {
+		writeSample(w, name, c.series.labels, labelValues, "", "", v.get())
+	})
+}
+
+type GaugeVec struct {
+	name, help string
+	series     series[value]
+}
+
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{name: name, help: help, series: newSeries[value](labels)}
+	if len(labels) == 0 {
+		g.series.get(nil, func() *value { return &value{} })
+	}
+	r.register(g)
+	return g
+}
+
+func (g *GaugeVec) Set(x float64, labelValues ...string) {
+	g.series.get(labelValues, func() *value { return &value{} }).set(x)
+}
+
+func (g *GaugeVec) Add(delta float64, labelValues ...string) {
+	g.series.get(labelValues, func() *value { return &value{} }).add(delta)
+}
+
+func (g *GaugeVec) describe() (string, string, string) { return g.name, g.help, "gauge" }
+
+func (g *GaugeVec) write(w *bufio.Writer, name string) {
+	g.series.each(func(labelValues []string, v *value) {
+		writeSample(w, name, g.series.labels, labelValues, "", "", v.get())
+	})
+}
+
+// GaugeFunc значение вычисляется при каждом сборе метрик
+type GaugeFunc struct {
+	name, help string
+	fn         func() float64
+}
+
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, fn: fn}
+	r.register(g)
+	return g
+}
+
+func (g *GaugeFunc) describe() (string, string, string) { return g.name, g.help, "gauge" }
+
+func (g *GaugeFunc) write(w *bufio.Writer, name string) {
+	writeSample(w, name, nil, nil, "", "", g.fn())
+}
+
+// CounterFunc монотонное значение, которое считает кто-то другой, например pgxpool
+type CounterFunc struct {
+	name, help string
+	fn         func() float64
+}
+
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) *CounterFunc {
+	c := &CounterFunc{name: name, help: help, fn: fn}
+	r.register(c)
+	return c
+}
+
+func (c *CounterFunc) describe() (string, string, string) { return c.name, c.help, "counter" }
+
+func (c *CounterFunc) write(w *bufio.Writer, name string) {
+	writeSample(w, name, nil, nil, "", "", c.fn())
+}
+
+type histogram struct {
+	mu     sync.Mutex
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+type HistogramVec struct {
+	name, help string
+	buckets    []float64
+	series     series[histogram]
+}
+
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &HistogramVec{name: name, help: help, buckets: buckets, series: newSeries[histogram](labels)}
+	r.register(h)
+	return h
+}
+
+func (h *HistogramVec) Observe(x float64, labelValues ...string) {
+	hist := h.series.get(labelValues, func() *histogram {
+		return &histogram{counts: make([]uint64, len(h.buckets))}
+	})
+
+	// counts хранятся не накопительно, суммируются при выводе
+	i := sort.SearchFloat64s(h.buckets, x)
+	hist.mu.Lock()
+	if i < len(h.buckets) {
+		hist.counts[i]++
+	}
+	hist.sum += x
+	hist.count++
+	hist.mu.Unlock()
+}
+
+func (h *HistogramVec) describe() (string, string, string) { return h.name, h.help, "histogram" }
+
+func (h *HistogramVec) write(w *bufio.Writer, name string) {
+	h.series.each(func(labelValues []string, hist *histogram) {
+		hist.mu.Lock()
+		counts := append([]uint64(nil), hist.counts...)
+		sum, count := hist.sum, hist.count
+		hist.mu.Unlock()
+
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += counts[i]
+			writeSample(w, name+"_bucket", h.series.labels, labelValues, "le", formatFloat(upper), float64(cumulative))
+		}
+		writeSample(w, name+"_bucket", h.series.labels, labelValues, "le", "+Inf", float64(count))
+		writeSample(w, name+"_sum", h.series.labels, labelValues, "", "", sum)
+		writeSample(w, name+"_count", h.series.labels, labelValues, "", "", float64(count))
+	})
+}
+
+func writeSample(w *bufio.Writer, name string, labels, labelValues []string, extraLabel, extraValue string, v float64) {
+	w.WriteString(name)
+	if len(labels) > 0 || extraLabel != "" {
+		w.WriteByte('{')
+		for i, label := range labels {
+			if i > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", label, escapeLabelValue(labelValues[i]))
+		}
+		if extraLabel != "" {
+			if len(labels) > 0 {
+				w.WriteByte(',')
+			}
+			fmt.Fprintf(w, "%s=\"%s\"", extraLabel, extraValue)
+		}
+		w.WriteByte('}')
+	}
+	w.WriteByte(' ')
+	w.WriteString(formatFloat(v))
+	w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabelValue(s string) string {
+	return labelEscaper.Replace(s)
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+type APIKey struct {
+	ID         string     `json:"id"`
+	UID        int        `json:"-"`
+	Name       string     `json:"name"`
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	PathPrefix string     `json:"prefix"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	Revoked    bool       `json:"revoked"`
+}
+
+func (k APIKey) TableName() string {
+	return "api_keys"
+}
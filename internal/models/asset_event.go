@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+const (
+	AssetEventCreate  = "create"
+	AssetEventUpdate  = "update"
+	AssetEventDelete  = "delete"
+	AssetEventRestore = "restore"
+)
+
+// AssetEvent запись ленты изменений; Seq курсор, по которому клиент продолжает чтение
+type AssetEvent struct {
+	Seq  int64  `json:"seq"`
+	UID  int    `json:"-"`
+	Type string `json:"type"`
+	Name string `json:"name"`
+	// SHA256 и Size версии файла после события; у delete пустые
+	SHA256 string `json:"sha256,omitempty"`
+	Size   int64  `json:"size"`
+	// Permanent у delete: файл удален окончательно, а не перенесен в корзину
+	Permanent bool      `json:"permanent,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (e AssetEvent) TableName() string {
+	return "asset_events"
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// AssetInfo метаданные файла без содержимого
+type AssetInfo struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	// SHA256 hex-хэш содержимого, он же ETag
+	SHA256    string    `json:"sha256"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Deleted   bool      `json:"deleted"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+type JWTKey struct {
+	Kid        string    `json:"kid"`
+	Alg        string    `json:"alg"`
+	PrivateKey []byte    `json:"-"`
+	CreatedAt  time.Time `json:"created_at"`
+	RetireAt   time.Time `json:"retire_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+func (k JWTKey) TableName() string {
+	return "jwt_keys"
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+type LoginAttempt struct {
+	Key           string     `json:"key"`
+	Failures      int        `json:"failures"`
+	LockedUntil   *time.Time `json:"locked_until"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+}
+
+func (a LoginAttempt) TableName() string {
+	return "login_attempts"
+}
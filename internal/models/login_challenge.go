@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+type LoginChallenge struct {
+	ID        string    `json:"id"`
+	UID       int       `json:"uid"`
+	IPAddress string    `json:"ip_address"`
+	Attempts  int       `json:"attempts"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (c LoginChallenge) TableName() string {
+	return "login_challenges"
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+type OIDCLoginState struct {
+	State        string `json:"state"`
+	CodeVerifier string `json:"-"`
+	Nonce        string `json:"-"`
+	// Cookie вход начат с ?cookie=true
+	Cookie    bool      `json:"cookie"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (s OIDCLoginState) TableName() string {
+	return "oidc_login_states"
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// ShareLink публичная ссылка на скачивание файла по токену
+type ShareLink struct {
+	ID        string    `json:"id"`
+	UID       int       `json:"-"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Downloads int       `json:"downloads"`
+}
+
+func (l ShareLink) TableName() string {
+	return "share_links"
+}
@@ -0,0 +1,11 @@
+package models
+
+// StorageStats общая статистика хранилища для метрик
+type StorageStats struct {
+	Users          int64 `json:"users"`
+	Assets         int64 `json:"assets"`
+	Bytes          int64 `json:"bytes"`
+	DeletedAssets  int64 `json:"deleted_assets"`
+	DeletedBytes   int64 `json:"deleted_bytes"`
+	ActiveSessions int64 `json:"active_sessions"`
+}
@@ -0,0 +1,12 @@
+package models
+
+// Usage сводка по файлам и доступам пользователя для администраторов
+type Usage struct {
+	UID            int   `json:"uid"`
+	Assets         int64 `json:"assets"`
+	Bytes          int64 `json:"bytes"`
+	DeletedAssets  int64 `json:"deleted_assets"`
+	DeletedBytes   int64 `json:"deleted_bytes"`
+	ActiveSessions int64 `json:"active_sessions"`
+	APIKeys        int64 `json:"api_keys"`
+}
@@ -1,10 +1,20 @@
 package models
 
+const (
+	RoleAdmin    = "admin"
+	RoleUser     = "user"
+	RoleReadOnly = "read-only"
+)
+
 type User struct {
 	ID           int    `json:"id"`
 	Login        string `json:"login"`
-	PasswordHash string `json:"password_hash"`
+	PasswordHash string `json:"-"`
 	CreatedAt    string `json:"created_at"`
+	TOTPSecret   string `json:"-"`
+	TOTPEnabled  bool   `json:"totp_enabled"`
+	Role         string `json:"role"`
+	Disabled     bool   `json:"disabled"`
 }
 
 func (u User) TableName() string {
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+type UserIdentity struct {
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	UID       int       `json:"uid"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (i UserIdentity) TableName() string {
+	return "user_identities"
+}
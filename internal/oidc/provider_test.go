@@ -0,0 +1,433 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"web-storage-service/pkg"
+)
+
+const (
+	testClientID     = "wss"
+	testClientSecret = "s3cret"
+	testRedirectURL  = "https://storage.example.com/api/auth/oidc/callback"
+)
+
+// mockIdP провайдер OIDC с discovery, JWKS и token endpoint. ID token подписывается
+// RS256, как у большинства настоящих провайдеров.
+type mockIdP struct {
+	*httptest.Server
+	t *testing.T
+
+	mu            sync.Mutex
+	key           *rsa.PrivateKey
+	kid           string
+	discovery     map[string]interface{}
+	discoveryHits int
+	jwksHits      int
+	// codes выданные authorization code: code_challenge и nonce запроса авторизации
+	codes map[string]authRequest
+	// claims дополняет или переопределяет claim-ы выпускаемого ID token
+	claims map[string]interface{}
+}
+
+type authRequest struct {
+	challenge, nonce string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	idp := &mockIdP{t: t, codes: make(map[string]authRequest)}
+	idp.rotateKey()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		idp.discoveryHits++
+		writeJSON(w, idp.discovery)
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.mu.Lock()
+		defer idp.mu.Unlock()
+		idp.jwksHits++
+		writeJSON(w, pkg.JWKS{Keys: []pkg.JWK{{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(idp.key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(idp.key.E)).Bytes()),
+			Kid: idp.kid,
+			Alg: pkg.JWTAlgRS256,
+			Use: "sig",
+		}}})
+	})
+	mux.HandleFunc("POST /token", idp.token)
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+
+	idp.discovery = map[string]interface{}{
+		"issuer":                 idp.URL,
+		"authorization_endpoint": idp.URL + "/authorize",
+		"token_endpoint":         idp.URL + "/token",
+		"jwks_uri":               idp.URL + "/jwks",
+	}
+	return idp
+}
+
+func (idp *mockIdP) provider() *Provider {
+	return NewProvider(Config{
+		Issuer:       idp.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+		HTTPClient:   idp.Client(),
+	})
+}
+
+func (idp *mockIdP) rotateKey() {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+	idp.key = key
+	idp.kid = pkg.GenerateRandomID(4)
+}
+
+// authorize делает то, что провайдер делает после входа пользователя: запоминает
+// code_challenge и nonce из адреса авторизации и выдает code
+func (idp *mockIdP) authorize(authURL string) (code, state string) {
+	idp.t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" {
+		idp.t.Fatalf("code_challenge_method = %q, want S256", q.Get("code_challenge_method"))
+	}
+	code = pkg.GenerateRandomID(8)
+	idp.mu.Lock()
+	idp.codes[code] = authRequest{challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+	idp.mu.Unlock()
+	return code, q.Get("state")
+}
+
+func (idp *mockIdP) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	id, secret, _ := r.BasicAuth()
+	if id != testClientID || secret != testClientSecret {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+
+	idp.mu.Lock()
+	req, ok := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	idp.mu.Unlock()
+
+	verifier := r.PostForm.Get("code_verifier")
+	hash := sha256.Sum256([]byte(verifier))
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" || r.PostForm.Get("redirect_uri") != testRedirectURL ||
+		base64.RawURLEncoding.EncodeToString(hash[:]) != req.challenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idp.idToken(req.nonce),
+	})
+}
+
+// idToken выпускает ID token с действующими claim-ами, дополненными idp.claims
+func (idp *mockIdP) idToken(nonce string) string {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	claims := map[string]interface{}{
+		"iss":            idp.URL,
+		"sub":            "user-1",
+		"aud":            []string{testClientID, "other"},
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"iat":            time.Now().Unix(),
+		"nonce":          nonce,
+		"email":          "alice@example.com",
+		"email_verified": true,
+	}
+	for name, value := range idp.claims {
+		claims[name] = value
+	}
+	return signRS256(idp.t, idp.key, idp.kid, claims)
+}
+
+func signRS256(t *testing.T, key *rsa.PrivateKey, kid string, claims map[string]interface{}) string {
+	t.Helper()
+	header, _ := json.Marshal(map[string]string{"alg": pkg.JWTAlgRS256, "typ": "JWT", "kid": kid})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func TestCodeChallengeS256(t *testing.T) {
+	// пример из RFC 7636, приложение B
+	got := CodeChallengeS256("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk")
+	if want := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"; got != want {
+		t.Fatalf("CodeChallengeS256 = %q, want %q", got, want)
+	}
+	if a, b := GenerateCodeVerifier(), GenerateCodeVerifier(); a == b || len(a) < 43 {
+		t.Fatalf("code verifiers must be random and at least 43 characters, got %q and %q", a, b)
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("cached", func(t *testing.T) {
+		idp := newMockIdP(t)
+		p := idp.provider()
+		for i := 0; i < 3; i++ {
+			if _, err := p.AuthCodeURL(ctx, "state", "nonce", GenerateCodeVerifier()); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if idp.discoveryHits != 1 {
+			t.Fatalf("discovery fetched %d times, want 1", idp.discoveryHits)
+		}
+	})
+
+	t.Run("issuer mismatch", func(t *testing.T) {
+		idp := newMockIdP(t)
+		idp.discovery["issuer"] = "https://evil.example.com"
+		if _, err := idp.provider().AuthCodeURL(ctx, "state", "nonce", GenerateCodeVerifier()); err == nil || !strings.Contains(err.Error(), "does not match") {
+			t.Fatalf("error = %v, want issuer mismatch", err)
+		}
+	})
+
+	t.Run("incomplete metadata", func(t *testing.T) {
+		idp := newMockIdP(t)
+		delete(idp.discovery, "jwks_uri")
+		if _, err := idp.provider().AuthCodeURL(ctx, "state", "nonce", GenerateCodeVerifier()); err == nil || !strings.Contains(err.Error(), "incomplete") {
+			t.Fatalf("error = %v, want incomplete metadata", err)
+		}
+	})
+
+	t.Run("provider down", func(t *testing.T) {
+		idp := newMockIdP(t)
+		p := idp.provider()
+		idp.Close()
+		if _, err := p.AuthCodeURL(ctx, "state", "nonce", GenerateCodeVerifier()); err == nil {
+			t.Fatal("expected an error from an unreachable provider")
+		}
+	})
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	idp := newMockIdP(t)
+	verifier := GenerateCodeVerifier()
+
+	authURL, err := idp.provider().AuthCodeURL(context.Background(), "the-state", "the-nonce", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := u.Scheme + "://" + u.Host + u.Path; got != idp.URL+"/authorize" {
+		t.Fatalf("authorization endpoint = %q", got)
+	}
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          testRedirectURL,
+		"scope":                 "openid profile email",
+		"state":                 "the-state",
+		"nonce":                 "the-nonce",
+		"code_challenge":        CodeChallengeS256(verifier),
+		"code_challenge_method": "S256",
+	}
+	for name, value := range want {
+		if got := u.Query().Get(name); got != value {
+			t.Errorf("%s = %q, want %q", name, got, value)
+		}
+	}
+}
+
+func TestLoginFlow(t *testing.T) {
+	ctx := context.Background()
+	idp := newMockIdP(t)
+	p := idp.provider()
+
+	verifier := GenerateCodeVerifier()
+	authURL, err := p.AuthCodeURL(ctx, "state", "nonce-1", verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, state := idp.authorize(authURL)
+	if state != "state" {
+		t.Fatalf("state = %q", state)
+	}
+
+	token, err := p.Exchange(ctx, code, verifier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := p.VerifyIDToken(ctx, token.IDToken, "nonce-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "user-1" || claims.Email != "alice@example.com" || !claims.EmailVerified {
+		t.Fatalf("unexpected claims %+v", claims)
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	ctx := context.Background()
+	idp := newMockIdP(t)
+	p := idp.provider()
+
+	authURL, err := p.AuthCodeURL(ctx, "state", "nonce", GenerateCodeVerifier())
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := idp.authorize(authURL)
+
+	// code перехвачен, но без verifier исходного клиента его не обменять
+	if _, err = p.Exchange(ctx, code, GenerateCodeVerifier()); err == nil || !strings.Contains(err.Error(), "400") {
+		t.Fatalf("error = %v, want 400 from the token endpoint", err)
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	ctx := context.Background()
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		nonce  string
+		// sign подменяет подпись токена; nil подписывает ключом провайдера
+		sign    func(idp *mockIdP, claims map[string]interface{}) string
+		wantErr error
+	}{
+		{name: "valid", nonce: "n"},
+		{name: "audience as string", claims: map[string]interface{}{"aud": testClientID}, nonce: "n"},
+		{name: "other audience", claims: map[string]interface{}{"aud": "someone-else"}, nonce: "n", wantErr: ErrInvalidIDToken},
+		{name: "other issuer", claims: map[string]interface{}{"iss": "https://evil.example.com"}, nonce: "n", wantErr: ErrInvalidIDToken},
+		{name: "expired", claims: map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()}, nonce: "n", wantErr: ErrInvalidIDToken},
+		{name: "empty subject", claims: map[string]interface{}{"sub": ""}, nonce: "n", wantErr: ErrInvalidIDToken},
+		{name: "nonce mismatch", nonce: "other", wantErr: ErrNonceMismatch},
+		{
+			name:  "foreign signature",
+			nonce: "n",
+			sign: func(idp *mockIdP, claims map[string]interface{}) string {
+				return signRS256(t, otherKey, idp.kid, claims)
+			},
+			wantErr: ErrInvalidIDToken,
+		},
+		{
+			name:  "tampered payload",
+			nonce: "n",
+			sign: func(idp *mockIdP, claims map[string]interface{}) string {
+				token := signRS256(t, idp.key, idp.kid, claims)
+				parts := strings.Split(token, ".")
+				claims["sub"] = "admin"
+				payload, _ := json.Marshal(claims)
+				return parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + parts[2]
+			},
+			wantErr: ErrInvalidIDToken,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			idp := newMockIdP(t)
+			idp.claims = tt.claims
+
+			var token string
+			if tt.sign == nil {
+				token = idp.idToken("n")
+			} else {
+				claims := map[string]interface{}{
+					"iss": idp.URL, "sub": "user-1", "aud": testClientID,
+					"exp": time.Now().Add(time.Hour).Unix(), "nonce": "n",
+				}
+				token = tt.sign(idp, claims)
+			}
+
+			_, err := idp.provider().VerifyIDToken(ctx, token, tt.nonce)
+			if tt.wantErr == nil && err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenKeyRotation(t *testing.T) {
+	ctx := context.Background()
+	idp := newMockIdP(t)
+	p := idp.provider()
+
+	if _, err := p.VerifyIDToken(ctx, idp.idToken("n"), "n"); err != nil {
+		t.Fatal(err)
+	}
+	idp.rotateKey()
+	rotated := idp.idToken("n")
+
+	// неизвестный kid сразу после загрузки JWKS не перечитывает ключи
+	if _, err := p.VerifyIDToken(ctx, rotated, "n"); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("error = %v, want ErrInvalidIDToken", err)
+	}
+	if idp.jwksHits != 1 {
+		t.Fatalf("jwks fetched %d times, want 1", idp.jwksHits)
+	}
+
+	// через минуту JWKS перечитывается и новый ключ принимается
+	p.mu.Lock()
+	p.keysFetched = time.Now().Add(-2 * time.Minute)
+	p.mu.Unlock()
+	if _, err := p.VerifyIDToken(ctx, rotated, "n"); err != nil {
+		t.Fatalf("token signed with the rotated key: %v", err)
+	}
+	if idp.jwksHits != 2 {
+		t.Fatalf("jwks fetched %d times, want 2", idp.jwksHits)
+	}
+}
@@ -0,0 +1,306 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"web-storage-service/internal/dto"
+	"web-storage-service/internal/models"
+	"web-storage-service/pkg"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var userRoles = []string{models.RoleAdmin, models.RoleUser, models.RoleReadOnly}
+
+// maxPageSize верхняя граница ?size у постраничных списков
+const maxPageSize = 100
+
+// paginationFromQuery разбирает page и size списков файлов, корзины и пользователей;
+// size больше maxPageSize уменьшается до него
+func paginationFromQuery(r *http.Request) (page, size, offset int) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	size, err = strconv.Atoi(r.URL.Query().Get("size"))
+	if err != nil || size < 1 {
+		size = 10
+	}
+	size = min(size, maxPageSize)
+
+	return page, size, (page - 1) * size
+}
+
+func pathUserID(r *http.Request) (int, bool) {
+	userID, err := strconv.Atoi(r.PathValue("id"))
+	return userID, err == nil && userID > 0
+}
+
+func (s *Server) AdminListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	page, size, offset := paginationFromQuery(r)
+
+	users, err := s.ListUsersQuery(r.Context(), dto.ListUsers{
+		Query:  r.URL.Query().Get("q"),
+		Role:   r.URL.Query().Get("role"),
+		Limit:  size,
+		Offset: offset,
+	})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(map[string]interface{}{
+		"page":    page,
+		"size":    size,
+		"users":   users,
+		"hasMore": len(users) == size,
+	})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+}
+
+func (s *Server) AdminGetUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUserID(r)
+	if !ok {
+		BadRequestError(w, r)
+		return
+	}
+
+	user, err := s.GetUserByIDQuery(r.Context(), userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		NotFoundError(w, r, "user")
+		return
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(user)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+}
+
+func (s *Server) AdminDisableUserHandler(w http.ResponseWriter, r *http.Request) {
+	s.setUserDisabled(w, r, true)
+}
+
+func (s *Server) AdminEnableUserHandler(w http.ResponseWriter, r *http.Request) {
+	s.setUserDisabled(w, r, false)
+}
+
+func (s *Server) setUserDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	ctx := r.Context()
+	userID, ok := pathUserID(r)
+	if !ok {
+		BadRequestError(w, r)
+		return
+	}
+	// Администратор не может заблокировать сам себя и остаться без доступа
+	if disabled && userID == ctx.Value(UserIDKey).(int) {
+		BadRequestError(w, r)
+		return
+	}
+
+	updated, err := s.SetUserDisabledQuery(ctx, userID, disabled)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if !updated {
+		NotFoundError(w, r, "user")
+		return
+	}
+
+	if disabled && !s.forceLogout(w, r, userID) {
+		return
+	}
+
+	status := "enabled"
+	if disabled {
+		status = "disabled"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(map[string]interface{}{"id": userID, "status": status})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+}
+
+func (s *Server) AdminSetUserRoleHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := pathUserID(r)
+	if !ok {
+		BadRequestError(w, r)
+		return
+	}
+
+	var request dto.SetUserRole
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || !slices.Contains(userRoles, request.Role) {
+		BadRequestError(w, r)
+		return
+	}
+
+	updated, err := s.SetUserRoleQuery(ctx, userID, request.Role)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if !updated {
+		NotFoundError(w, r, "user")
+		return
+	}
+
+	// JWT несут роль внутри, поэтому после смены роли их нужно перевыпустить
+	if !s.forceLogout(w, r, userID) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(map[string]interface{}{"id": userID, "role": request.Role})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+}
+
+func (s *Server) AdminResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID, ok := pathUserID(r)
+	if !ok {
+		BadRequestError(w, r)
+		return
+	}
+
+	var request dto.ResetPassword
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.Password == "" {
+		BadRequestError(w, r)
+		return
+	}
+
+	hash, err := pkg.HashPassword([]byte(request.Password))
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	updated, err := s.SetUserPasswordQuery(ctx, userID, hash)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if !updated {
+		NotFoundError(w, r, "user")
+		return
+	}
+
+	if !s.forceLogout(w, r, userID) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(map[string]interface{}{"id": userID, "status": "password reset"})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+}
+
+func (s *Server) AdminForceLogoutHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUserID(r)
+	if !ok {
+		BadRequestError(w, r)
+		return
+	}
+
+	if !s.forceLogout(w, r, userID) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(map[string]interface{}{"id": userID, "status": "logged out"})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+}
+
+// forceLogout завершает сессии и отзывает JWT пользователя; при ошибке сам отвечает клиенту
+func (s *Server) forceLogout(w http.ResponseWriter, r *http.Request, userID int) bool {
+	if err := s.ForceLogoutWithTransaction(r.Context(), userID); err != nil {
+		slog.ErrorContext(r.Context(), "error forcing logout", "target_user_id", userID, "error", err)
+		WriteError(w, r, err)
+		return false
+	}
+	s.revokeUserJWTsLocally(userID)
+	return true
+}
+
+func (s *Server) AdminListUserAssetsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUserID(r)
+	if !ok {
+		BadRequestError(w, r)
+		return
+	}
+	page, size, offset := paginationFromQuery(r)
+
+	assets, err := s.ListAssetInfoQuery(r.Context(), dto.ListAssets{
+		UserID: userID,
+		Limit:  size,
+		Offset: offset,
+		Prefix: r.URL.Query().Get("prefix"),
+	}, true)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(map[string]interface{}{
+		"page":    page,
+		"size":    size,
+		"assets":  assets,
+		"hasMore": len(assets) == size,
+	})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+}
+
+func (s *Server) AdminUserUsageHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathUserID(r)
+	if !ok {
+		BadRequestError(w, r)
+		return
+	}
+
+	usage, err := s.GetUsageQuery(r.Context(), userID)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(usage)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+}
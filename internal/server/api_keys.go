@@ -0,0 +1,121 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"web-storage-service/internal/dto"
+	"web-storage-service/internal/models"
+	"web-storage-service/pkg"
+)
+
+func (s *Server) CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := ctx.Value(UserIDKey).(int)
+	if !requireScope(w, r, ScopeKeysManage) {
+		return
+	}
+
+	var request dto.CreateAPIKey
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		BadRequestError(w, r)
+		return
+	}
+
+	request.Name = strings.TrimSpace(request.Name)
+	if request.Name == "" || len(request.Name) > 255 || len(request.Scopes) == 0 {
+		BadRequestError(w, r)
+		return
+	}
+	for _, scope := range request.Scopes {
+		if !slices.Contains(apiKeyScopes, scope) {
+			BadRequestError(w, r)
+			return
+		}
+	}
+	if request.ExpiresAt != nil && request.ExpiresAt.Before(time.Now()) {
+		BadRequestError(w, r)
+		return
+	}
+
+	id, secret := pkg.GenerateAPIKey()
+	apiKey, err := s.CreateAPIKeyQuery(ctx, models.APIKey{
+		ID:         id,
+		UID:        userID,
+		Name:       request.Name,
+		KeyHash:    pkg.HashAPIKey(secret),
+		Scopes:     request.Scopes,
+		PathPrefix: request.Prefix,
+		ExpiresAt:  request.ExpiresAt,
+	})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	// Сам ключ показываем только один раз, в базе остается лишь его хэш
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":         apiKey.ID,
+		"name":       apiKey.Name,
+		"key":        secret,
+		"scopes":     apiKey.Scopes,
+		"prefix":     apiKey.PathPrefix,
+		"expires_at": apiKey.ExpiresAt,
+		"created_at": apiKey.CreatedAt,
+	})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+}
+
+func (s *Server) ListAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := ctx.Value(UserIDKey).(int)
+	if !requireScope(w, r, ScopeKeysManage) {
+		return
+	}
+
+	keys, err := s.ListAPIKeysQuery(ctx, userID)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(map[string]interface{}{"keys": keys})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+}
+
+func (s *Server) RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := ctx.Value(UserIDKey).(int)
+	if !requireScope(w, r, ScopeKeysManage) {
+		return
+	}
+
+	revoked, err := s.RevokeAPIKeyQuery(ctx, r.PathValue("id"), userID)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if !revoked {
+		NotFoundError(w, r, "api key")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(map[string]string{"status": "revoked"})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+}
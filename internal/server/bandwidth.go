@@ -0,0 +1,235 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+	"web-storage-service/internal/config"
+	"web-storage-service/internal/models"
+)
+
+const (
+	// throttleChunk столько байт передается между ожиданиями, чтобы скорость была ровной
+	throttleChunk = 32 << 10
+	// throttleIOTimeout дедлайн на каждый кусок: медленная передача не должна упираться в ReadTimeout/WriteTimeout сервера
+	throttleIOTimeout = 30 * time.Second
+)
+
+// byteLimiter корзина байт. Передача списывает байты и при нехватке уходит в долг,
+// а ждет столько, сколько нужно на его погашение: одновременные передачи делят скорость поровну.
+type byteLimiter struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newByteLimiter(bytesPerSecond float64) *byteLimiter {
+	return &byteLimiter{rate: bytesPerSecond, burst: bytesPerSecond, tokens: bytesPerSecond, last: time.Now()}
+}
+
+// reserve списывает n байт и возвращает, сколько нужно подождать перед передачей
+func (l *byteLimiter) reserve(n int) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens = min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+	l.tokens -= float64(n)
+	if l.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-l.tokens / l.rate * float64(time.Second))
+}
+
+// bandwidthLimits общий ограничитель инстанса и ограничители пользователей с активными передачами
+type bandwidthLimits struct {
+	// global == nil, если общего ограничения нет
+	global *byteLimiter
+	// perRole байт в секунду на пользователя; роли без ограничения здесь нет
+	perRole map[string]float64
+
+	mu    sync.Mutex
+	users map[int]*userLimiter
+}
+
+type userLimiter struct {
+	limiter *byteLimiter
+	refs    int
+}
+
+func newBandwidthLimits(cfg config.BandwidthConfig) *bandwidthLimits {
+	b := &bandwidthLimits{perRole: make(map[string]float64), users: make(map[int]*userLimiter)}
+	if cfg.GlobalKBps > 0 {
+		b.global = newByteLimiter(float64(cfg.GlobalKBps) * 1024)
+	}
+	for role, kbps := range map[string]int{
+		models.RoleAdmin:    cfg.AdminKBps,
+		models.RoleUser:     cfg.UserKBps,
+		models.RoleReadOnly: cfg.ReadOnlyKBps,
+	} {
+		if kbps > 0 {
+			b.perRole[role] = float64(kbps) * 1024
+		}
+	}
+	return b
+}
+
+// acquire возвращает ограничители для передачи пользователя; release удаляет
+// ограничитель пользователя, когда у него не остается активных передач
+func (b *bandwidthLimits) acquire(userID int, role string) (limiters []*byteLimiter, release func()) {
+	if b.global != nil {
+		limiters = append(limiters, b.global)
+	}
+	rate, ok := b.perRole[role]
+	if !ok {
+		return limiters, func() {}
+	}
+
+	b.mu.Lock()
+	u, ok := b.users[userID]
+	// при смене роли начатые передачи остаются на старом ограничителе
+	if !ok || u.limiter.rate != rate {
+		u = &userLimiter{limiter: newByteLimiter(rate)}
+		b.users[userID] = u
+	}
+	u.refs++
+	b.mu.Unlock()
+
+	return append(limiters, u.limiter), func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		u.refs--
+		if u.refs <= 0 && b.users[userID] == u {
+			delete(b.users, userID)
+		}
+	}
+}
+
+// throttle ограничивает скорость одной передачи; nil означает передачу без ограничений
+type throttle struct {
+	ctx       context.Context
+	limiters  []*byteLimiter
+	rc        *http.ResponseController
+	direction string
+	metrics   *serverMetrics
+}
+
+// throttle подбирает ограничители для тела запроса или ответа пользователя из r.
+// release обязательно вызвать по окончании передачи.
+func (s *Server) throttle(w http.ResponseWriter, r *http.Request, direction string) (t *throttle, release func()) {
+	if s.bandwidth == nil {
+		return nil, func() {}
+	}
+	userID, _ := r.Context().Value(UserIDKey).(int)
+	role, _ := r.Context().Value(RoleKey).(string)
+
+	limiters, release := s.bandwidth.acquire(userID, role)
+	if len(limiters) == 0 {
+		release()
+		return nil, func() {}
+	}
+
+	s.metrics.throttledTransfers.Add(1, direction)
+	return &throttle{
+		ctx:       r.Context(),
+		limiters:  limiters,
+		rc:        http.NewResponseController(w),
+		direction: direction,
+		metrics:   s.metrics,
+	}, func() {
+		s.metrics.throttledTransfers.Add(-1, direction)
+		release()
+	}
+}
+
+// wait ждет, пока все ограничители пропустят n байт, и продлевает дедлайн соединения
+func (t *throttle) wait(n int) error {
+	var d time.Duration
+	for _, l := range t.limiters {
+		d = max(d, l.reserve(n))
+	}
+	if d > 0 {
+		t.metrics.throttleWait.Add(d.Seconds(), t.direction)
+		timer := time.NewTimer(d)
+		select {
+		case <-t.ctx.Done():
+			timer.Stop()
+			return t.ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	deadline := time.Now().Add(throttleIOTimeout)
+	if t.direction == directionUpload {
+		_ = t.rc.SetReadDeadline(deadline)
+	} else {
+		_ = t.rc.SetWriteDeadline(deadline)
+	}
+	return nil
+}
+
+const (
+	directionUpload   = "upload"
+	directionDownload = "download"
+)
+
+// Reader ограничивает чтение тела запроса
+func (t *throttle) Reader(r io.Reader) io.Reader {
+	if t == nil {
+		return r
+	}
+	return &throttledReader{r: r, t: t}
+}
+
+// Writer ограничивает запись тела ответа
+func (t *throttle) Writer(w io.Writer) io.Writer {
+	if t == nil {
+		return w
+	}
+	return &throttledWriter{w: w, t: t}
+}
+
+type throttledReader struct {
+	r io.Reader
+	t *throttle
+}
+
+func (tr *throttledReader) Read(p []byte) (int, error) {
+	if len(p) > throttleChunk {
+		p = p[:throttleChunk]
+	}
+	n, err := tr.r.Read(p)
+	if n > 0 {
+		if waitErr := tr.t.wait(n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
+
+type throttledWriter struct {
+	w io.Writer
+	t *throttle
+}
+
+func (tw *throttledWriter) Write(p []byte) (int, error) {
+	var written int
+	for len(p) > 0 {
+		chunk := p[:min(len(p), throttleChunk)]
+		if err := tw.t.wait(len(chunk)); err != nil {
+			return written, err
+		}
+		n, err := tw.w.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
@@ -0,0 +1,365 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"web-storage-service/internal/dto"
+	"web-storage-service/internal/models"
+)
+
+const (
+	// changesPollInterval ожидающие запросы перечитывают ленту хотя бы так часто,
+	// даже если уведомление потерялось, пока слушатель NOTIFY переподключался
+	changesPollInterval = 10 * time.Second
+	// changesKeepAlive комментарий в SSE-потоке, чтобы прокси не закрывали простаивающее соединение
+	changesKeepAlive = 15 * time.Second
+	// changesDefaultWait ожидание long-poll, если клиент не передал wait
+	changesDefaultWait = 30 * time.Second
+	changesDefaultSize = 100
+	changesMaxSize     = 1000
+)
+
+// changeHub будит ожидающие запросы ленты пользователя по уведомлениям NOTIFY,
+// поэтому событие с любого инстанса доходит до клиентов всех инстансов
+type changeHub struct {
+	mu   sync.Mutex
+	subs map[int]map[chan struct{}]struct{}
+
+	// done закрывается при остановке сервера, чтобы длинные запросы завершились
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newChangeHub() *changeHub {
+	return &changeHub{subs: make(map[int]map[chan struct{}]struct{}), done: make(chan struct{})}
+}
+
+// subscribe возвращает канал, в который приходит сигнал о новых событиях пользователя
+func (h *changeHub) subscribe(userID int) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+	h.mu.Lock()
+	if h.subs[userID] == nil {
+		h.subs[userID] = make(map[chan struct{}]struct{})
+	}
+	h.subs[userID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		delete(h.subs[userID], ch)
+		if len(h.subs[userID]) == 0 {
+			delete(h.subs, userID)
+		}
+	}
+}
+
+func (h *changeHub) notify(userID int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs[userID] {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// notifyAll будит всех после переподключения слушателя: уведомления за время обрыва потеряны
+func (h *changeHub) notifyAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for _, subs := range h.subs {
+		for ch := range subs {
+			select {
+			case ch <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func (h *changeHub) close() {
+	h.closeOnce.Do(func() { close(h.done) })
+}
+
+// runChangeListener держит LISTEN на канале ленты и переподключается после обрыва
+func (s *Server) runChangeListener(ctx context.Context) {
+	for {
+		err := s.db.Listen(ctx, assetEventsChannel, func(payload string) {
+			if userID, err := strconv.Atoi(payload); err == nil {
+				s.changes.notify(userID)
+			}
+		})
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Warn("change feed listener disconnected", "error", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+		s.changes.notifyAll()
+	}
+}
+
+func (s *Server) runChangesCleanup(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.DeleteOldAssetEventsQuery(ctx, time.Now().Add(-s.cfg.Changes.Retention)); err != nil {
+				slog.Error("error deleting old asset events", "error", err)
+			}
+		}
+	}
+}
+
+// changesPage ответ /api/changes: события после курсора и курсор для следующего запроса
+type changesPage struct {
+	// Cursor передается в since следующего запроса; он может быть больше seq последнего
+	// события, если остальные события не подошли под префикс
+	Cursor  int64               `json:"cursor"`
+	Events  []models.AssetEvent `json:"events"`
+	HasMore bool                `json:"hasMore"`
+}
+
+// readChanges читает страницу ленты после since. Курсор из будущего дает 400,
+// курсор, события после которого уже удалены по CHANGES_RETENTION, дает 410.
+func (s *Server) readChanges(ctx context.Context, userID int, since int64, prefix string, size int) (changesPage, error) {
+	latest, oldest, err := s.AssetEventBoundsQuery(ctx, userID)
+	if err != nil {
+		return changesPage{}, err
+	}
+	if since > latest {
+		return changesPage{}, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Detail: "cursor is ahead of the change feed"}
+	}
+	if since < oldest-1 {
+		return changesPage{}, &APIError{Status: http.StatusGone, Code: CodeCursorExpired, Detail: "events after this cursor were removed, list the assets again and continue from a fresh cursor"}
+	}
+
+	events, err := s.ListAssetEventsQuery(ctx, dto.ListAssetEvents{UserID: userID, Since: since, Until: latest, Prefix: prefix, Limit: size + 1})
+	if err != nil {
+		return changesPage{}, err
+	}
+	page := changesPage{Cursor: latest, Events: events}
+	if len(events) > size {
+		page.Events, page.HasMore = events[:size], true
+		page.Cursor = page.Events[size-1].Seq
+	}
+	return page, nil
+}
+
+// parseCursor разбирает since; пустое значение означает, что курсора нет
+func parseCursor(value string) (cursor int64, ok bool, err error) {
+	if value == "" {
+		return 0, false, nil
+	}
+	cursor, err = strconv.ParseInt(value, 10, 64)
+	if err != nil || cursor < 0 {
+		return 0, false, errors.New("invalid cursor")
+	}
+	return cursor, true, nil
+}
+
+// ChangesHandler отдает события после ?since. Если их нет, ждет до ?wait секунд
+// (по умолчанию 30, не больше CHANGES_MAX_WAIT). Без since сразу отдает текущий курсор:
+// клиент сначала читает список файлов, а затем следит за изменениями с этого курсора.
+func (s *Server) ChangesHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := ctx.Value(UserIDKey).(int)
+	if !requireScope(w, r, ScopeAssetsRead) {
+		return
+	}
+	prefix, ok := listPrefix(w, r)
+	if !ok {
+		return
+	}
+
+	since, hasSince, err := parseCursor(r.URL.Query().Get("since"))
+	if err != nil {
+		BadRequestError(w, r)
+		return
+	}
+	wait := changesDefaultWait
+	if value := r.URL.Query().Get("wait"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			BadRequestError(w, r)
+			return
+		}
+		wait = time.Duration(seconds) * time.Second
+	}
+	wait = min(wait, s.cfg.Changes.MaxWait)
+	size, err := strconv.Atoi(r.URL.Query().Get("size"))
+	if err != nil || size < 1 {
+		size = changesDefaultSize
+	}
+	size = min(size, changesMaxSize)
+
+	if !hasSince {
+		latest, _, err := s.AssetEventBoundsQuery(ctx, userID)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		writeChangesPage(w, r, changesPage{Cursor: latest, Events: []models.AssetEvent{}})
+		return
+	}
+
+	// подписка до первого чтения, чтобы не пропустить событие между чтением и ожиданием
+	notified, unsubscribe := s.changes.subscribe(userID)
+	defer unsubscribe()
+
+	deadline := time.Now().Add(wait)
+	// ожидание может быть дольше WriteTimeout сервера
+	_ = http.NewResponseController(w).SetWriteDeadline(deadline.Add(10 * time.Second))
+
+	for {
+		page, err := s.readChanges(ctx, userID, since, prefix, size)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		remaining := time.Until(deadline)
+		if len(page.Events) > 0 || remaining <= 0 {
+			writeChangesPage(w, r, page)
+			return
+		}
+		since = page.Cursor
+
+		timer := time.NewTimer(min(remaining, changesPollInterval))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-s.changes.done:
+			timer.Stop()
+			writeChangesPage(w, r, page)
+			return
+		case <-notified:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+func writeChangesPage(w http.ResponseWriter, r *http.Request, page changesPage) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(page); err != nil {
+		slog.ErrorContext(r.Context(), "error writing response", "error", err)
+	}
+}
+
+// ChangesStreamHandler отдает ленту как Server-Sent Events: id события это его seq,
+// поэтому EventSource после обрыва продолжит с Last-Event-ID. Без since и
+// Last-Event-ID поток начинается с текущего момента.
+func (s *Server) ChangesStreamHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := ctx.Value(UserIDKey).(int)
+	if !requireScope(w, r, ScopeAssetsRead) {
+		return
+	}
+	prefix, ok := listPrefix(w, r)
+	if !ok {
+		return
+	}
+
+	cursor := r.URL.Query().Get("since")
+	if lastID := r.Header.Get("Last-Event-ID"); lastID != "" {
+		cursor = lastID
+	}
+	since, hasSince, err := parseCursor(cursor)
+	if err != nil {
+		BadRequestError(w, r)
+		return
+	}
+
+	notified, unsubscribe := s.changes.subscribe(userID)
+	defer unsubscribe()
+
+	// первая страница читается до заголовков, чтобы ошибку курсора отдать обычным ответом
+	page := changesPage{Events: []models.AssetEvent{}}
+	if hasSince {
+		page, err = s.readChanges(ctx, userID, since, prefix, changesMaxSize)
+	} else {
+		page.Cursor, _, err = s.AssetEventBoundsQuery(ctx, userID)
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	rc := http.NewResponseController(w)
+	// поток живет дольше WriteTimeout сервера
+	_ = rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	// nginx иначе буферизует поток
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if _, err = fmt.Fprintf(w, "retry: %d\n\n", changesPollInterval.Milliseconds()); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(changesKeepAlive)
+	defer keepAlive.Stop()
+	poll := time.NewTicker(changesPollInterval)
+	defer poll.Stop()
+
+	for {
+		for _, event := range page.Events {
+			data, err := json.Marshal(event)
+			if err != nil {
+				slog.ErrorContext(ctx, "error encoding asset event", "error", err)
+				return
+			}
+			if _, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Seq, event.Type, data); err != nil {
+				return
+			}
+		}
+		if err = rc.Flush(); err != nil {
+			return
+		}
+		since = page.Cursor
+
+		if !page.HasMore {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s.changes.done:
+				return
+			case <-keepAlive.C:
+				if _, err = fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+					return
+				}
+				page = changesPage{Cursor: since}
+				continue
+			case <-notified:
+			case <-poll.C:
+			}
+		}
+
+		page, err = s.readChanges(ctx, userID, since, prefix, changesMaxSize)
+		if err != nil {
+			if ctx.Err() == nil {
+				slog.WarnContext(ctx, "error reading change feed", "error", err)
+			}
+			return
+		}
+	}
+}
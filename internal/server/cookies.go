@@ -0,0 +1,96 @@
+package server
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"time"
+	"web-storage-service/pkg"
+)
+
+// CSRFHeader заголовок, в котором браузерный клиент повторяет значение CSRF cookie
+const CSRFHeader = "X-CSRF-Token"
+
+// requestToken берет токен из Authorization: Bearer, а при включенных cookie-сессиях
+// и отсутствии заголовка из session cookie; fromCookie нужен для проверки CSRF
+func (s *Server) requestToken(r *http.Request) (token string, fromCookie bool, err error) {
+	token, err = pkg.ExtractBearerToken(r)
+	if err == nil || !s.cfg.Auth.CookieSessions {
+		return token, false, err
+	}
+	cookie, err := r.Cookie(s.cfg.Auth.CookieName)
+	if err != nil || cookie.Value == "" {
+		return "", false, http.ErrNoCookie
+	}
+	return cookie.Value, true, nil
+}
+
+// validCSRF проверяет X-CSRF-Token у изменяющих запросов с токеном из cookie
+func validCSRF(r *http.Request, token string) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	header := r.Header.Get(CSRFHeader)
+	return header != "" && subtle.ConstantTimeCompare([]byte(header), []byte(pkg.CSRFToken(token))) == 1
+}
+
+// cookieLoginRequested читает ?cookie=true у запросов входа; без AUTH_COOKIE_SESSIONS отвечает 400
+func (s *Server) cookieLoginRequested(w http.ResponseWriter, r *http.Request) (cookie bool, ok bool) {
+	cookie, err := queryFlag(r, "cookie")
+	if err != nil {
+		BadRequestError(w, r)
+		return false, false
+	}
+	if cookie && !s.cfg.Auth.CookieSessions {
+		WriteError(w, r, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Detail: "cookie sessions are disabled"})
+		return false, false
+	}
+	return cookie, true
+}
+
+func (s *Server) sameSite() http.SameSite {
+	switch s.cfg.Auth.CookieSameSite {
+	case "strict":
+		return http.SameSiteStrictMode
+	case "none":
+		return http.SameSiteNoneMode
+	default:
+		return http.SameSiteLaxMode
+	}
+}
+
+// setSessionCookies выдает токен в HttpOnly cookie и CSRF-токен в cookie, доступной скриптам страницы
+func (s *Server) setSessionCookies(w http.ResponseWriter, token string, ttl time.Duration) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.cfg.Auth.CookieName,
+		Value:    token,
+		Path:     "/",
+		Domain:   s.cfg.Auth.CookieDomain,
+		MaxAge:   int(ttl.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: s.sameSite(),
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     s.cfg.Auth.CookieName + "_csrf",
+		Value:    pkg.CSRFToken(token),
+		Path:     "/",
+		Domain:   s.cfg.Auth.CookieDomain,
+		MaxAge:   int(ttl.Seconds()),
+		Secure:   true,
+		SameSite: s.sameSite(),
+	})
+}
+
+func (s *Server) clearSessionCookies(w http.ResponseWriter) {
+	for _, name := range []string{s.cfg.Auth.CookieName, s.cfg.Auth.CookieName + "_csrf"} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Path:     "/",
+			Domain:   s.cfg.Auth.CookieDomain,
+			MaxAge:   -1,
+			Secure:   true,
+			SameSite: s.sameSite(),
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"web-storage-service/internal/config"
+)
+
+// corsPolicy разобранный CORSConfig; заголовки ответа собираются один раз при старте
+type corsPolicy struct {
+	anyOrigin   bool
+	origins     map[string]bool
+	patterns    []originPattern
+	anyHeader   bool
+	credentials bool
+
+	allowMethods  string
+	allowHeaders  string
+	exposeHeaders string
+	maxAge        string
+}
+
+// originPattern шаблон вида https://*.example.com: prefix и suffix вокруг звездочки
+type originPattern struct {
+	prefix, suffix string
+}
+
+func newCORSPolicy(cfg config.CORSConfig) *corsPolicy {
+	p := &corsPolicy{
+		origins:       make(map[string]bool),
+		anyHeader:     slices.Contains(cfg.AllowedHeaders, "*"),
+		credentials:   cfg.AllowCredentials,
+		allowMethods:  strings.Join(cfg.AllowedMethods, ", "),
+		allowHeaders:  strings.Join(cfg.AllowedHeaders, ", "),
+		exposeHeaders: strings.Join(cfg.ExposedHeaders, ", "),
+		maxAge:        strconv.Itoa(int(cfg.MaxAge.Seconds())),
+	}
+	for _, origin := range cfg.AllowedOrigins {
+		origin = strings.ToLower(strings.TrimSuffix(origin, "/"))
+		switch {
+		case origin == "*":
+			p.anyOrigin = true
+		case strings.Contains(origin, "*"):
+			prefix, suffix, _ := strings.Cut(origin, "*")
+			p.patterns = append(p.patterns, originPattern{prefix, suffix})
+		default:
+			p.origins[origin] = true
+		}
+	}
+	return p
+}
+
+func (p *corsPolicy) allowed(origin string) bool {
+	origin = strings.ToLower(origin)
+	if p.anyOrigin || p.origins[origin] {
+		return true
+	}
+	for _, pattern := range p.patterns {
+		// звездочка заменяет непустую часть имени хоста, но не схему, порт или путь
+		if len(origin) > len(pattern.prefix)+len(pattern.suffix) &&
+			strings.HasPrefix(origin, pattern.prefix) && strings.HasSuffix(origin, pattern.suffix) &&
+			!strings.ContainsAny(origin[len(pattern.prefix):len(origin)-len(pattern.suffix)], "/:") {
+			return true
+		}
+	}
+	return false
+}
+
+// CORSMiddleware применяет политику CORS_* ко всем маршрутам и сам отвечает на preflight,
+// не доходя до маршрутизатора. При пустом CORS_ALLOWED_ORIGINS ничего не делает.
+func (s *Server) CORSMiddleware(next http.Handler) http.Handler {
+	if len(s.cfg.CORS.AllowedOrigins) == 0 {
+		return next
+	}
+	p := newCORSPolicy(s.cfg.CORS)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		// ответ зависит от Origin, даже если origin не разрешен: кэши не должны смешивать варианты
+		h.Add("Vary", "Origin")
+
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if preflight {
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		if origin == "" || !p.allowed(origin) {
+			if preflight {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if p.anyOrigin && !p.credentials {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if p.credentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if p.exposeHeaders != "" {
+				h.Set("Access-Control-Expose-Headers", p.exposeHeaders)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h.Set("Access-Control-Allow-Methods", p.allowMethods)
+		if p.anyHeader {
+			// * в Allow-Headers не работает вместе с credentials, поэтому запрошенные заголовки отражаются
+			if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+				h.Set("Access-Control-Allow-Headers", requested)
+			}
+		} else if p.allowHeaders != "" {
+			h.Set("Access-Control-Allow-Headers", p.allowHeaders)
+		}
+		h.Set("Access-Control-Max-Age", p.maxAge)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
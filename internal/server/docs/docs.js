@@ -0,0 +1,190 @@
+'use strict';
+
+// Документация строится из /openapi.json: по каждому маршруту параметры, схемы
+// и форма "Try it", которая отправляет запрос в этот же сервис.
+(function () {
+  const $ = (id) => document.getElementById(id);
+  let spec;
+
+  $('token').value = sessionStorage.getItem('wss_docs_token') || '';
+  $('token').addEventListener('change', (ev) => sessionStorage.setItem('wss_docs_token', ev.target.value));
+
+  function el(tag, props, ...children) {
+    const node = document.createElement(tag);
+    Object.assign(node, props || {});
+    for (const child of children) {
+      if (child !== null && child !== undefined) node.append(child);
+    }
+    return node;
+  }
+
+  function resolve(schema) {
+    if (schema && schema.$ref) return spec.components.schemas[schema.$ref.split('/').pop()];
+    return schema || {};
+  }
+
+  // example строит пример значения по схеме, чтобы было с чего начать запрос
+  function example(schema, depth) {
+    schema = resolve(schema);
+    if (depth > 5) return null;
+    if (schema.oneOf) return example(schema.oneOf[0], depth + 1);
+    const type = Array.isArray(schema.type) ? schema.type[0] : schema.type;
+    switch (type) {
+      case 'object': {
+        if (!schema.properties) return {};
+        const obj = {};
+        for (const [name, prop] of Object.entries(schema.properties)) obj[name] = example(prop, depth + 1);
+        return obj;
+      }
+      case 'array': return [example(schema.items, depth + 1)];
+      case 'integer': case 'number': return 0;
+      case 'boolean': return false;
+      case 'string': return schema.format === 'date-time' ? new Date(0).toISOString() : 'string';
+      default: return null;
+    }
+  }
+
+  const pretty = (value) => JSON.stringify(value, null, 2);
+
+  function describeContent(content) {
+    const blocks = [];
+    for (const [mediaType, media] of Object.entries(content || {})) {
+      const schema = media.schema || {};
+      const variants = schema.oneOf || [schema];
+      for (const variant of variants) {
+        const ref = variant.$ref ? ' (' + variant.$ref.split('/').pop() + ')' : '';
+        const text = mediaType.endsWith('json') ? pretty(example(variant, 0)) : '<' + mediaType + '>';
+        blocks.push(el('div', null, el('code', { textContent: mediaType + ref }), el('pre', { textContent: text })));
+      }
+    }
+    return blocks;
+  }
+
+  function readCookie(name) {
+    for (const part of document.cookie.split(';')) {
+      const [key, ...rest] = part.trim().split('=');
+      if (key === name) return decodeURIComponent(rest.join('='));
+    }
+    return '';
+  }
+
+  function renderOperation(method, path, op) {
+    const params = op.parameters || [];
+    const inputs = {};
+    const paramRows = params.map((p) => {
+      inputs[p.name] = el('input', { placeholder: p.schema.type });
+      return el('tr', null,
+        el('td', null, el('code', { textContent: p.name }), p.required ? ' *' : ''),
+        el('td', { textContent: p.in }),
+        el('td', { textContent: p.description || '' }),
+        el('td', null, inputs[p.name]));
+    });
+
+    const body = el('div', { className: 'body' });
+    if (op.description) body.append(el('p', { textContent: op.description }));
+    if (op.security) body.append(el('p', { className: 'lock', textContent: 'Requires authentication.' }));
+    if (paramRows.length) {
+      body.append(el('h4', { textContent: 'Parameters' }),
+        el('table', null, el('tbody', null, ...paramRows)));
+    }
+
+    let bodyInput = null;
+    if (op.requestBody) {
+      const content = op.requestBody.content;
+      body.append(el('h4', { textContent: 'Request body' }));
+      if (content['application/json']) {
+        bodyInput = el('textarea', { value: pretty(example(content['application/json'].schema, 0)) });
+      } else {
+        bodyInput = el('input', { type: 'file' });
+      }
+      body.append(bodyInput);
+    }
+
+    body.append(el('h4', { textContent: 'Responses' }));
+    for (const [code, response] of Object.entries(op.responses)) {
+      const resolved = response.$ref ? spec.components.responses[response.$ref.split('/').pop()] : response;
+      body.append(el('div', null, el('strong', { textContent: code + ' ' }), resolved.description || ''));
+      if (code !== 'default' && !response.$ref) body.append(...describeContent(resolved.content));
+    }
+
+    const result = el('pre', { hidden: true });
+    const send = el('button', { type: 'button', textContent: 'Try it' });
+    send.addEventListener('click', async () => {
+      let url = path;
+      const query = new URLSearchParams();
+      for (const p of params) {
+        const value = inputs[p.name].value;
+        if (p.in === 'path') url = url.replace('{' + p.name + '}', encodeURIComponent(value));
+        else if (value !== '') query.set(p.name, value);
+      }
+      if ([...query].length) url += '?' + query;
+
+      const headers = {};
+      const token = $('token').value.trim();
+      if (token) {
+        headers.Authorization = 'Bearer ' + token;
+      } else {
+        const cookieAuth = spec.components.securitySchemes.cookieAuth;
+        const csrf = cookieAuth && readCookie(cookieAuth.name + '_csrf');
+        if (csrf) headers['X-CSRF-Token'] = csrf;
+      }
+      let requestBody;
+      if (bodyInput && bodyInput.type === 'file') {
+        requestBody = bodyInput.files[0];
+      } else if (bodyInput) {
+        headers['Content-Type'] = 'application/json';
+        requestBody = bodyInput.value;
+      }
+
+      result.hidden = false;
+      result.textContent = method.toUpperCase() + ' ' + url + ' …';
+      try {
+        const resp = await fetch(url, { method: method.toUpperCase(), headers, body: requestBody, credentials: 'same-origin' });
+        const type = resp.headers.get('Content-Type') || '';
+        let text;
+        if (type.includes('json')) {
+          const raw = await resp.text();
+          try { text = pretty(JSON.parse(raw)); } catch (e) { text = raw; }
+        } else if (type.startsWith('text/')) {
+          text = (await resp.text()).slice(0, 20000);
+        } else {
+          text = '<' + (await resp.blob()).size + ' bytes of ' + (type || 'data') + '>';
+        }
+        result.textContent = resp.status + ' ' + resp.statusText + '\n' + type + '\n\n' + text;
+      } catch (err) {
+        result.textContent = String(err);
+      }
+    });
+    body.append(el('h4', { textContent: 'Try it' }), send, result);
+
+    return el('details', null,
+      el('summary', null,
+        el('span', { className: 'method ' + method, textContent: method.toUpperCase() }),
+        el('span', { className: 'path', textContent: path }),
+        el('span', { className: 'summary', textContent: op.summary || '' })),
+      body);
+  }
+
+  function render() {
+    $('title').textContent = spec.info.title + ' ' + spec.info.version;
+    $('description').textContent = spec.info.description || '';
+
+    const byTag = new Map();
+    for (const [path, methods] of Object.entries(spec.paths).sort()) {
+      for (const [method, op] of Object.entries(methods)) {
+        const tag = (op.tags && op.tags[0]) || 'other';
+        if (!byTag.has(tag)) byTag.set(tag, []);
+        byTag.get(tag).push(renderOperation(method, path, op));
+      }
+    }
+
+    const root = $('operations');
+    root.replaceChildren();
+    for (const [tag, ops] of byTag) root.append(el('h2', { textContent: tag }), ...ops);
+  }
+
+  fetch('/openapi.json')
+    .then((resp) => resp.json())
+    .then((doc) => { spec = doc; render(); })
+    .catch((err) => { $('operations').textContent = 'Cannot load /openapi.json: ' + err; });
+})();
@@ -2,37 +2,175 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ProblemContentType тип ответа с ошибкой по RFC 9457
+const ProblemContentType = "application/problem+json"
+
+// ErrorCode стабильный машиночитаемый код ошибки, клиенты сравнивают по нему, а не по тексту
+type ErrorCode string
+
+const (
+	CodeInternal            ErrorCode = "internal_error"
+	CodeInvalidRequest      ErrorCode = "invalid_request"
+	CodeUnauthorized        ErrorCode = "unauthorized"
+	CodeInvalidCredentials  ErrorCode = "invalid_credentials"
+	CodeInvalidToken        ErrorCode = "invalid_token"
+	CodeInvalidChallenge    ErrorCode = "invalid_challenge"
+	CodeInvalidSecondFactor ErrorCode = "invalid_second_factor"
+	CodeOIDCLoginFailed     ErrorCode = "oidc_login_failed"
+	CodeForbidden           ErrorCode = "forbidden"
+	CodeInsufficientScope   ErrorCode = "insufficient_scope"
+	CodeUserDisabled        ErrorCode = "user_disabled"
+	CodeNotFound            ErrorCode = "not_found"
+	CodeConflict            ErrorCode = "conflict"
+	CodeAssetExists         ErrorCode = "asset_exists"
+	CodeTOTPAlreadyEnabled  ErrorCode = "totp_already_enabled"
+	CodeValidationFailed    ErrorCode = "validation_failed"
+	CodeLoginLocked         ErrorCode = "login_locked"
+	CodeRateLimited         ErrorCode = "rate_limited"
+	CodeCSRFFailed          ErrorCode = "csrf_failed"
+	CodeCursorExpired       ErrorCode = "cursor_expired"
+)
+
+// коды ошибок PostgreSQL, которые отдаются клиенту как 4xx
+const (
+	pgUniqueViolation     = "23505"
+	pgForeignKeyViolation = "23503"
+	pgNotNullViolation    = "23502"
+	pgCheckViolation      = "23514"
 )
 
-func InternalServerError(w http.ResponseWriter) {
-	w.WriteHeader(http.StatusNotFound)
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]string{"error": "Internal server error"})
-	http.Error(w, "Internal server error", http.StatusInternalServerError)
+// APIError ошибка, которую обработчик отдает клиенту
+type APIError struct {
+	Status int
+	Code   ErrorCode
+	Detail string
+	// RetryAfter выставляет заголовок Retry-After, если не ноль
+	RetryAfter time.Duration
+	// Err причина: пишется в лог, клиенту не отдается
+	Err error
+}
+
+func (e *APIError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Code, e.Detail, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Detail)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.Err
+}
+
+// problem тело ответа application/problem+json; code и request_id расширения RFC 9457
+type problem struct {
+	Type      string    `json:"type"`
+	Title     string    `json:"title"`
+	Status    int       `json:"status"`
+	Detail    string    `json:"detail,omitempty"`
+	Instance  string    `json:"instance,omitempty"`
+	Code      ErrorCode `json:"code"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+// WriteError отвечает клиенту ошибкой err. *APIError отдается как есть, ошибки pgx
+// переводятся в 404/409/422, все остальное становится 500 с записью причины в лог.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	apiErr := toAPIError(err)
+
+	if apiErr.Status >= http.StatusInternalServerError {
+		// клиенту причина не раскрывается, в лог она попадает вместе с request_id
+		slog.ErrorContext(r.Context(), "internal server error", "error", err, "method", r.Method, "path", r.URL.Path)
+		span := trace.SpanFromContext(r.Context())
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	if apiErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(apiErr.RetryAfter.Seconds()))))
+	}
+	requestID, _ := r.Context().Value(RequestIDKey).(string)
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(apiErr.Status)
+	_ = json.NewEncoder(w).Encode(problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(apiErr.Status),
+		Status:    apiErr.Status,
+		Detail:    apiErr.Detail,
+		Instance:  r.URL.Path,
+		Code:      apiErr.Code,
+		RequestID: requestID,
+	})
+}
+
+func toAPIError(err error) *APIError {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr
+	}
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return &APIError{Status: http.StatusNotFound, Code: CodeNotFound, Detail: "resource not found", Err: err}
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case pgUniqueViolation:
+			return &APIError{Status: http.StatusConflict, Code: CodeConflict, Detail: "resource already exists", Err: err}
+		case pgForeignKeyViolation:
+			return &APIError{Status: http.StatusUnprocessableEntity, Code: CodeValidationFailed, Detail: "referenced resource does not exist", Err: err}
+		case pgNotNullViolation, pgCheckViolation:
+			return &APIError{Status: http.StatusUnprocessableEntity, Code: CodeValidationFailed, Detail: "value violates a constraint", Err: err}
+		}
+	}
+
+	return &APIError{Status: http.StatusInternalServerError, Code: CodeInternal, Detail: "internal server error", Err: err}
+}
+
+// isUniqueViolation сообщает, что запрос нарушил уникальный ключ
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation
+}
+
+func InternalServerError(w http.ResponseWriter, r *http.Request, err error) {
+	WriteError(w, r, &APIError{Status: http.StatusInternalServerError, Code: CodeInternal, Detail: "internal server error", Err: err})
+}
+
+func NotFoundError(w http.ResponseWriter, r *http.Request, item string) {
+	WriteError(w, r, &APIError{Status: http.StatusNotFound, Code: CodeNotFound, Detail: item + " not found"})
+}
+
+func BadRequestError(w http.ResponseWriter, r *http.Request) {
+	WriteError(w, r, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Detail: "invalid request payload"})
 }
 
-func NotFoundError(w http.ResponseWriter, item string) {
-	w.WriteHeader(http.StatusNotFound)
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]string{"error": item + " not found"})
-	return
+func UnauthorizedError(w http.ResponseWriter, r *http.Request, code ErrorCode, msg string) {
+	WriteError(w, r, &APIError{Status: http.StatusUnauthorized, Code: code, Detail: msg})
 }
 
-func BadRequestError(w http.ResponseWriter) {
-	w.WriteHeader(http.StatusBadRequest)
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid request payload"})
+func ForbiddenError(w http.ResponseWriter, r *http.Request, code ErrorCode, msg string) {
+	WriteError(w, r, &APIError{Status: http.StatusForbidden, Code: code, Detail: msg})
 }
 
-func UnauthorizedError(w http.ResponseWriter, msg string) {
-	w.WriteHeader(http.StatusUnauthorized)
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]string{"error": msg})
+func ConflictError(w http.ResponseWriter, r *http.Request, code ErrorCode, msg string) {
+	WriteError(w, r, &APIError{Status: http.StatusConflict, Code: code, Detail: msg})
 }
 
-func ForbiddenError(w http.ResponseWriter) {
-	w.WriteHeader(http.StatusForbidden)
-	w.Header().Set("Content-Type", "application/json")
-	_ = json.NewEncoder(w).Encode(map[string]string{"error": "forbidden"})
+func TooManyRequestsError(w http.ResponseWriter, r *http.Request, code ErrorCode, retryAfter time.Duration) {
+	WriteError(w, r, &APIError{Status: http.StatusTooManyRequests, Code: code, Detail: "too many requests", RetryAfter: retryAfter})
 }
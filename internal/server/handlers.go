@@ -2,15 +2,22 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
-	"log"
+	"log/slog"
+	"mime"
 	"net/http"
+	"net/url"
+	"path"
 	"strconv"
 	"strings"
 	"time"
 	"web-storage-service/internal/dto"
+	"web-storage-service/internal/models"
 	"web-storage-service/pkg"
 
+	"github.com/jackc/pgx/v5"
 	_ "github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -18,64 +25,216 @@ func (s *Server) AuthHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	var credentials = dto.Credentials{}
 
+	cookie, ok := s.cookieLoginRequested(w, r)
+	if !ok {
+		return
+	}
+
 	err := json.NewDecoder(r.Body).Decode(&credentials)
 	if err != nil {
-		BadRequestError(w)
+		BadRequestError(w, r)
+		return
+	}
+
+	if !s.checkLoginLock(w, r, credentials.Login) {
 		return
 	}
 
 	user, err := s.GetUserByLogin(ctx, credentials)
 	if err != nil || !pkg.ValidatePassword(credentials.Password, user.PasswordHash) {
-		UnauthorizedError(w, "invalid login/password")
+		s.registerLoginFailure(ctx, credentials.Login, pkg.ClientIP(r))
+		s.authFailure(authFailureCredentials)
+		UnauthorizedError(w, r, CodeInvalidCredentials, "invalid login/password")
+		return
+	}
+
+	if user.Disabled {
+		s.authFailure(authFailureUserDisabled)
+		ForbiddenError(w, r, CodeUserDisabled, "user is disabled")
+		return
+	}
+
+	// При включенной 2FA сессию создаем только после проверки кода, и счетчик
+	// неудач сбрасывается тоже только после нее: иначе каждый новый challenge
+	// давал бы еще loginChallengeMaxAttempts попыток подбора кода
+	if user.TOTPEnabled {
+		s.startTwoFactorLogin(w, r, user)
+		return
+	}
+
+	s.registerLoginSuccess(ctx, credentials.Login)
+	s.respondWithToken(w, r, user, cookie)
+}
+
+// respondWithToken завершает любой успешный вход: проверяет, не заблокирован ли
+// пользователь, и отдает ему токен. При cookie токен уходит в HttpOnly cookie,
+// а в теле ответа остается только CSRF-токен.
+func (s *Server) respondWithToken(w http.ResponseWriter, r *http.Request, user models.User, cookie bool) {
+	if user.Disabled {
+		s.authFailure(authFailureUserDisabled)
+		ForbiddenError(w, r, CodeUserDisabled, "user is disabled")
+		return
+	}
+
+	token, ttl, err := s.issueToken(r, user)
+	if err != nil {
+		InternalServerError(w, r, fmt.Errorf("creating new session: %w", err))
+		return
+	}
+
+	response := map[string]interface{}{"token": token}
+	if s.jwt != nil {
+		response["token_type"] = "Bearer"
+		response["expires_in"] = int64(ttl.Seconds())
+	}
+	if cookie {
+		s.setSessionCookies(w, token, ttl)
+		response = map[string]interface{}{
+			"csrf_token": pkg.CSRFToken(token),
+			"expires_in": int64(ttl.Seconds()),
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	// токен в теле ответа не должен попасть в кэш прокси
+	w.Header().Set("Cache-Control", "no-store")
+	err = json.NewEncoder(w).Encode(response)
+	if err != nil {
+		WriteError(w, r, err)
 		return
 	}
+}
 
-	token := pkg.GenerateToken(user.Login)
-	err = s.CreateNewSessionWithTransaction(ctx, dto.CreateNewSession{
+// sessionTTL срок жизни токена сессии в режиме AUTH_MODE=session
+const sessionTTL = 24 * time.Hour
+
+// issueToken выдает JWT в режиме AUTH_MODE=jwt и токен сессии в остальных случаях
+func (s *Server) issueToken(r *http.Request, user models.User) (token string, ttl time.Duration, err error) {
+	if s.jwt != nil {
+		token, claims, err := s.IssueJWT(user, strings.Join(roleScopes(user.Role), " "))
+		if err != nil {
+			return "", 0, err
+		}
+		return token, time.Duration(claims.ExpiresAt-claims.IssuedAt) * time.Second, nil
+	}
+
+	token = pkg.GenerateToken(user.Login)
+	err = s.CreateNewSessionWithTransaction(r.Context(), dto.CreateNewSession{
 		Token:     token,
 		UserID:    user.ID,
-		ExpiresAt: time.Now().Add(24 * time.Hour),
-		IPAddress: strings.Split(r.RemoteAddr, ":")[0],
+		ExpiresAt: time.Now().Add(sessionTTL),
+		IPAddress: pkg.ClientIP(r),
 	})
 	if err != nil {
-		log.Printf("error creating new session: %v", err)
+		return "", 0, err
+	}
+	return token, sessionTTL, nil
+}
+
+func (s *Server) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := ctx.Value(UserIDKey).(int)
+	token, fromCookie, _ := s.requestToken(r)
+
+	var err error
+	if s.jwt != nil && pkg.LooksLikeJWT(token) {
+		var claims pkg.JWTClaims
+		claims, err = s.VerifyJWT(ctx, token)
+		if err == nil {
+			err = s.RevokeJWT(ctx, claims, userID)
+		}
+	} else {
+		err = s.DeactivateSessionQuery(ctx, token)
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if fromCookie {
+		s.clearSessionCookies(w)
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(map[string]string{"token": token})
+	err = json.NewEncoder(w).Encode(map[string]string{"status": "logged out"})
 	if err != nil {
-		InternalServerError(w)
+		WriteError(w, r, err)
 		return
 	}
 }
 
-func (s *Server) ListAssetsHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
-	userID := ctx.Value(UserIDKey).(int)
+func (s *Server) JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	if s.jwt == nil {
+		NotFoundError(w, r, "jwks")
+		return
+	}
 
-	// Получение параметров пагинации
-	pageStr := r.URL.Query().Get("page")
-	sizeStr := r.URL.Query().Get("size")
+	s.jwt.mu.RLock()
+	jwks := s.jwt.jwks
+	s.jwt.mu.RUnlock()
 
-	page, err := strconv.Atoi(pageStr)
-	if err != nil || page < 1 {
-		page = 1
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	err := json.NewEncoder(w).Encode(jwks)
+	if err != nil {
+		WriteError(w, r, err)
+		return
 	}
+}
 
-	size, err := strconv.Atoi(sizeStr)
-	if err != nil || size < 1 {
-		size = 10
+// listPrefix параметр ?prefix, суженный до префикса API-ключа:
+// API-ключ с префиксом видит только файлы под этим префиксом
+func listPrefix(w http.ResponseWriter, r *http.Request) (string, bool) {
+	prefix := r.URL.Query().Get("prefix")
+	keyPrefix, _ := r.Context().Value(AssetPrefixKey).(string)
+	if !strings.HasPrefix(prefix, keyPrefix) {
+		if !strings.HasPrefix(keyPrefix, prefix) {
+			ForbiddenError(w, r, CodeForbidden, "prefix is outside of the api key prefix")
+			return "", false
+		}
+		prefix = keyPrefix
 	}
+	return prefix, true
+}
 
-	offset := (page - 1) * size
+func (s *Server) ListAssetsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := ctx.Value(UserIDKey).(int)
+	if !requireScope(w, r, ScopeAssetsRead) {
+		return
+	}
 
-	rows, err := s.ListAssetsQuery(ctx, dto.ListAssets{
+	prefix, ok := listPrefix(w, r)
+	if !ok {
+		return
+	}
+
+	page, size, offset := paginationFromQuery(r)
+	list := dto.ListAssets{
 		UserID: userID,
 		Offset: offset,
 		Limit:  size,
-	})
+		Prefix: prefix,
+	}
+
+	// ?details=true отдает метаданные вместо содержимого, этим пользуется веб-интерфейс
+	details, err := queryFlag(r, "details")
+	if err != nil {
+		BadRequestError(w, r)
+		return
+	}
+	if details {
+		infos, err := s.ListAssetInfoQuery(ctx, list, false)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		writeAssetPage(w, r, page, size, infos)
+		return
+	}
+
+	rows, err := s.ListAssetsQuery(ctx, list)
 	if err != nil {
-		InternalServerError(w)
+		WriteError(w, r, err)
 		return
 	}
 	defer rows.Close()
@@ -85,7 +244,7 @@ func (s *Server) ListAssetsHandler(w http.ResponseWriter, r *http.Request) {
 		var name string
 		var data []byte
 		if err = rows.Scan(&name, &data); err != nil {
-			InternalServerError(w)
+			WriteError(w, r, err)
 			return
 		}
 		assets[name] = pkg.TrimData(data)
@@ -102,102 +261,207 @@ func (s *Server) ListAssetsHandler(w http.ResponseWriter, r *http.Request) {
 
 	err = json.NewEncoder(w).Encode(response)
 	if err != nil {
-		InternalServerError(w)
+		WriteError(w, r, err)
 		return
 	}
 }
 
+// writeAssetPage отдает страницу метаданных в том же конверте, что и список файлов
+func writeAssetPage(w http.ResponseWriter, r *http.Request, page, size int, assets []models.AssetInfo) {
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"page":    page,
+		"size":    size,
+		"assets":  assets,
+		"hasMore": len(assets) == size,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error writing response", "error", err)
+	}
+}
+
+// DownloadAssetHandler отдает файл в JSON; с ?raw=true отдает содержимое как есть для сохранения на диск
 func (s *Server) DownloadAssetHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	userID := ctx.Value(UserIDKey).(int)
 	name := r.PathValue("name")
-	if name == "" {
-		BadRequestError(w)
+	if !requireScope(w, r, ScopeAssetsRead) || !requireAssetAccess(w, r, name) {
+		return
+	}
+	raw, err := queryFlag(r, "raw")
+	if name == "" || err != nil {
+		BadRequestError(w, r)
 		return
 	}
 
 	data, err := s.GetAssetByNameQuery(ctx, dto.GetAssetByName{UserID: userID, Name: name})
+	if errors.Is(err, pgx.ErrNoRows) {
+		NotFoundError(w, r, "asset")
+		return
+	}
 	if err != nil {
-		NotFoundError(w, "asset")
+		WriteError(w, r, err)
+		return
+	}
+
+	s.metrics.downloadBytes.Add(float64(len(data)))
+	if raw {
+		s.writeAssetContent(w, r, name, data)
 		return
 	}
 
 	assets := make(map[string]string)
 	assets[name] = pkg.TrimData(data)
 	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(assets)
-	if err != nil {
-		InternalServerError(w)
-		return
+
+	throttle, release := s.throttle(w, r, directionDownload)
+	defer release()
+	// ответ уже начат, об ошибке остается только записать в лог
+	if err = json.NewEncoder(throttle.Writer(w)).Encode(assets); err != nil {
+		slog.WarnContext(ctx, "error sending asset", "error", err)
 	}
 }
 
+// UploadAssetHandler создает файл: 201 и метаданные, 409 если файл уже есть.
+// С ?overwrite=true существующий файл заменяется и ответ 200.
 func (s *Server) UploadAssetHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	userID := ctx.Value(UserIDKey).(int)
 	name := r.PathValue("name")
-	data, err := io.ReadAll(r.Body)
+	if !requireScope(w, r, ScopeAssetsWrite) || !requireAssetAccess(w, r, name) {
+		return
+	}
+	overwrite, err := queryFlag(r, "overwrite")
 	if err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		BadRequestError(w, r)
 		return
 	}
-
-	err = s.UploadAssetQuery(ctx, name, userID, data)
+	throttle, release := s.throttle(w, r, directionUpload)
+	data, err := io.ReadAll(throttle.Reader(r.Body))
+	release()
 	if err != nil {
-		InternalServerError(w)
+		BadRequestError(w, r)
 		return
 	}
+	s.metrics.uploadBytes.Add(float64(len(data)))
 
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	asset, created, err := s.UploadAssetWithTransaction(ctx, dto.PutAsset{Name: name, UserID: userID, Data: data, Overwrite: overwrite})
+	if errors.Is(err, pgx.ErrNoRows) {
+		ConflictError(w, r, CodeAssetExists, "asset already exists, use ?overwrite=true to replace it")
+		return
+	}
 	if err != nil {
-		InternalServerError(w)
+		WriteError(w, r, err)
 		return
 	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeAssetInfo(w, r, status, asset)
 }
 
+// UpdateAssetHandler заменяет содержимое файла: 404 если его нет,
+// с ?upsert=true отсутствующий файл создается (201)
 func (s *Server) UpdateAssetHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	userID := ctx.Value(UserIDKey).(int)
 	name := r.PathValue("name")
-	data, err := io.ReadAll(r.Body)
+	if !requireScope(w, r, ScopeAssetsWrite) || !requireAssetAccess(w, r, name) {
+		return
+	}
+	upsert, err := queryFlag(r, "upsert")
 	if err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		BadRequestError(w, r)
 		return
 	}
-
-	err = s.UpdateAssetQuery(ctx, name, userID, data)
+	throttle, release := s.throttle(w, r, directionUpload)
+	data, err := io.ReadAll(throttle.Reader(r.Body))
+	release()
 	if err != nil {
-		InternalServerError(w)
+		BadRequestError(w, r)
 		return
 	}
+	s.metrics.uploadBytes.Add(float64(len(data)))
 
-	w.Header().Set("Content-Type", "application/json")
-	err = json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+	put := dto.PutAsset{Name: name, UserID: userID, Data: data, Overwrite: true}
+	if upsert {
+		asset, created, err := s.UploadAssetWithTransaction(ctx, put)
+		if err != nil {
+			WriteError(w, r, err)
+			return
+		}
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+		}
+		writeAssetInfo(w, r, status, asset)
+		return
+	}
+
+	asset, err := s.UpdateAssetWithTransaction(ctx, put)
+	if errors.Is(err, pgx.ErrNoRows) {
+		NotFoundError(w, r, "asset")
+		return
+	}
 	if err != nil {
-		InternalServerError(w)
+		WriteError(w, r, err)
 		return
 	}
+	writeAssetInfo(w, r, http.StatusOK, asset)
+}
+
+// writeAssetInfo отдает метаданные файла с ETag; для 201 добавляет Location
+func writeAssetInfo(w http.ResponseWriter, r *http.Request, status int, asset models.AssetInfo) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", strconv.Quote(asset.SHA256))
+	if status == http.StatusCreated {
+		w.Header().Set("Location", "/api/asset/"+url.PathEscape(asset.Name))
+	}
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(asset); err != nil {
+		slog.ErrorContext(r.Context(), "error writing response", "error", err)
+	}
+}
+
+// queryFlag читает булев параметр запроса; ?name без значения означает true
+func queryFlag(r *http.Request, name string) (bool, error) {
+	values, ok := r.URL.Query()[name]
+	if !ok {
+		return false, nil
+	}
+	if values[0] == "" {
+		return true, nil
+	}
+	return strconv.ParseBool(values[0])
 }
 
 func (s *Server) SoftDeleteAssetHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	userID := ctx.Value(UserIDKey).(int)
 	name := r.PathValue("name")
+	if !requireScope(w, r, ScopeAssetsDelete) || !requireAssetAccess(w, r, name) {
+		return
+	}
 
-	err := s.SoftDeleteAssetQuery(ctx, dto.DeleteAsset{
+	deleted, err := s.SoftDeleteAssetWithTransaction(ctx, dto.DeleteAsset{
 		Name:   name,
 		UserID: userID,
 	})
 	if err != nil {
-		InternalServerError(w)
+		WriteError(w, r, err)
+		return
+	}
+	if !deleted {
+		NotFoundError(w, r, "asset")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(map[string]string{strconv.Itoa(userID): name, "status": "soft deleted"})
 	if err != nil {
-		InternalServerError(w)
+		WriteError(w, r, err)
 		return
 	}
 }
@@ -206,29 +470,161 @@ func (s *Server) HardDeleteAssetHandler(w http.ResponseWriter, r *http.Request)
 	ctx := r.Context()
 	userID := ctx.Value(UserIDKey).(int)
 	name := r.PathValue("name")
+	if !requireScope(w, r, ScopeAssetsDelete) || !requireAssetAccess(w, r, name) {
+		return
+	}
 
-	err := s.HardDeleteAssetQuery(ctx, dto.DeleteAsset{
+	deleted, err := s.HardDeleteAssetWithTransaction(ctx, dto.DeleteAsset{
 		Name:   name,
 		UserID: userID,
 	})
 	if err != nil {
-		InternalServerError(w)
+		WriteError(w, r, err)
+		return
+	}
+	if !deleted {
+		NotFoundError(w, r, "asset")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	err = json.NewEncoder(w).Encode(map[string]string{strconv.Itoa(userID): name, "status": "hard deleted"})
 	if err != nil {
-		InternalServerError(w)
+		WriteError(w, r, err)
 		return
 	}
 }
-func (s *Server) HealthHandler(w http.ResponseWriter, r *http.Request) {
-	jsonResp, err := json.Marshal(s.db.Health())
 
+// writeAssetContent отдает содержимое файла вложением. Тип всегда octet-stream,
+// чтобы загруженный HTML не исполнялся в origin сервиса.
+func (s *Server) writeAssetContent(w http.ResponseWriter, r *http.Request, name string, data []byte) {
+	h := w.Header()
+	h.Set("Content-Type", "application/octet-stream")
+	h.Set("Content-Length", strconv.Itoa(len(data)))
+	h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": path.Base(name)}))
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("Content-Security-Policy", "sandbox")
+
+	throttle, release := s.throttle(w, r, directionDownload)
+	defer release()
+	if _, err := throttle.Writer(w).Write(data); err != nil {
+		slog.WarnContext(r.Context(), "error sending asset", "error", err)
+	}
+}
+
+// RenameAssetHandler переименовывает файл: 404 если его нет, 409 если новое имя занято
+func (s *Server) RenameAssetHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := ctx.Value(UserIDKey).(int)
+	request := dto.RenameAsset{Name: r.PathValue("name"), UserID: userID}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.NewName == "" {
+		BadRequestError(w, r)
+		return
+	}
+	if !requireScope(w, r, ScopeAssetsWrite) || !requireAssetAccess(w, r, request.Name) || !requireAssetAccess(w, r, request.NewName) {
+		return
+	}
+
+	asset, err := s.RenameAssetWithTransaction(ctx, request)
+	if errors.Is(err, pgx.ErrNoRows) {
+		NotFoundError(w, r, "asset")
+		return
+	}
+	if isUniqueViolation(err) {
+		ConflictError(w, r, CodeAssetExists, "asset with this name already exists")
+		return
+	}
 	if err != nil {
-		log.Fatalf("error handling JSON marshal. Err: %v", err)
+		WriteError(w, r, err)
+		return
 	}
+	writeAssetInfo(w, r, http.StatusOK, asset)
+}
 
-	_, _ = w.Write(jsonResp)
+// CopyAssetHandler копирует файл под новым именем: 201, или 200 при перезаписи
+// с "overwrite": true; 404 если исходного файла нет, 409 если новое имя занято
+func (s *Server) CopyAssetHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := ctx.Value(UserIDKey).(int)
+	request := dto.CopyAsset{Name: r.PathValue("name"), UserID: userID}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil || request.NewName == "" {
+		BadRequestError(w, r)
+		return
+	}
+	if !requireScope(w, r, ScopeAssetsWrite) || !requireAssetAccess(w, r, request.Name) || !requireAssetAccess(w, r, request.NewName) {
+		return
+	}
+
+	asset, created, err := s.CopyAssetWithTransaction(ctx, request)
+	if errors.Is(err, pgx.ErrNoRows) {
+		NotFoundError(w, r, "asset")
+		return
+	}
+	if errors.Is(err, errAssetExists) {
+		ConflictError(w, r, CodeAssetExists, "asset with this name already exists, use \"overwrite\": true to replace it")
+		return
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+	writeAssetInfo(w, r, status, asset)
+}
+
+// ListTrashHandler мягко удаленные файлы с той же пагинацией, что и список файлов
+func (s *Server) ListTrashHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := ctx.Value(UserIDKey).(int)
+	if !requireScope(w, r, ScopeAssetsRead) {
+		return
+	}
+	prefix, ok := listPrefix(w, r)
+	if !ok {
+		return
+	}
+
+	page, size, offset := paginationFromQuery(r)
+	assets, err := s.ListTrashQuery(ctx, dto.ListAssets{
+		UserID: userID,
+		Offset: offset,
+		Limit:  size,
+		Prefix: prefix,
+	})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	writeAssetPage(w, r, page, size, assets)
+}
+
+// RestoreAssetHandler возвращает мягко удаленный файл; 404 если в корзине его нет
+func (s *Server) RestoreAssetHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := ctx.Value(UserIDKey).(int)
+	name := r.PathValue("name")
+	if !requireScope(w, r, ScopeAssetsDelete) || !requireAssetAccess(w, r, name) {
+		return
+	}
+
+	restored, err := s.RestoreAssetWithTransaction(ctx, dto.DeleteAsset{Name: name, UserID: userID})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if !restored {
+		NotFoundError(w, r, "asset")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(map[string]string{strconv.Itoa(userID): name, "status": "restored"})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
 }
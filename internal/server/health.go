@@ -0,0 +1,218 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+	"web-storage-service/pkg"
+)
+
+const (
+	healthCheckTimeout = 2 * time.Second
+
+	checkStatusOK      = "ok"
+	checkStatusFailed  = "failed"
+	checkStatusSkipped = "skipped"
+)
+
+var errShuttingDown = errors.New("server is shutting down")
+
+// errCheckSkipped означает, что проверка неприменима и не влияет на готовность
+var errCheckSkipped = errors.New("check skipped")
+
+type healthCheck struct {
+	name string
+	fn   func(ctx context.Context) (detail string, err error)
+}
+
+type checkResult struct {
+	Name     string `json:"name"`
+	Status   string `json:"status"`
+	Duration string `json:"duration,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// readinessChecks зависимости, без которых инстанс не должен получать трафик
+func (s *Server) readinessChecks() []healthCheck {
+	return append([]healthCheck{s.shutdownCheck()}, s.dependencyChecks()...)
+}
+
+func (s *Server) shutdownCheck() healthCheck {
+	return healthCheck{"shutdown", func(ctx context.Context) (string, error) {
+		if !s.Ready() {
+			return "", errShuttingDown
+		}
+		return "", nil
+	}}
+}
+
+func (s *Server) dependencyChecks() []healthCheck {
+	return []healthCheck{
+		{"database", func(ctx context.Context) (string, error) {
+			return "", s.db.Ping(ctx)
+		}},
+		{"blob_storage", func(ctx context.Context) (string, error) {
+			return "", s.CheckAssetsStorageQuery(ctx)
+		}},
+		{"migrations", s.checkMigrations},
+		{"disk_space", s.checkDiskSpace},
+	}
+}
+
+// readinessCacheTTL сколько /readyz переиспользует результаты проверок зависимостей:
+// эндпоинт публичный, и поток проб не должен превращаться в поток запросов к базе
+const readinessCacheTTL = time.Second
+
+type readinessCache struct {
+	mu        sync.Mutex
+	checkedAt time.Time
+	results   []checkResult
+}
+
+// cachedDependencyChecks проверяет зависимости не чаще readinessCacheTTL; одновременные
+// запросы ждут одну проверку. Она не зависит от отмены запроса, который ее начал,
+// иначе оборванный клиентом запрос закэшировал бы ложный сбой.
+func (s *Server) cachedDependencyChecks(ctx context.Context) []checkResult {
+	s.readiness.mu.Lock()
+	defer s.readiness.mu.Unlock()
+
+	if time.Since(s.readiness.checkedAt) >= readinessCacheTTL {
+		s.readiness.results, _ = runChecks(context.WithoutCancel(ctx), s.dependencyChecks())
+		s.readiness.checkedAt = time.Now()
+	}
+	return s.readiness.results
+}
+
+func (s *Server) checkMigrations(ctx context.Context) (string, error) {
+	statuses, err := s.db.MigrationStatus(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	pending := 0
+	for _, st := range statuses {
+		if !st.Applied {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return "", fmt.Errorf("%d pending migration(s)", pending)
+	}
+	return fmt.Sprintf("%d applied", len(statuses)), nil
+}
+
+func (s *Server) checkDiskSpace(ctx context.Context) (string, error) {
+	if s.cfg.Health.DiskMinFreeMB == 0 {
+		return "", errCheckSkipped
+	}
+
+	free, total, err := pkg.DiskSpace(s.cfg.Health.DiskPath)
+	if errors.Is(err, pkg.ErrDiskSpaceUnsupported) {
+		return "", errCheckSkipped
+	}
+	if err != nil {
+		return "", err
+	}
+
+	detail := fmt.Sprintf("%d MB free of %d MB", free>>20, total>>20)
+	if free < uint64(s.cfg.Health.DiskMinFreeMB)<<20 {
+		return detail, fmt.Errorf("less than %d MB free", s.cfg.Health.DiskMinFreeMB)
+	}
+	return detail, nil
+}
+
+// runChecks выполняет проверки параллельно, каждую со своим таймаутом
+func runChecks(ctx context.Context, checks []healthCheck) ([]checkResult, bool) {
+	results := make([]checkResult, len(checks))
+
+	var wg sync.WaitGroup
+	for i, check := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+
+			start := time.Now()
+			detail, err := check.fn(checkCtx)
+			result := checkResult{
+				Name:     check.name,
+				Status:   checkStatusOK,
+				Duration: time.Since(start).String(),
+				Detail:   detail,
+			}
+			switch {
+			case errors.Is(err, errCheckSkipped):
+				result.Status = checkStatusSkipped
+			case err != nil:
+				result.Status = checkStatusFailed
+				result.Error = err.Error()
+			}
+			results[i] = result
+		}()
+	}
+	wg.Wait()
+
+	return results, allPassed(results)
+}
+
+func allPassed(results []checkResult) bool {
+	for _, result := range results {
+		if result.Status == checkStatusFailed {
+			return false
+		}
+	}
+	return true
+}
+
+// LivezHandler сообщает только о том, что процесс жив и обслуживает запросы.
+// Зависимости сюда намеренно не входят: сбой базы не должен приводить к перезапуску.
+func (s *Server) LivezHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": checkStatusOK})
+}
+
+// ReadyHandler отвечает 503, если не прошла хотя бы одна проверка или идет остановка.
+// Публичный ответ содержит только статусы проверок, без текстов ошибок. Зависимости
+// проверяются не чаще раза в readinessCacheTTL, остановка замечается сразу.
+func (s *Server) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	results, _ := runChecks(r.Context(), []healthCheck{s.shutdownCheck()})
+	results = append(results, s.cachedDependencyChecks(r.Context())...)
+	healthy := allPassed(results)
+
+	checks := make(map[string]string, len(results))
+	for _, result := range results {
+		checks[result.Name] = result.Status
+	}
+
+	writeHealth(w, healthy, map[string]interface{}{"checks": checks})
+}
+
+// HealthHandler подробный отчет для администраторов: ошибки, длительность проверок и статистика пула
+func (s *Server) HealthHandler(w http.ResponseWriter, r *http.Request) {
+	results, healthy := runChecks(r.Context(), s.readinessChecks())
+
+	writeHealth(w, healthy, map[string]interface{}{
+		"checks":   results,
+		"database": s.db.Health(),
+	})
+}
+
+func writeHealth(w http.ResponseWriter, healthy bool, body map[string]interface{}) {
+	status, code := checkStatusOK, http.StatusOK
+	if !healthy {
+		status, code = checkStatusFailed, http.StatusServiceUnavailable
+	}
+	body["status"] = status
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,414 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+	"web-storage-service/internal/models"
+	"web-storage-service/pkg"
+)
+
+var errJWTRevoked = errors.New("jwt revoked")
+
+// jwtKeyReloadInterval не чаще этого запросы с неизвестным kid перечитывают ключи из базы
+const jwtKeyReloadInterval = 5 * time.Second
+
+// jwtKeyring хранит ключи подписи, JWKS и кэш отозванных токенов.
+// Ключи лежат в таблице jwt_keys, поэтому все инстансы подписывают
+// и проверяют токены одним и тем же набором ключей.
+type jwtKeyring struct {
+	alg      string
+	issuer   string
+	ttl      time.Duration
+	rotation time.Duration
+	// aead шифрует закрытые ключи в jwt_keys; nil, если JWT_KEY_SECRET не задан
+	aead cipher.AEAD
+
+	mu         sync.RWMutex
+	signingKid string
+	signer     crypto.Signer
+	publicKeys map[string]crypto.PublicKey
+	jwks       pkg.JWKS
+	revoked    map[string]time.Time
+	// userRevoked: токены пользователя, выпущенные раньше этого момента, отозваны.
+	// Момент округлен вниз до секунды, как iat, чтобы вход сразу после отзыва
+	// в ту же секунду давал рабочий токен.
+	userRevoked map[int]time.Time
+	// lastReload время последней попытки перечитать ключи, в том числе неудачной
+	lastReload time.Time
+	// reloading общий вызов перечитывания для одновременных запросов с неизвестным kid
+	reloading *jwtKeyReload
+}
+
+type jwtKeyReload struct {
+	done chan struct{}
+	err  error
+}
+
+// jwtKeySet ключи из jwt_keys, разобранные refreshJWTKeys и reloadJWTKeys
+type jwtKeySet struct {
+	signingKid string
+	signer     crypto.Signer
+	publicKeys map[string]crypto.PublicKey
+	jwks       pkg.JWKS
+}
+
+func newJWTKeyring(alg, issuer string, ttl, rotation time.Duration, secret []byte) (*jwtKeyring, error) {
+	keyring := &jwtKeyring{
+		alg:         alg,
+		issuer:      issuer,
+		ttl:         ttl,
+		rotation:    rotation,
+		publicKeys:  make(map[string]crypto.PublicKey),
+		revoked:     make(map[string]time.Time),
+		userRevoked: make(map[int]time.Time),
+	}
+	if len(secret) > 0 {
+		block, err := aes.NewCipher(secret)
+		if err != nil {
+			return nil, fmt.Errorf("JWT_KEY_SECRET: %w", err)
+		}
+		if keyring.aead, err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	return keyring, nil
+}
+
+// sealedKeyPrefix отличает зашифрованный ключ от PKCS8, который хранился открыто
+// до появления JWT_KEY_SECRET (DER всегда начинается с 0x30)
+var sealedKeyPrefix = []byte("wss1")
+
+// sealPrivateKey шифрует PKCS8 ключ для jwt_keys, kid служит дополнительными данными,
+// чтобы зашифрованный ключ нельзя было подставить под другой kid
+func (k *jwtKeyring) sealPrivateKey(kid string, der []byte) ([]byte, error) {
+	if k.aead == nil {
+		return der, nil
+	}
+	nonce := make([]byte, k.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := append(append([]byte{}, sealedKeyPrefix...), nonce...)
+	return k.aead.Seal(sealed, nonce, der, []byte(kid)), nil
+}
+
+func (k *jwtKeyring) openPrivateKey(kid string, stored []byte) ([]byte, error) {
+	if !bytes.HasPrefix(stored, sealedKeyPrefix) {
+		return stored, nil
+	}
+	if k.aead == nil {
+		return nil, errors.New("key is encrypted but JWT_KEY_SECRET is not set")
+	}
+	stored = stored[len(sealedKeyPrefix):]
+	if len(stored) < k.aead.NonceSize() {
+		return nil, errors.New("encrypted key is truncated")
+	}
+	nonce, ciphertext := stored[:k.aead.NonceSize()], stored[k.aead.NonceSize():]
+	return k.aead.Open(nil, nonce, ciphertext, []byte(kid))
+}
+
+// readJWTKeys читает действующие ключи из базы; signer пустой, если ни один ключ
+// текущего алгоритма еще не выведен из ротации
+func (s *Server) readJWTKeys(ctx context.Context, now time.Time) (jwtKeySet, error) {
+	keys, err := s.ListJWTKeysQuery(ctx)
+	if err != nil {
+		return jwtKeySet{}, err
+	}
+
+	set := jwtKeySet{
+		publicKeys: make(map[string]crypto.PublicKey, len(keys)),
+		jwks:       pkg.JWKS{Keys: make([]pkg.JWK, 0, len(keys))},
+	}
+	for _, key := range keys {
+		der, err := s.jwt.openPrivateKey(key.Kid, key.PrivateKey)
+		if err != nil {
+			slog.Warn("skipping jwt key", "kid", key.Kid, "error", err)
+			continue
+		}
+		priv, err := x509.ParsePKCS8PrivateKey(der)
+		if err != nil {
+			slog.Warn("skipping jwt key", "kid", key.Kid, "error", err)
+			continue
+		}
+		sig, ok := priv.(crypto.Signer)
+		if !ok {
+			continue
+		}
+		jwk, err := pkg.NewJWK(key.Kid, sig.Public())
+		if err != nil {
+			continue
+		}
+
+		set.publicKeys[key.Kid] = sig.Public()
+		set.jwks.Keys = append(set.jwks.Keys, jwk)
+
+		// ключи отсортированы по created_at, поэтому подписываем самым свежим
+		if key.Alg == s.jwt.alg && now.Before(key.RetireAt) {
+			set.signer = sig
+			set.signingKid = key.Kid
+		}
+	}
+	return set, nil
+}
+
+// storeJWTKeys заменяет ключи проверки; ключ подписи меняется, только если он в set есть
+func (s *Server) storeJWTKeys(set jwtKeySet, now time.Time) {
+	s.jwt.mu.Lock()
+	defer s.jwt.mu.Unlock()
+	if set.signer != nil {
+		s.jwt.signer = set.signer
+		s.jwt.signingKid = set.signingKid
+	}
+	s.jwt.publicKeys = set.publicKeys
+	s.jwt.jwks = set.jwks
+	s.jwt.lastReload = now
+}
+
+// refreshJWTKeys перечитывает ключи из базы и создает новый ключ подписи,
+// если у текущего истек срок ротации
+func (s *Server) refreshJWTKeys(ctx context.Context) error {
+	now := time.Now()
+	set, err := s.readJWTKeys(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	if set.signer == nil {
+		key, sig, err := s.createJWTKey(ctx, now)
+		if err != nil {
+			return err
+		}
+		jwk, err := pkg.NewJWK(key.Kid, sig.Public())
+		if err != nil {
+			return err
+		}
+		set.signer = sig
+		set.signingKid = key.Kid
+		set.publicKeys[key.Kid] = sig.Public()
+		set.jwks.Keys = append(set.jwks.Keys, jwk)
+		slog.Info("rotated jwt signing key", "kid", key.Kid)
+	}
+
+	s.storeJWTKeys(set, now)
+	return nil
+}
+
+// reloadJWTKeys только перечитывает ключи, не создавая новых: так запросы с неизвестным
+// kid подхватывают ключ, только что созданный другим инстансом. Одновременные запросы
+// ждут один общий вызов, а повтор возможен не раньше jwtKeyReloadInterval, даже если
+// база недоступна.
+func (s *Server) reloadJWTKeys(ctx context.Context) error {
+	s.jwt.mu.Lock()
+	if call := s.jwt.reloading; call != nil {
+		s.jwt.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	if time.Since(s.jwt.lastReload) < jwtKeyReloadInterval {
+		s.jwt.mu.Unlock()
+		return nil
+	}
+	call := &jwtKeyReload{done: make(chan struct{})}
+	s.jwt.reloading = call
+	s.jwt.lastReload = time.Now()
+	s.jwt.mu.Unlock()
+
+	defer func() {
+		s.jwt.mu.Lock()
+		s.jwt.reloading = nil
+		s.jwt.mu.Unlock()
+		close(call.done)
+	}()
+
+	now := time.Now()
+	set, err := s.readJWTKeys(ctx, now)
+	if err != nil {
+		call.err = err
+		return err
+	}
+	s.storeJWTKeys(set, now)
+	return nil
+}
+
+func (s *Server) createJWTKey(ctx context.Context, now time.Time) (models.JWTKey, crypto.Signer, error) {
+	signer, err := pkg.GenerateSigningKey(s.jwt.alg)
+	if err != nil {
+		return models.JWTKey{}, nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return models.JWTKey{}, nil, err
+	}
+	kid := pkg.GenerateRandomID(8)
+	sealed, err := s.jwt.sealPrivateKey(kid, der)
+	if err != nil {
+		return models.JWTKey{}, nil, err
+	}
+
+	// ключ остается в JWKS еще ttl после вывода из ротации,
+	// чтобы выпущенные им токены можно было проверить
+	key := models.JWTKey{
+		Kid:        kid,
+		Alg:        s.jwt.alg,
+		PrivateKey: sealed,
+		RetireAt:   now.Add(s.jwt.rotation),
+		ExpiresAt:  now.Add(s.jwt.rotation + s.jwt.ttl),
+	}
+	if err = s.InsertJWTKeyQuery(ctx, key); err != nil {
+		return models.JWTKey{}, nil, err
+	}
+	return key, signer, nil
+}
+
+// refreshRevokedTokens подтягивает список отозванных токенов, в том числе
+// отозванных другими инстансами
+func (s *Server) refreshRevokedTokens(ctx context.Context) error {
+	revoked, err := s.ListRevokedTokensQuery(ctx)
+	if err != nil {
+		return err
+	}
+
+	// отзывы старше ttl уже не влияют: все токены до них истекли сами
+	userRevoked, err := s.ListUserTokenRevocationsQuery(ctx, time.Now().Add(-s.jwt.ttl))
+	if err != nil {
+		return err
+	}
+
+	s.jwt.mu.Lock()
+	s.jwt.revoked = revoked
+	s.jwt.userRevoked = userRevoked
+	s.jwt.mu.Unlock()
+	return nil
+}
+
+// runJWTMaintenance периодически ротирует ключи и обновляет кэш отзывов
+func (s *Server) runJWTMaintenance(ctx context.Context) {
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.refreshJWTKeys(ctx); err != nil {
+				slog.Error("error refreshing jwt keys", "error", err)
+			}
+			if err := s.refreshRevokedTokens(ctx); err != nil {
+				slog.Error("error refreshing revoked tokens", "error", err)
+			}
+			if err := s.DeleteExpiredJWTDataQuery(ctx); err != nil {
+				slog.Error("error deleting expired jwt data", "error", err)
+			}
+		}
+	}
+}
+
+// IssueJWT выпускает access token для пользователя
+func (s *Server) IssueJWT(user models.User, scope string) (string, pkg.JWTClaims, error) {
+	now := time.Now()
+	claims := pkg.JWTClaims{
+		Issuer:    s.jwt.issuer,
+		Subject:   strconv.Itoa(user.ID),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(s.jwt.ttl).Unix(),
+		ID:        pkg.GenerateRandomID(16),
+		Scope:     scope,
+		Role:      user.Role,
+	}
+
+	s.jwt.mu.RLock()
+	signer, kid := s.jwt.signer, s.jwt.signingKid
+	s.jwt.mu.RUnlock()
+
+	token, err := pkg.SignJWT(claims, kid, signer)
+	return token, claims, err
+}
+
+// VerifyJWT проверяет подпись, срок действия, издателя и отзыв токена
+func (s *Server) VerifyJWT(ctx context.Context, token string) (pkg.JWTClaims, error) {
+	claims, err := pkg.ParseJWT(token, func(kid, alg string) (crypto.PublicKey, error) {
+		return s.jwtPublicKey(ctx, kid)
+	})
+	if err != nil {
+		return claims, err
+	}
+	if s.jwt.issuer != "" && claims.Issuer != s.jwt.issuer {
+		return claims, pkg.ErrJWTSignature
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return claims, pkg.ErrJWTMalformed
+	}
+
+	s.jwt.mu.RLock()
+	_, revoked := s.jwt.revoked[claims.ID]
+	revokedBefore, userRevoked := s.jwt.userRevoked[userID]
+	s.jwt.mu.RUnlock()
+	if revoked || (userRevoked && claims.IssuedAt < revokedBefore.Unix()) {
+		return claims, errJWTRevoked
+	}
+
+	return claims, nil
+}
+
+func (s *Server) jwtPublicKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	s.jwt.mu.RLock()
+	key, ok := s.jwt.publicKeys[kid]
+	s.jwt.mu.RUnlock()
+
+	// ключ мог быть только что создан другим инстансом
+	if !ok {
+		if err := s.reloadJWTKeys(ctx); err != nil {
+			return nil, err
+		}
+		s.jwt.mu.RLock()
+		key, ok = s.jwt.publicKeys[kid]
+		s.jwt.mu.RUnlock()
+	}
+	if !ok {
+		return nil, pkg.ErrJWTSignature
+	}
+	return key, nil
+}
+
+// RevokeJWT отзывает токен до окончания срока его действия
+func (s *Server) RevokeJWT(ctx context.Context, claims pkg.JWTClaims, userID int) error {
+	expiresAt := time.Unix(claims.ExpiresAt, 0)
+	if err := s.InsertRevokedTokenQuery(ctx, claims.ID, userID, expiresAt); err != nil {
+		return err
+	}
+
+	s.jwt.mu.Lock()
+	s.jwt.revoked[claims.ID] = expiresAt
+	s.jwt.mu.Unlock()
+	return nil
+}
+
+// revokeUserJWTsLocally сразу применяет отзыв всех токенов пользователя на этом инстансе,
+// остальные инстансы подхватят его из user_token_revocations
+func (s *Server) revokeUserJWTsLocally(userID int) {
+	if s.jwt == nil {
+		return
+	}
+
+	s.jwt.mu.Lock()
+	s.jwt.userRevoked[userID] = time.Now().Truncate(time.Second)
+	s.jwt.mu.Unlock()
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"testing"
+	"time"
+	"web-storage-service/internal/models"
+	"web-storage-service/pkg"
+)
+
+func newJWTTestServer(t *testing.T) *Server {
+	t.Helper()
+	keyring, err := newJWTKeyring(pkg.JWTAlgEdDSA, "wss-test", time.Hour, 24*time.Hour, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyring.signingKid, keyring.signer = "test", private
+	keyring.publicKeys = map[string]crypto.PublicKey{"test": public}
+	return &Server{jwt: keyring}
+}
+
+func TestUserRevocationSameSecond(t *testing.T) {
+	s := newJWTTestServer(t)
+	ctx := context.Background()
+	user := models.User{ID: 7, Role: models.RoleUser}
+
+	// токен, выпущенный за секунду до отзыва
+	old, _, err := s.IssueJWT(user, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.jwt.mu.Lock()
+	s.jwt.userRevoked[user.ID] = time.Now().Add(time.Second)
+	s.jwt.mu.Unlock()
+	if _, err = s.VerifyJWT(ctx, old); !errors.Is(err, errJWTRevoked) {
+		t.Errorf("token issued before the revocation: err = %v, want errJWTRevoked", err)
+	}
+
+	// вход сразу после отзыва, в ту же секунду, дает рабочий токен
+	s.revokeUserJWTsLocally(user.ID)
+	fresh, _, err := s.IssueJWT(user, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.VerifyJWT(ctx, fresh); err != nil {
+		t.Errorf("token issued right after the revocation: err = %v, want nil", err)
+	}
+}
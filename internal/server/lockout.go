@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"time"
+	"web-storage-service/internal/models"
+	"web-storage-service/pkg"
+)
+
+// lockoutPolicy параметры защиты от подбора пароля. После maxFailures неудач
+// ключ блокируется на baseLockout, и каждая следующая неудача удваивает срок до maxLockout.
+type lockoutPolicy struct {
+	maxFailures   int
+	ipMaxFailures int
+	window        time.Duration
+	baseLockout   time.Duration
+	maxLockout    time.Duration
+}
+
+func loginAttemptKeys(login, ip string) (loginKey, ipKey string) {
+	return "login:" + login, "ip:" + ip
+}
+
+// lockoutDuration срок блокировки после failures неудач подряд при пороге threshold
+func (p lockoutPolicy) lockoutDuration(failures, threshold int) time.Duration {
+	if failures < threshold {
+		return 0
+	}
+	d := time.Duration(float64(p.baseLockout) * math.Pow(2, float64(failures-threshold)))
+	if d <= 0 || d > p.maxLockout {
+		return p.maxLockout
+	}
+	return d
+}
+
+// checkLoginLock отвечает 429 с Retry-After, если логин или IP заблокированы;
+// с пустым login проверяется только IP
+func (s *Server) checkLoginLock(w http.ResponseWriter, r *http.Request, login string) bool {
+	keys := attemptKeys(login, pkg.ClientIP(r))
+
+	lockedUntil, err := s.GetLoginLockQuery(r.Context(), keys)
+	if err != nil {
+		InternalServerError(w, r, fmt.Errorf("checking login lock: %w", err))
+		return false
+	}
+	if !lockedUntil.IsZero() {
+		s.authFailure(authFailureLockedOut)
+		TooManyRequestsError(w, r, CodeLoginLocked, time.Until(lockedUntil))
+		return false
+	}
+	return true
+}
+
+// attemptKeys ключи счетчиков для логина и IP; пустой логин не учитывается
+func attemptKeys(login, ip string) []string {
+	loginKey, ipKey := loginAttemptKeys(login, ip)
+	if login == "" {
+		return []string{ipKey}
+	}
+	return []string{loginKey, ipKey}
+}
+
+// registerLoginFailure учитывает неудачу и блокирует ключи, превысившие порог;
+// с пустым login учитывается только IP
+func (s *Server) registerLoginFailure(ctx context.Context, login, ip string) {
+	loginKey, _ := loginAttemptKeys(login, ip)
+	windowStart := time.Now().Add(-s.lockout.window)
+
+	for _, key := range attemptKeys(login, ip) {
+		threshold := s.lockout.ipMaxFailures
+		if key == loginKey {
+			threshold = s.lockout.maxFailures
+		}
+		failures, err := s.RegisterLoginFailureQuery(ctx, key, windowStart)
+		if err != nil {
+			slog.ErrorContext(ctx, "error registering login failure", "error", err)
+			continue
+		}
+
+		if d := s.lockout.lockoutDuration(failures, threshold); d > 0 {
+			if err = s.LockLoginQuery(ctx, key, time.Now().Add(d)); err != nil {
+				slog.ErrorContext(ctx, "error locking login", "key", key, "error", err)
+			}
+		}
+	}
+}
+
+// registerLoginSuccess сбрасывает счетчик по логину. Счетчик по IP не сбрасываем,
+// иначе один известный пароль позволял бы подбирать остальные учетные записи.
+func (s *Server) registerLoginSuccess(ctx context.Context, login string) {
+	loginKey, _ := loginAttemptKeys(login, "")
+	if _, err := s.ResetLoginAttemptsQuery(ctx, []string{loginKey}); err != nil {
+		slog.ErrorContext(ctx, "error resetting login attempts", "error", err)
+	}
+}
+
+func (s *Server) runLoginAttemptsCleanup(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.DeleteStaleLoginAttemptsQuery(ctx, time.Now().Add(-s.lockout.window)); err != nil {
+				slog.Error("error deleting stale login attempts", "error", err)
+			}
+		}
+	}
+}
+
+func (s *Server) ListLockoutsHandler(w http.ResponseWriter, r *http.Request) {
+	lockouts, err := s.ListLockedLoginsQuery(r.Context())
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(map[string][]models.LoginAttempt{"lockouts": lockouts})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+}
+
+// UnlockHandler снимает блокировку с логина (?login=) и/или IP (?ip=)
+func (s *Server) UnlockHandler(w http.ResponseWriter, r *http.Request) {
+	login := r.URL.Query().Get("login")
+	ip := r.URL.Query().Get("ip")
+
+	var keys []string
+	if login != "" {
+		loginKey, _ := loginAttemptKeys(login, "")
+		keys = append(keys, loginKey)
+	}
+	if ip != "" {
+		_, ipKey := loginAttemptKeys("", ip)
+		keys = append(keys, ipKey)
+	}
+	if len(keys) == 0 {
+		BadRequestError(w, r)
+		return
+	}
+
+	removed, err := s.ResetLoginAttemptsQuery(r.Context(), keys)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(map[string]interface{}{"status": "unlocked", "removed": removed})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+}
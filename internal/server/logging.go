@@ -0,0 +1,106 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"time"
+	"web-storage-service/internal/logging"
+	"web-storage-service/pkg"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+	// maxRequestIDLength чужой X-Request-ID длиннее этого заменяется своим
+	maxRequestIDLength = 128
+)
+
+// quietRoutes пробы и сбор метрик пишутся в access log только на уровне debug
+var quietRoutes = map[string]bool{"/livez": true, "/readyz": true, "/metrics": true}
+
+// accessLogEntry заполняется по ходу запроса: пользователь известен только после AuthMiddleware
+type accessLogEntry struct {
+	userID int
+}
+
+// RequestIDMiddleware берет X-Request-ID клиента или прокси либо создает новый,
+// возвращает его в ответе и добавляет ко всем записям лога этого запроса
+func (s *Server) RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = pkg.GenerateRandomID(16)
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+
+		ctx := context.WithValue(r.Context(), RequestIDKey, requestID)
+		ctx = logging.With(ctx, slog.String("request_id", requestID))
+
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// validRequestID пропускает только печатные ASCII без пробелов, чтобы в лог не попал мусор
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// AccessLogMiddleware пишет по строке на запрос: маршрут, статус, размер ответа, длительность и пользователя
+func (s *Server) AccessLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entry := &accessLogEntry{}
+		ctx := context.WithValue(r.Context(), accessLogKey, entry)
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		route := routeFromContext(ctx)
+
+		level := slog.LevelInfo
+		switch {
+		case quietRoutes[route] && status < http.StatusBadRequest:
+			level = slog.LevelDebug
+		case quietRoutes[route]:
+			// 503 от /readyz штатно при остановке и сбое зависимости, это не ошибка сервиса
+			level = slog.LevelWarn
+		case status >= http.StatusInternalServerError:
+			level = slog.LevelError
+		}
+
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("route", route),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", status),
+			slog.Int64("bytes", rec.written),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.String("remote_ip", pkg.ClientIP(r)),
+			slog.String("user_agent", r.UserAgent()),
+		}
+		if entry.userID != 0 {
+			attrs = append(attrs, slog.Int("user_id", entry.userID))
+		}
+		slog.LogAttrs(ctx, level, "request", attrs...)
+	})
+}
+
+// setLogUser запоминает пользователя для access log и добавляет user_id к записям обработчика
+func setLogUser(ctx context.Context, userID int) context.Context {
+	if entry, ok := ctx.Value(accessLogKey).(*accessLogEntry); ok {
+		entry.userID = userID
+	}
+	return logging.With(ctx, slog.Int("user_id", userID))
+}
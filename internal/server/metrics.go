@@ -0,0 +1,191 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"web-storage-service/internal/database"
+	"web-storage-service/internal/metrics"
+	"web-storage-service/internal/models"
+	"web-storage-service/pkg"
+)
+
+// storageStatsTTL как часто метрики хранилища перечитываются из базы:
+// сумма размеров по всем файлам не должна считаться на каждый scrape
+const storageStatsTTL = 30 * time.Second
+
+const (
+	authFailureCredentials  = "bad_credentials"
+	authFailureLockedOut    = "locked_out"
+	authFailureToken        = "invalid_token"
+	authFailureSecondFactor = "invalid_second_factor"
+	authFailureOIDC         = "oidc"
+	authFailureUserDisabled = "user_disabled"
+	authFailureCSRF         = "csrf"
+)
+
+type serverMetrics struct {
+	registry *metrics.Registry
+
+	requests      *metrics.CounterVec
+	duration      *metrics.HistogramVec
+	inFlight      *metrics.GaugeVec
+	uploadBytes   *metrics.CounterVec
+	downloadBytes *metrics.CounterVec
+	authFailures  *metrics.CounterVec
+	rateLimited   *metrics.CounterVec
+
+	throttledTransfers *metrics.GaugeVec
+	throttleWait       *metrics.CounterVec
+
+	storageMu      sync.Mutex
+	storage        models.StorageStats
+	storageFetched time.Time
+}
+
+func newServerMetrics(s *Server) *serverMetrics {
+	reg := metrics.NewRegistry()
+	m := &serverMetrics{
+		registry: reg,
+
+		requests: reg.NewCounterVec("http_requests_total",
+			"HTTP requests by route pattern, method and status code.", "method", "route", "status"),
+		duration: reg.NewHistogramVec("http_request_duration_seconds",
+			"HTTP request latency by route pattern and method.", metrics.DefBuckets, "method", "route"),
+		inFlight: reg.NewGaugeVec("http_requests_in_flight",
+			"HTTP requests currently being served."),
+		uploadBytes: reg.NewCounterVec("asset_upload_bytes_total",
+			"Bytes of asset content received in uploads and updates."),
+		downloadBytes: reg.NewCounterVec("asset_download_bytes_total",
+			"Bytes of asset content sent in downloads."),
+		authFailures: reg.NewCounterVec("auth_failures_total",
+			"Failed authentication attempts by reason.", "reason"),
+		rateLimited: reg.NewCounterVec("http_rate_limited_total",
+			"Requests rejected by the rate limiter by route class.", "class"),
+		throttledTransfers: reg.NewGaugeVec("asset_transfers_throttled",
+			"Asset transfers currently subject to a bandwidth limit, by direction.", "direction"),
+		throttleWait: reg.NewCounterVec("asset_throttle_wait_seconds_total",
+			"Time asset transfers spent waiting for bandwidth, by direction.", "direction"),
+	}
+
+	poolGauge := func(name, help string, fn func(st database.PoolStats) float64) {
+		reg.NewGaugeFunc(name, help, func() float64 { return fn(s.db.PoolStats()) })
+	}
+	poolCounter := func(name, help string, fn func(st database.PoolStats) float64) {
+		reg.NewCounterFunc(name, help, func() float64 { return fn(s.db.PoolStats()) })
+	}
+	poolGauge("db_pool_connections", "Open connections in the pool.",
+		func(st database.PoolStats) float64 { return float64(st.TotalConns) })
+	poolGauge("db_pool_connections_in_use", "Connections currently acquired.",
+		func(st database.PoolStats) float64 { return float64(st.AcquiredConns) })
+	poolGauge("db_pool_connections_idle", "Idle connections in the pool.",
+		func(st database.PoolStats) float64 { return float64(st.IdleConns) })
+	poolGauge("db_pool_connections_max", "Maximum size of the pool.",
+		func(st database.PoolStats) float64 { return float64(st.MaxConns) })
+	poolCounter("db_pool_new_connections_total", "Connections opened by the pool.",
+		func(st database.PoolStats) float64 { return float64(st.NewConns) })
+	poolCounter("db_pool_acquires_total", "Successful connection acquires.",
+		func(st database.PoolStats) float64 { return float64(st.AcquireCount) })
+	poolCounter("db_pool_empty_acquires_total", "Acquires that had to wait for a connection.",
+		func(st database.PoolStats) float64 { return float64(st.EmptyAcquireCount) })
+	poolCounter("db_pool_canceled_acquires_total", "Acquires canceled by their context.",
+		func(st database.PoolStats) float64 { return float64(st.CanceledAcquireCount) })
+	poolCounter("db_pool_acquire_duration_seconds_total", "Total time spent acquiring connections.",
+		func(st database.PoolStats) float64 { return st.AcquireDuration.Seconds() })
+	poolCounter("db_pool_max_lifetime_closed_total", "Connections closed because of max lifetime.",
+		func(st database.PoolStats) float64 { return float64(st.MaxLifetimeDestroyCount) })
+	poolCounter("db_pool_max_idle_closed_total", "Connections closed because of max idle time.",
+		func(st database.PoolStats) float64 { return float64(st.MaxIdleDestroyCount) })
+
+	storageGauge := func(name, help string, fn func(st models.StorageStats) int64) {
+		reg.NewGaugeFunc(name, help, func() float64 { return float64(fn(m.storageStats(s))) })
+	}
+	storageGauge("storage_users", "Registered users.",
+		func(st models.StorageStats) int64 { return st.Users })
+	storageGauge("storage_assets", "Stored assets, excluding soft-deleted ones.",
+		func(st models.StorageStats) int64 { return st.Assets })
+	storageGauge("storage_asset_bytes", "Bytes of stored assets, excluding soft-deleted ones.",
+		func(st models.StorageStats) int64 { return st.Bytes })
+	storageGauge("storage_deleted_assets", "Soft-deleted assets.",
+		func(st models.StorageStats) int64 { return st.DeletedAssets })
+	storageGauge("storage_deleted_asset_bytes", "Bytes of soft-deleted assets.",
+		func(st models.StorageStats) int64 { return st.DeletedBytes })
+	storageGauge("active_sessions", "Active, unexpired sessions.",
+		func(st models.StorageStats) int64 { return st.ActiveSessions })
+
+	return m
+}
+
+// storageStats отдает закэшированную статистику и обновляет ее раз в storageStatsTTL.
+// При ошибке остаются прежние значения, чтобы графики не падали в ноль,
+// а следующая попытка будет не раньше чем через storageStatsTTL.
+func (m *serverMetrics) storageStats(s *Server) models.StorageStats {
+	m.storageMu.Lock()
+	defer m.storageMu.Unlock()
+
+	if time.Since(m.storageFetched) < storageStatsTTL {
+		return m.storage
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	stats, err := s.GetStorageStatsQuery(ctx)
+	m.storageFetched = time.Now()
+	if err != nil {
+		slog.Error("error collecting storage metrics", "error", err)
+		return m.storage
+	}
+	m.storage = stats
+	return m.storage
+}
+
+func (s *Server) authFailure(reason string) {
+	s.metrics.authFailures.Inc(reason)
+}
+
+// MetricsMiddleware считает запросы и их длительность по шаблону маршрута,
+// а не по пути: иначе каждое имя файла давало бы отдельную серию. По той же
+// причине нестандартные методы попадают в одну метку OTHER.
+func (s *Server) MetricsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, method := routeFromContext(r.Context()), methodLabel(r)
+
+		s.metrics.inFlight.Add(1)
+		defer s.metrics.inFlight.Add(-1)
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		s.metrics.requests.Inc(method, route, strconv.Itoa(status))
+		s.metrics.duration.Observe(time.Since(start).Seconds(), method, route)
+	})
+}
+
+// MetricsHandler отдает метрики; при заданном METRICS_TOKEN требует его в Authorization.
+// Без токена метрики закрыты, пока их явно не открыли METRICS_PUBLIC: в них видны
+// трафик по маршрутам и причины отказов во входе.
+func (s *Server) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if s.cfg.MetricsToken == "" && !s.cfg.MetricsPublic {
+		ForbiddenError(w, r, CodeForbidden, "metrics are disabled, set METRICS_TOKEN or METRICS_PUBLIC")
+		return
+	}
+	if s.cfg.MetricsToken != "" {
+		token, err := pkg.ExtractBearerToken(r)
+		if err != nil || subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.MetricsToken)) != 1 {
+			UnauthorizedError(w, r, CodeInvalidToken, "invalid metrics token")
+			return
+		}
+	}
+
+	s.metrics.registry.Handler().ServeHTTP(w, r)
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"web-storage-service/internal/database"
+)
+
+// poolStatsDB отвечает только на PoolStats: больше метрикам при выводе ничего не нужно
+type poolStatsDB struct {
+	database.Service
+}
+
+func (poolStatsDB) PoolStats() database.PoolStats { return database.PoolStats{} }
+
+// requestSeries число серий http_requests_total и http_request_duration_seconds_count в выводе /metrics
+func requestSeries(t *testing.T, s *Server) (requests, durations int) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := s.metrics.registry.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		switch {
+		case strings.HasPrefix(line, "http_requests_total{"):
+			requests++
+		case strings.HasPrefix(line, "http_request_duration_seconds_count{"):
+			durations++
+		}
+	}
+	return requests, durations
+}
+
+func TestMetricsMethodCardinality(t *testing.T) {
+	s := &Server{db: poolStatsDB{}}
+	s.metrics = newServerMetrics(s)
+	// статистика хранилища считается свежей, чтобы вывод не ходил в базу
+	s.metrics.storageFetched = time.Now()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/assets", func(w http.ResponseWriter, r *http.Request) {})
+	handler := s.RouteMiddleware(mux)(s.MetricsMiddleware(mux))
+
+	serve := func(method string) {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, "/api/assets", nil))
+	}
+	serve(http.MethodGet)
+	serve("FOO1")
+	requests, durations := requestSeries(t, s)
+
+	const letters = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		method := make([]byte, 3+rnd.Intn(8))
+		for j := range method {
+			method[j] = letters[rnd.Intn(len(letters))]
+		}
+		serve(fmt.Sprintf("%s%d", method, i))
+	}
+	gotRequests, gotDurations := requestSeries(t, s)
+	if gotRequests != requests || gotDurations != durations {
+		t.Errorf("series grew from %d/%d to %d/%d after random methods", requests, durations, gotRequests, gotDurations)
+	}
+
+	var buf bytes.Buffer
+	if err := s.metrics.registry.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{`method="GET",route="/api/assets",status="200"`, `method="OTHER",route="unmatched",status="405"`} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("metrics output has no series %s", want)
+		}
+	}
+}
@@ -2,45 +2,274 @@ package server
 
 import (
 	"context"
+	"errors"
+	"log/slog"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"web-storage-service/internal/models"
 	"web-storage-service/pkg"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type key int
 
-const UserIDKey key = 0
+const (
+	UserIDKey key = iota
+	// ScopesKey права текущего запроса, []string
+	ScopesKey
+	// AssetPrefixKey префикс имен файлов, которым ограничен API-ключ
+	AssetPrefixKey
+	// RoleKey роль пользователя, см. models.Role*
+	RoleKey
+	// RouteKey шаблон маршрута вида /api/asset/{name}
+	RouteKey
+	// RequestIDKey значение X-Request-ID текущего запроса
+	RequestIDKey
+
+	accessLogKey
+)
+
+// unmatchedRoute метка для запросов, не попавших ни в один маршрут
+const unmatchedRoute = "unmatched"
+
+// otherMethod метка для нестандартных методов: метод приходит от клиента как есть,
+// и каждый новый токен иначе давал бы отдельную серию метрик или имя спана
+const otherMethod = "OTHER"
+
+const (
+	ScopeAssetsRead    = "assets:read"
+	ScopeAssetsWrite   = "assets:write"
+	ScopeAssetsDelete  = "assets:delete"
+	ScopeKeysManage    = "keys:manage"
+	ScopeAccountManage = "account:manage"
+)
+
+// defaultScopes права, которые получает пользователь, вошедший по паролю
+const defaultScopes = ScopeAssetsRead + " " + ScopeAssetsWrite + " " + ScopeAssetsDelete + " " + ScopeKeysManage + " " + ScopeAccountManage
+
+// apiKeyScopes права, которые можно выдать API-ключу
+var apiKeyScopes = []string{ScopeAssetsRead, ScopeAssetsWrite, ScopeAssetsDelete}
+
+var (
+	errAPIKeyInvalid   = errors.New("api key is invalid, revoked or expired")
+	errAccountDisabled = errors.New("account is disabled")
+)
+
+// roleScopes максимальный набор прав для роли: токен или ключ не может дать больше
+func roleScopes(role string) []string {
+	if role == models.RoleReadOnly {
+		return []string{ScopeAssetsRead, ScopeKeysManage, ScopeAccountManage}
+	}
+	return strings.Fields(defaultScopes)
+}
 
 func (s *Server) AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token, err := pkg.ExtractBearerToken(r)
+		// спан охватывает только проверку токена, обработчик идет уже вне его
+		authCtx, span := s.tracer.Start(r.Context(), "AuthMiddleware", trace.SpanKindInternal)
+
+		token, fromCookie, err := s.requestToken(r)
 		if err != nil {
-			UnauthorizedError(w, "invalid authorization token")
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			span.End()
+			s.authFailure(authFailureToken)
+			UnauthorizedError(w, r, CodeUnauthorized, "missing or malformed authorization header")
+			return
+		}
+		// cookie браузер подставляет сам, поэтому изменяющий запрос должен доказать знание CSRF-токена
+		if fromCookie && !validCSRF(r, token) {
+			span.End()
+			s.authFailure(authFailureCSRF)
+			ForbiddenError(w, r, CodeCSRFFailed, "missing or invalid csrf token")
 			return
 		}
 
-		userID, err := s.DeactivateExpiredSessionsAndReturnUserID(token)
+		var userID int
+		role := models.RoleUser
+		scopes := strings.Fields(defaultScopes)
+		prefix := ""
+		method := "session"
+
+		if id, ok := pkg.ParseAPIKey(token); ok {
+			method = "api_key"
+			userID, role, scopes, prefix, err = s.authenticateAPIKey(authCtx, id, token)
+		} else if s.jwt != nil && pkg.LooksLikeJWT(token) {
+			method = "jwt"
+			var claims pkg.JWTClaims
+			claims, err = s.VerifyJWT(authCtx, token)
+			if err == nil {
+				userID, err = strconv.Atoi(claims.Subject)
+				scopes = strings.Fields(claims.Scope)
+				if claims.Role != "" {
+					role = claims.Role
+				}
+			}
+		} else {
+			userID, role, err = s.DeactivateExpiredSessionsAndReturnUserID(authCtx, token)
+		}
+		span.SetAttributes(attribute.String("auth.method", method))
 		if err != nil {
-			UnauthorizedError(w, "invalid authorization token")
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			span.End()
+			s.authFailure(authFailureToken)
+			UnauthorizedError(w, r, CodeInvalidToken, "invalid authorization token")
 			return
 		}
 
-		ctx := context.WithValue(r.Context(), UserIDKey, userID)
+		allowed := roleScopes(role)
+		scopes = slices.DeleteFunc(scopes, func(scope string) bool { return !slices.Contains(allowed, scope) })
+
+		span.SetAttributes(attribute.Int("enduser.id", userID), attribute.String("enduser.role", role))
+		span.End()
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.Int("enduser.id", userID))
+
+		ctx := setLogUser(r.Context(), userID)
+		ctx = context.WithValue(ctx, UserIDKey, userID)
+		ctx = context.WithValue(ctx, RoleKey, role)
+		ctx = context.WithValue(ctx, ScopesKey, scopes)
+		ctx = context.WithValue(ctx, AssetPrefixKey, prefix)
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
-func (s *Server) CORSMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Add("Access-Control-Allow-Origin", "*")
-		w.Header().Add("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Add("Access-Control-Allow-Headers", "Content-Type, Authorization")
+func (s *Server) authenticateAPIKey(ctx context.Context, id, token string) (int, string, []string, string, error) {
+	apiKey, err := s.GetAPIKeyQuery(ctx, id)
+	if err != nil {
+		return 0, "", nil, "", err
+	}
+	if apiKey.Revoked || !pkg.ValidateAPIKey(token, apiKey.KeyHash) {
+		return 0, "", nil, "", errAPIKeyInvalid
+	}
+	if apiKey.ExpiresAt != nil && time.Now().After(*apiKey.ExpiresAt) {
+		return 0, "", nil, "", errAPIKeyInvalid
+	}
 
-		if r.Method == http.MethodOptions {
-			w.WriteHeader(http.StatusNoContent)
-			return
-		}
+	role, disabled, err := s.GetUserRoleQuery(ctx, apiKey.UID)
+	if err != nil {
+		return 0, "", nil, "", err
+	}
+	if disabled {
+		return 0, "", nil, "", errAccountDisabled
+	}
 
-		next.ServeHTTP(w, r)
-	})
+	if err = s.TouchAPIKeyQuery(ctx, id); err != nil {
+		slog.ErrorContext(ctx, "error updating api key last use", "error", err)
+	}
+
+	return apiKey.UID, role, apiKey.Scopes, apiKey.PathPrefix, nil
+}
+
+// RequireRole пропускает только пользователей с одной из ролей roles; ставится после AuthMiddleware
+func (s *Server) RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role, _ := r.Context().Value(RoleKey).(string)
+			if !slices.Contains(roles, role) {
+				ForbiddenError(w, r, CodeForbidden, "role is not allowed")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireScope отвечает 403, если у запроса нет права scope
+func requireScope(w http.ResponseWriter, r *http.Request, scope string) bool {
+	scopes, _ := r.Context().Value(ScopesKey).([]string)
+	if !slices.Contains(scopes, scope) {
+		ForbiddenError(w, r, CodeInsufficientScope, "missing scope "+scope)
+		return false
+	}
+	return true
+}
+
+// requireAssetAccess отвечает 403, если API-ключ ограничен префиксом, под который name не подходит
+func requireAssetAccess(w http.ResponseWriter, r *http.Request, name string) bool {
+	prefix, _ := r.Context().Value(AssetPrefixKey).(string)
+	if !strings.HasPrefix(name, prefix) {
+		ForbiddenError(w, r, CodeForbidden, "asset is outside of the api key prefix")
+		return false
+	}
+	return true
+}
+
+// statusRecorder запоминает код ответа для метрик и логов
+type statusRecorder struct {
+	http.ResponseWriter
+	status  int
+	written int64
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.written += int64(n)
+	return n, err
+}
+
+// Flush нужен потоковым ответам, которые проверяют http.Flusher напрямую
+func (r *statusRecorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap дает http.ResponseController доступ к исходному ResponseWriter
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// RouteMiddleware кладет в контекст шаблон маршрута, которым mux обработает запрос,
+// чтобы метрики и трассировка группировали запросы по нему
+func (s *Server) RouteMiddleware(mux *http.ServeMux) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := unmatchedRoute
+			if _, pattern := mux.Handler(r); pattern != "" {
+				route = pattern
+				// метод в шаблоне лишний: он и так есть в запросе
+				if _, path, ok := strings.Cut(pattern, " "); ok {
+					route = path
+				}
+			}
+
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), RouteKey, route)))
+		})
+	}
+}
+
+func routeFromContext(ctx context.Context) string {
+	if route, ok := ctx.Value(RouteKey).(string); ok {
+		return route
+	}
+	return unmatchedRoute
+}
+
+// methodLabel метод запроса для метрик и трассировки; нестандартные сводятся к otherMethod
+func methodLabel(r *http.Request) string {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace:
+		return r.Method
+	}
+	return otherMethod
 }
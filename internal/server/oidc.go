@@ -0,0 +1,208 @@
+package server
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+	"web-storage-service/internal/models"
+	"web-storage-service/internal/oidc"
+	"web-storage-service/pkg"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	oidcLoginStateTTL = 10 * time.Minute
+	// oidcStateCookie привязывает state к браузеру, начавшему вход: без нее злоумышленник
+	// мог бы подсунуть жертве ссылку на callback со своим code и войти ею в свой аккаунт
+	oidcStateCookie = "wss_oidc_state"
+	oidcStatePath   = "/api/auth/oidc"
+)
+
+// oidcStateHash значение cookie: хэш state, чтобы сама cookie не раскрывала state
+func oidcStateHash(state string) string {
+	hash := sha256.Sum256([]byte(state))
+	return base64.RawURLEncoding.EncodeToString(hash[:])
+}
+
+func setOIDCStateCookie(w http.ResponseWriter, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     oidcStatePath,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   true,
+		// Lax, чтобы cookie пришла с переходом обратно от провайдера
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// validOIDCStateCookie проверяет, что callback пришел в браузер, который начинал вход
+func validOIDCStateCookie(r *http.Request, state string) bool {
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(oidcStateHash(state))) == 1
+}
+
+func (s *Server) OIDCLoginHandler(w http.ResponseWriter, r *http.Request) {
+	if s.oidc == nil {
+		NotFoundError(w, r, "oidc provider")
+		return
+	}
+	ctx := r.Context()
+
+	cookie, ok := s.cookieLoginRequested(w, r)
+	if !ok {
+		return
+	}
+
+	state := models.OIDCLoginState{
+		State:        pkg.GenerateRandomID(32),
+		CodeVerifier: oidc.GenerateCodeVerifier(),
+		Nonce:        pkg.GenerateRandomID(16),
+		Cookie:       cookie,
+		ExpiresAt:    time.Now().Add(oidcLoginStateTTL),
+	}
+
+	redirectURL, err := s.oidc.AuthCodeURL(ctx, state.State, state.Nonce, state.CodeVerifier)
+	if err != nil {
+		InternalServerError(w, r, fmt.Errorf("building oidc redirect: %w", err))
+		return
+	}
+
+	if err = s.CreateOIDCLoginStateQuery(ctx, state); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	setOIDCStateCookie(w, oidcStateHash(state.State), int(oidcLoginStateTTL.Seconds()))
+	http.Redirect(w, r, redirectURL, http.StatusFound)
+}
+
+func (s *Server) OIDCCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	if s.oidc == nil {
+		NotFoundError(w, r, "oidc provider")
+		return
+	}
+	ctx := r.Context()
+	query := r.URL.Query()
+
+	if providerErr := query.Get("error"); providerErr != "" {
+		s.authFailure(authFailureOIDC)
+		UnauthorizedError(w, r, CodeOIDCLoginFailed, "oidc login failed: "+providerErr)
+		return
+	}
+
+	code, stateID := query.Get("code"), query.Get("state")
+	if code == "" || stateID == "" {
+		BadRequestError(w, r)
+		return
+	}
+
+	if !validOIDCStateCookie(r, stateID) {
+		s.authFailure(authFailureOIDC)
+		UnauthorizedError(w, r, CodeOIDCLoginFailed, "oidc login was started in another browser")
+		return
+	}
+	// cookie одноразовая, как и сам state
+	setOIDCStateCookie(w, "", -1)
+
+	state, err := s.ConsumeOIDCLoginStateQuery(ctx, stateID)
+	if err != nil {
+		s.authFailure(authFailureOIDC)
+		UnauthorizedError(w, r, CodeOIDCLoginFailed, "invalid or expired oidc state")
+		return
+	}
+
+	token, err := s.oidc.Exchange(ctx, code, state.CodeVerifier)
+	if err != nil {
+		slog.WarnContext(ctx, "error exchanging oidc code", "error", err)
+		s.authFailure(authFailureOIDC)
+		UnauthorizedError(w, r, CodeOIDCLoginFailed, "oidc login failed")
+		return
+	}
+
+	claims, err := s.oidc.VerifyIDToken(ctx, token.IDToken, state.Nonce)
+	if err != nil {
+		slog.WarnContext(ctx, "error verifying oidc id token", "error", err)
+		s.authFailure(authFailureOIDC)
+		UnauthorizedError(w, r, CodeOIDCLoginFailed, "oidc login failed")
+		return
+	}
+
+	user, err := s.userForOIDCClaims(r, claims)
+	if err != nil {
+		slog.ErrorContext(ctx, "error resolving oidc user", "error", err)
+		if errors.Is(err, errOIDCProvisioningDisabled) {
+			ForbiddenError(w, r, CodeForbidden, "account provisioning is disabled")
+			return
+		}
+		WriteError(w, r, err)
+		return
+	}
+
+	// Второй фактор в этом случае проверяет провайдер
+	s.respondWithToken(w, r, user, state.Cookie)
+}
+
+var errOIDCProvisioningDisabled = errors.New("oidc user is not linked and auto provisioning is disabled")
+
+// userForOIDCClaims находит пользователя, привязанного к учетной записи провайдера,
+// либо привязывает существующего или создает нового (just-in-time provisioning)
+func (s *Server) userForOIDCClaims(r *http.Request, claims oidc.IDTokenClaims) (models.User, error) {
+	ctx := r.Context()
+
+	user, err := s.GetUserByIdentityQuery(ctx, claims.Issuer, claims.Subject)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return user, err
+	}
+	if !s.cfg.OIDC.AutoProvision {
+		return user, errOIDCProvisioningDisabled
+	}
+
+	login := oidcLogin(claims)
+	// Привязываем к существующему логину только подтвержденный провайдером email,
+	// иначе любой пользователь IdP мог бы захватить чужую учетную запись
+	linkExisting := s.cfg.OIDC.LinkExisting && claims.EmailVerified && claims.Email != ""
+	if linkExisting {
+		login = claims.Email
+	}
+
+	userID, err := s.LinkOrProvisionUserWithTransaction(ctx, models.UserIdentity{
+		Issuer:  claims.Issuer,
+		Subject: claims.Subject,
+		Email:   claims.Email,
+	}, login, linkExisting)
+	if err != nil {
+		return user, err
+	}
+
+	return s.GetUserByIDQuery(ctx, userID)
+}
+
+func oidcLogin(claims oidc.IDTokenClaims) string {
+	login := claims.PreferredUsername
+	if login == "" {
+		login = claims.Email
+	}
+	if login == "" {
+		login = "oidc-" + claims.Subject
+	}
+	login = strings.TrimSpace(login)
+	if len(login) > 200 {
+		login = login[:200]
+	}
+	return login
+}
@@ -0,0 +1,471 @@
+package server
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"web-storage-service/internal/dto"
+	"web-storage-service/internal/models"
+)
+
+// apiOperation описание одного маршрута RegisterRoutes для /openapi.json. Схемы тел
+// строятся отражением из типов dto и models, поэтому меняются вместе с ними.
+type apiOperation struct {
+	// pattern ровно как в RegisterRoutes, например "POST /api/upload-asset/{name}"
+	pattern     string
+	tag         string
+	summary     string
+	description string
+	// auth маршрут требует токен; admin дополнительно роль администратора
+	auth  bool
+	admin bool
+	query []apiParam
+	// body значение типа JSON-тела запроса или rawContent для содержимого файла
+	body interface{}
+	// status код успешного ответа, response тип его тела (nil, если тела нет)
+	status   int
+	response interface{}
+	// errors коды ошибок кроме общих для всех маршрутов
+	errors []int
+}
+
+type apiParam struct {
+	name        string
+	kind        string
+	description string
+}
+
+// rawContent тело запроса или ответа с содержимым файла как есть
+type rawContent struct{}
+
+// textContent ответ text/plain
+type textContent struct{}
+
+// eventStream ответ text/event-stream
+type eventStream struct{}
+
+// oneOf тело ответа одного из нескольких видов
+type oneOf []interface{}
+
+// Типы ниже описывают ответы, которые обработчики собирают в map
+
+type statusResponse struct {
+	Status string `json:"status"`
+}
+
+type tokenResponse struct {
+	Token     string `json:"token,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresIn int64  `json:"expires_in,omitempty"`
+	// CSRFToken вместо token при входе с ?cookie=true
+	CSRFToken string `json:"csrf_token,omitempty"`
+}
+
+type twoFactorChallenge struct {
+	TwoFactorRequired bool      `json:"two_factor_required"`
+	Challenge         string    `json:"challenge"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
+
+type assetPage struct {
+	Page    int                `json:"page"`
+	Size    int                `json:"size"`
+	Assets  []models.AssetInfo `json:"assets"`
+	HasMore bool               `json:"hasMore"`
+}
+
+type assetContentPage struct {
+	Page int `json:"page"`
+	Size int `json:"size"`
+	// Assets имя файла -> содержимое без переводов строк, табуляций, \ и "
+	Assets  map[string]string `json:"assets"`
+	HasMore bool              `json:"hasMore"`
+}
+
+type userPage struct {
+	Page    int           `json:"page"`
+	Size    int           `json:"size"`
+	Users   []models.User `json:"users"`
+	HasMore bool          `json:"hasMore"`
+}
+
+type createdAPIKey struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Key       string     `json:"key"`
+	Scopes    []string   `json:"scopes"`
+	Prefix    string     `json:"prefix"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type apiKeyList struct {
+	Keys []models.APIKey `json:"keys"`
+}
+
+type totpEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+type totpEnabled struct {
+	Status        string   `json:"status"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type lockoutList struct {
+	Lockouts []models.LoginAttempt `json:"lockouts"`
+}
+
+type unlockResponse struct {
+	Status  string `json:"status"`
+	Removed int64  `json:"removed"`
+}
+
+type adminUserStatus struct {
+	ID     int    `json:"id"`
+	Status string `json:"status"`
+}
+
+type adminUserRole struct {
+	ID   int    `json:"id"`
+	Role string `json:"role"`
+}
+
+type readiness struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+type healthReport struct {
+	Status   string            `json:"status"`
+	Checks   []checkResult     `json:"checks"`
+	Database map[string]string `json:"database"`
+}
+
+var (
+	pageParams  = []apiParam{{"page", "integer", "page number starting from 1"}, {"size", "integer", "page size, 10 by default, at most 100"}}
+	cookieParam = apiParam{"cookie", "boolean", "keep the token in an HttpOnly cookie and return only a CSRF token (AUTH_COOKIE_SESSIONS)"}
+	prefixParam = apiParam{"prefix", "string", "only assets whose names start with the prefix"}
+	sinceParam  = apiParam{"since", "integer", "cursor returned by the previous response"}
+	// assetStatus ответ вида {"<user id>": name, "status": "..."}
+	assetStatus = map[string]string{}
+)
+
+// apiOperations все маршруты API. RegisterRoutes сверяет этот список с
+// зарегистрированными шаблонами и не запускается, если они расходятся.
+var apiOperations = []apiOperation{
+	{pattern: "GET /health", tag: "health", summary: "Detailed health report", admin: true, status: http.StatusOK, response: healthReport{}, errors: []int{http.StatusServiceUnavailable}},
+	{pattern: "GET /livez", tag: "health", summary: "Liveness probe", status: http.StatusOK, response: statusResponse{}},
+	{pattern: "GET /readyz", tag: "health", summary: "Readiness probe", status: http.StatusOK, response: readiness{}, errors: []int{http.StatusServiceUnavailable}},
+	{pattern: "GET /metrics", tag: "health", summary: "Prometheus metrics", description: "Requires `Authorization: Bearer <METRICS_TOKEN>` when METRICS_TOKEN is set. Without a token it returns 403 unless METRICS_PUBLIC is set.", status: http.StatusOK, response: textContent{}, errors: []int{http.StatusUnauthorized, http.StatusForbidden}},
+
+	{pattern: "POST /api/auth", tag: "auth", summary: "Sign in with login and password", description: "Returns a token, or a two-factor challenge when 2FA is enabled.", query: []apiParam{cookieParam}, body: dto.Credentials{}, status: http.StatusOK, response: oneOf{tokenResponse{}, twoFactorChallenge{}}, errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests}},
+	{pattern: "POST /api/auth/2fa", tag: "auth", summary: "Complete sign in with a TOTP or recovery code", query: []apiParam{cookieParam}, body: dto.CompleteTwoFactorLogin{}, status: http.StatusOK, response: tokenResponse{}, errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusTooManyRequests}},
+	{pattern: "GET /api/auth/oidc/login", tag: "auth", summary: "Start OpenID Connect sign in", description: "Redirects to the identity provider.", query: []apiParam{cookieParam}, status: http.StatusFound, errors: []int{http.StatusNotFound}},
+	{pattern: "GET /api/auth/oidc/callback", tag: "auth", summary: "OpenID Connect redirect target", query: []apiParam{{"code", "string", "authorization code"}, {"state", "string", "state from the login redirect"}}, status: http.StatusOK, response: tokenResponse{}, errors: []int{http.StatusBadRequest, http.StatusUnauthorized}},
+	{pattern: "POST /api/logout", tag: "auth", summary: "End the current session or revoke the current JWT", auth: true, status: http.StatusOK, response: statusResponse{}},
+	{pattern: "GET /.well-known/jwks.json", tag: "auth", summary: "Public keys for JWT verification", status: http.StatusOK, response: map[string]interface{}{}},
+
+	{pattern: "POST /api/upload-asset/{name}", tag: "assets", summary: "Create an asset", description: "Returns 201 with Location and ETag; 200 when an existing asset is replaced with overwrite.", auth: true, query: []apiParam{{"overwrite", "boolean", "replace an existing asset"}}, body: rawContent{}, status: http.StatusCreated, response: models.AssetInfo{}, errors: []int{http.StatusBadRequest, http.StatusConflict}},
+	{pattern: "PUT /api/update-asset/{name}", tag: "assets", summary: "Replace the content of an asset", auth: true, query: []apiParam{{"upsert", "boolean", "create the asset if it does not exist (201)"}}, body: rawContent{}, status: http.StatusOK, response: models.AssetInfo{}, errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{pattern: "GET /api/asset/{name}", tag: "assets", summary: "Download an asset", description: "Returns `{name: content}` as JSON, or the content as an attachment with raw=true.", auth: true, query: []apiParam{{"raw", "boolean", "return the content as application/octet-stream"}}, status: http.StatusOK, response: oneOf{map[string]string{}, rawContent{}}, errors: []int{http.StatusNotFound}},
+	{pattern: "PUT /api/delete-asset/{name}", tag: "assets", summary: "Move an asset to the trash", auth: true, status: http.StatusOK, response: assetStatus, errors: []int{http.StatusNotFound}},
+	{pattern: "DELETE /api/delete-asset/{name}", tag: "assets", summary: "Delete an asset permanently", auth: true, status: http.StatusOK, response: assetStatus, errors: []int{http.StatusNotFound}},
+	{pattern: "GET /api/assets", tag: "assets", summary: "List assets", description: "With details=true returns metadata instead of content.", auth: true, query: append([]apiParam{prefixParam, {"details", "boolean", "return metadata instead of content"}}, pageParams...), status: http.StatusOK, response: oneOf{assetContentPage{}, assetPage{}}},
+	{pattern: "POST /api/rename-asset/{name}", tag: "assets", summary: "Rename or move an asset", auth: true, body: dto.RenameAsset{}, status: http.StatusOK, response: models.AssetInfo{}, errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+	{pattern: "POST /api/copy-asset/{name}", tag: "assets", summary: "Copy an asset", description: "Returns 201 for a new asset and 200 when an existing one was overwritten.", auth: true, body: dto.CopyAsset{}, status: http.StatusCreated, response: models.AssetInfo{}, errors: []int{http.StatusBadRequest, http.StatusNotFound, http.StatusConflict}},
+	{pattern: "POST /api/restore-asset/{name}", tag: "assets", summary: "Restore an asset from the trash", auth: true, status: http.StatusOK, response: assetStatus, errors: []int{http.StatusNotFound}},
+	{pattern: "GET /api/trash", tag: "assets", summary: "List assets in the trash", auth: true, query: append([]apiParam{prefixParam}, pageParams...), status: http.StatusOK, response: assetPage{}},
+	{pattern: "GET /api/changes", tag: "changes", summary: "Read asset changes after a cursor", description: "Long-polls until an event arrives or wait expires. Without since returns the current cursor and no events. 410 cursor_expired means the events were removed after CHANGES_RETENTION: list the assets again.", auth: true, query: []apiParam{sinceParam, {"wait", "integer", "seconds to wait for new events, 30 by default, at most CHANGES_MAX_WAIT"}, prefixParam, {"size", "integer", "events per response, 100 by default"}}, status: http.StatusOK, response: changesPage{}, errors: []int{http.StatusBadRequest, http.StatusGone}},
+	{pattern: "GET /api/changes/stream", tag: "changes", summary: "Stream asset changes as Server-Sent Events", description: "Each event has the seq as id and the event type as name; data is the event as JSON. Resumes from the Last-Event-ID header when it is sent.", auth: true, query: []apiParam{sinceParam, prefixParam}, status: http.StatusOK, response: eventStream{}, errors: []int{http.StatusBadRequest, http.StatusGone}},
+
+	{pattern: "POST /api/share-asset/{name}", tag: "shares", summary: "Create a public download link", description: "Requires the assets:write scope.", auth: true, body: dto.CreateShareLink{}, status: http.StatusCreated, response: shareLinkResponse{}, errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{pattern: "GET /api/shares", tag: "shares", summary: "List active share links", auth: true, status: http.StatusOK, response: []shareLinkResponse{}},
+	{pattern: "DELETE /api/shares/{id}", tag: "shares", summary: "Revoke a share link", description: "Requires the assets:write scope.", auth: true, status: http.StatusNoContent, errors: []int{http.StatusNotFound}},
+	{pattern: "GET /s/{id}", tag: "shares", summary: "Download a shared asset without signing in", status: http.StatusOK, response: rawContent{}, errors: []int{http.StatusNotFound}},
+
+	{pattern: "POST /api/keys", tag: "api keys", summary: "Create an API key", description: "The key is returned only once.", auth: true, body: dto.CreateAPIKey{}, status: http.StatusCreated, response: createdAPIKey{}, errors: []int{http.StatusBadRequest, http.StatusConflict}},
+	{pattern: "GET /api/keys", tag: "api keys", summary: "List API keys", auth: true, status: http.StatusOK, response: apiKeyList{}},
+	{pattern: "DELETE /api/keys/{id}", tag: "api keys", summary: "Revoke an API key", auth: true, status: http.StatusOK, response: statusResponse{}, errors: []int{http.StatusNotFound}},
+
+	{pattern: "POST /api/2fa/enroll", tag: "2fa", summary: "Generate a TOTP secret", auth: true, status: http.StatusOK, response: totpEnrollment{}, errors: []int{http.StatusConflict}},
+	{pattern: "POST /api/2fa/confirm", tag: "2fa", summary: "Enable 2FA with a code from the authenticator", auth: true, body: dto.TOTPCode{}, status: http.StatusOK, response: totpEnabled{}, errors: []int{http.StatusBadRequest, http.StatusUnauthorized}},
+	{pattern: "POST /api/2fa/disable", tag: "2fa", summary: "Disable 2FA", auth: true, body: dto.TOTPCode{}, status: http.StatusOK, response: statusResponse{}, errors: []int{http.StatusBadRequest, http.StatusUnauthorized}},
+
+	{pattern: "GET /api/admin/lockouts", tag: "admin", summary: "List locked logins and IPs", admin: true, status: http.StatusOK, response: lockoutList{}},
+	{pattern: "DELETE /api/admin/lockouts", tag: "admin", summary: "Unlock a login or IP", admin: true, query: []apiParam{{"login", "string", "login to unlock"}, {"ip", "string", "client IP to unlock"}}, status: http.StatusOK, response: unlockResponse{}, errors: []int{http.StatusBadRequest}},
+	{pattern: "GET /api/admin/users", tag: "admin", summary: "List users", admin: true, query: append([]apiParam{{"q", "string", "login substring"}, {"role", "string", "admin, user or read-only"}}, pageParams...), status: http.StatusOK, response: userPage{}},
+	{pattern: "GET /api/admin/users/{id}", tag: "admin", summary: "Get a user", admin: true, status: http.StatusOK, response: models.User{}, errors: []int{http.StatusNotFound}},
+	{pattern: "POST /api/admin/users/{id}/disable", tag: "admin", summary: "Disable a user and end their sessions", admin: true, status: http.StatusOK, response: adminUserStatus{}, errors: []int{http.StatusNotFound}},
+	{pattern: "POST /api/admin/users/{id}/enable", tag: "admin", summary: "Enable a user", admin: true, status: http.StatusOK, response: adminUserStatus{}, errors: []int{http.StatusNotFound}},
+	{pattern: "PUT /api/admin/users/{id}/role", tag: "admin", summary: "Change a user's role", admin: true, body: dto.SetUserRole{}, status: http.StatusOK, response: adminUserRole{}, errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{pattern: "PUT /api/admin/users/{id}/password", tag: "admin", summary: "Reset a user's password", admin: true, body: dto.ResetPassword{}, status: http.StatusOK, response: adminUserStatus{}, errors: []int{http.StatusBadRequest, http.StatusNotFound}},
+	{pattern: "DELETE /api/admin/users/{id}/sessions", tag: "admin", summary: "Sign a user out everywhere", admin: true, status: http.StatusOK, response: adminUserStatus{}, errors: []int{http.StatusNotFound}},
+	{pattern: "GET /api/admin/users/{id}/assets", tag: "admin", summary: "List a user's assets including the trash", admin: true, query: append([]apiParam{prefixParam}, pageParams...), status: http.StatusOK, response: assetPage{}},
+	{pattern: "GET /api/admin/users/{id}/usage", tag: "admin", summary: "Storage and access summary for a user", admin: true, status: http.StatusOK, response: models.Usage{}, errors: []int{http.StatusNotFound}},
+}
+
+// OpenAPIHandler отдает документ, собранный один раз при регистрации маршрутов
+func (s *Server) OpenAPIHandler() http.HandlerFunc {
+	document, err := json.MarshalIndent(s.openAPIDocument(), "", "  ")
+	if err != nil {
+		panic(err)
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		if _, err := w.Write(document); err != nil {
+			slog.WarnContext(r.Context(), "error writing response", "error", err)
+		}
+	}
+}
+
+// openAPIDocument собирает документ OpenAPI 3.1 из apiOperations
+func (s *Server) openAPIDocument() map[string]interface{} {
+	schemas := make(map[string]interface{})
+	paths := make(map[string]map[string]interface{})
+
+	securitySchemes := map[string]interface{}{
+		"bearerAuth": map[string]interface{}{
+			"type":        "http",
+			"scheme":      "bearer",
+			"description": "Session token, JWT or API key",
+		},
+	}
+	security := []interface{}{map[string]interface{}{"bearerAuth": []string{}}}
+	if s.cfg.Auth.CookieSessions {
+		securitySchemes["cookieAuth"] = map[string]interface{}{
+			"type":        "apiKey",
+			"in":          "cookie",
+			"name":        s.cfg.Auth.CookieName,
+			"description": "Session cookie from a sign in with ?cookie=true; unsafe methods also need the " + CSRFHeader + " header",
+		}
+		security = append(security, map[string]interface{}{"cookieAuth": []string{}})
+	}
+
+	for _, op := range apiOperations {
+		method, path, _ := strings.Cut(op.pattern, " ")
+		operation := map[string]interface{}{
+			"tags":        []string{op.tag},
+			"summary":     op.summary,
+			"operationId": operationID(method, path),
+		}
+		description := op.description
+		if op.admin {
+			description = strings.TrimSpace("Requires the admin role. " + description)
+		}
+		if description != "" {
+			operation["description"] = description
+		}
+
+		var params []interface{}
+		for _, name := range pathParams(path) {
+			params = append(params, map[string]interface{}{
+				"name": name, "in": "path", "required": true, "schema": map[string]interface{}{"type": "string"},
+			})
+		}
+		for _, p := range op.query {
+			params = append(params, map[string]interface{}{
+				"name": p.name, "in": "query", "description": p.description, "schema": map[string]interface{}{"type": p.kind},
+			})
+		}
+		if len(params) > 0 {
+			operation["parameters"] = params
+		}
+
+		if op.body != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": !isRaw(op.body),
+				"content":  contentOf(op.body, schemas),
+			}
+		}
+
+		responses := map[string]interface{}{}
+		success := map[string]interface{}{"description": http.StatusText(op.status)}
+		if op.response != nil {
+			success["content"] = contentOf(op.response, schemas)
+		}
+		responses[strconv.Itoa(op.status)] = success
+
+		codes := slices.Clone(op.errors)
+		if op.auth || op.admin {
+			codes = append(codes, http.StatusUnauthorized, http.StatusForbidden)
+			operation["security"] = security
+		}
+		for _, code := range codes {
+			responses[strconv.Itoa(code)] = map[string]interface{}{"$ref": "#/components/responses/Problem"}
+		}
+		responses["default"] = map[string]interface{}{"$ref": "#/components/responses/Problem"}
+		operation["responses"] = responses
+
+		if paths[path] == nil {
+			paths[path] = make(map[string]interface{})
+		}
+		paths[path][strings.ToLower(method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.1.0",
+		"info": map[string]interface{}{
+			"title":       "web-storage-service",
+			"version":     "1.0.0",
+			"description": "Per-user asset storage. Errors are application/problem+json (RFC 9457) with a stable `code`.",
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas":         schemas,
+			"securitySchemes": securitySchemes,
+			"responses": map[string]interface{}{
+				"Problem": map[string]interface{}{
+					"description": "Error",
+					"content": map[string]interface{}{
+						ProblemContentType: map[string]interface{}{"schema": schemaOf(reflect.TypeOf(problem{}), schemas)},
+					},
+				},
+			},
+		},
+	}
+}
+
+func operationID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool { return r == '/' || r == '-' || r == '.' || r == '{' || r == '}' }) {
+		b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return b.String()
+}
+
+func pathParams(path string) []string {
+	var names []string
+	for _, segment := range strings.Split(path, "/") {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			names = append(names, strings.TrimSuffix(strings.Trim(segment, "{}"), "..."))
+		}
+	}
+	return names
+}
+
+func isRaw(v interface{}) bool {
+	_, ok := v.(rawContent)
+	return ok
+}
+
+// contentOf описывает тело с типом v по media type
+func contentOf(v interface{}, schemas map[string]interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case rawContent:
+		return map[string]interface{}{"application/octet-stream": map[string]interface{}{
+			"schema": map[string]interface{}{"type": "string", "contentMediaType": "application/octet-stream"},
+		}}
+	case textContent:
+		return map[string]interface{}{"text/plain": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}}
+	case eventStream:
+		return map[string]interface{}{"text/event-stream": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}}
+	case oneOf:
+		content := make(map[string]interface{})
+		var variants []interface{}
+		for _, variant := range v {
+			for mediaType, media := range contentOf(variant, schemas) {
+				if mediaType != "application/json" {
+					content[mediaType] = media
+					continue
+				}
+				variants = append(variants, media.(map[string]interface{})["schema"])
+			}
+		}
+		switch len(variants) {
+		case 0:
+		case 1:
+			content["application/json"] = map[string]interface{}{"schema": variants[0]}
+		default:
+			content["application/json"] = map[string]interface{}{"schema": map[string]interface{}{"oneOf": variants}}
+		}
+		return content
+	}
+	return map[string]interface{}{"application/json": map[string]interface{}{"schema": schemaOf(reflect.TypeOf(v), schemas)}}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaOf строит JSON Schema для t по тем же правилам, что encoding/json.
+// Структуры попадают в components/schemas и возвращаются ссылкой.
+func schemaOf(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Pointer:
+		schema := schemaOf(t.Elem(), schemas)
+		if kind, ok := schema["type"].(string); ok {
+			schema["type"] = []string{kind, "null"}
+			return schema
+		}
+		return map[string]interface{}{"oneOf": []interface{}{schema, map[string]interface{}{"type": "null"}}}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": schemaOf(t.Elem(), schemas)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem(), schemas)}
+	case reflect.Struct:
+		name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+		if _, ok := schemas[name]; !ok {
+			// заглушка на случай рекурсивных типов
+			schemas[name] = map[string]interface{}{}
+			schemas[name] = structSchema(t, schemas)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]interface{}{}
+}
+
+func structSchema(t reflect.Type, schemas map[string]interface{}) map[string]interface{} {
+	properties := make(map[string]interface{})
+	var required []string
+	var collect func(t reflect.Type)
+	collect = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			tag := field.Tag.Get("json")
+			if tag == "-" || !field.IsExported() && !field.Anonymous {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			// встроенная структура без тега раскрывается в поля внешней, как в encoding/json
+			if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+				collect(field.Type)
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			properties[name] = schemaOf(field.Type, schemas)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+	}
+	collect(t)
+
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"web-storage-service/internal/config"
+)
+
+// undocumentedRoutes страницы и сам документ OpenAPI, которые в нем не описываются
+var undocumentedRoutes = []string{"GET /ui/", "GET /ui/config.json", "GET /{$}", "GET /openapi.json", "GET /docs/", "GET /docs"}
+
+// openAPIFromRoutes регистрирует все маршруты и получает документ через GET /openapi.json
+func openAPIFromRoutes(t *testing.T) (*routeMux, map[string]interface{}) {
+	t.Helper()
+	s := &Server{cfg: config.Config{Web: config.WebConfig{UIEnabled: true, DocsEnabled: true}}}
+	r := s.routes()
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /openapi.json = %d", rec.Code)
+	}
+	var document map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &document); err != nil {
+		t.Fatal(err)
+	}
+	return r, document
+}
+
+func TestOpenAPIMatchesRoutes(t *testing.T) {
+	r, document := openAPIFromRoutes(t)
+
+	var documented []string
+	for path, item := range document["paths"].(map[string]interface{}) {
+		for method := range item.(map[string]interface{}) {
+			documented = append(documented, strings.ToUpper(method)+" "+path)
+		}
+	}
+
+	for _, pattern := range r.patterns {
+		if !slices.Contains(documented, pattern) && !slices.Contains(undocumentedRoutes, pattern) {
+			t.Errorf("route %q is registered but missing from apiOperations", pattern)
+		}
+	}
+	for _, operation := range documented {
+		if !slices.Contains(r.patterns, operation) {
+			t.Errorf("operation %q is documented but not registered", operation)
+		}
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	_, document := openAPIFromRoutes(t)
+
+	if document["openapi"] != "3.1.0" {
+		t.Errorf("openapi = %v", document["openapi"])
+	}
+
+	ids := make(map[string]string)
+	for path, item := range document["paths"].(map[string]interface{}) {
+		for method, op := range item.(map[string]interface{}) {
+			operation := op.(map[string]interface{})
+			id, _ := operation["operationId"].(string)
+			if id == "" {
+				t.Errorf("%s %s has no operationId", method, path)
+			} else if other, ok := ids[id]; ok {
+				t.Errorf("operationId %q used by %s and %s %s", id, other, method, path)
+			}
+			ids[id] = method + " " + path
+
+			if _, ok := operation["responses"].(map[string]interface{})["default"]; !ok {
+				t.Errorf("%s %s has no default response", method, path)
+			}
+		}
+	}
+
+	// каждая ссылка $ref должна указывать на существующий компонент
+	raw, err := json.Marshal(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	components := document["components"].(map[string]interface{})
+	for _, match := range regexp.MustCompile(`"\$ref":"#/components/(\w+)/([^"]+)"`).FindAllStringSubmatch(string(raw), -1) {
+		group, _ := components[match[1]].(map[string]interface{})
+		if _, ok := group[match[2]]; !ok {
+			t.Errorf("dangling $ref #/components/%s/%s", match[1], match[2])
+		}
+	}
+}
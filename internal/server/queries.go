@@ -2,18 +2,23 @@ package server
 
 import (
 	"context"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 	"web-storage-service/internal/dto"
 	"web-storage-service/internal/models"
+	"web-storage-service/pkg"
 
 	"github.com/jackc/pgx/v5"
 )
 
 func (s *Server) ListAssetsQuery(ctx context.Context, dto dto.ListAssets) (pgx.Rows, error) {
-	query := `SELECT name, data FROM assets WHERE uid=$1 AND deleted=FALSE LIMIT $2 OFFSET $3`
-	return s.db.Query(ctx, query, dto.UserID, dto.Limit, dto.Offset)
+	query := `SELECT name, data FROM assets WHERE uid=$1 AND deleted=FALSE AND starts_with(name, $4) ORDER BY name LIMIT $2 OFFSET $3`
+	return s.db.Query(ctx, query, dto.UserID, dto.Limit, dto.Offset, dto.Prefix)
 }
 
 func (s *Server) GetAssetByNameQuery(ctx context.Context, dto dto.GetAssetByName) ([]byte, error) {
@@ -23,49 +28,383 @@ func (s *Server) GetAssetByNameQuery(ctx context.Context, dto dto.GetAssetByName
 	return data, err
 }
 
-func (s *Server) UploadAssetQuery(ctx context.Context, name string, userID int, data []byte) error {
-	query := `
-        INSERT INTO assets (name, uid, data, created_at) 
-        VALUES ($1, $2, $3, NOW())
-        ON CONFLICT (name, uid) 
-        DO NOTHING;
+// assetInfoColumns колонки assets в порядке, который ожидает scanAssetInfo
+const assetInfoColumns = `name, octet_length(data), sha256, created_at, updated_at, deleted`
+
+func scanAssetInfo(row pgx.Row, extra ...interface{}) (models.AssetInfo, error) {
+	var asset models.AssetInfo
+	dest := append([]interface{}{&asset.Name, &asset.Size, &asset.SHA256, &asset.CreatedAt, &asset.UpdatedAt, &asset.Deleted}, extra...)
+	err := row.Scan(dest...)
+	return asset, err
+}
+
+// upsertAssetQuery общий запрос UploadAssetWithTransaction и CopyAssetWithTransaction:
+// $1 имя, $2 uid, $3 содержимое, $4 перезаписывать ли живой файл
+const upsertAssetQuery = `
+        WITH prev AS (
+            SELECT deleted FROM assets WHERE name = $1 AND uid = $2
+        )
+        INSERT INTO assets (name, uid, data, sha256, created_at, updated_at)
+        VALUES ($1, $2, $3, encode(sha256($3), 'hex'), NOW(), NOW())
+        ON CONFLICT (name, uid)
+        DO UPDATE SET data = EXCLUDED.data, sha256 = EXCLUDED.sha256, updated_at = EXCLUDED.updated_at, deleted = FALSE,
+            created_at = CASE WHEN assets.deleted THEN EXCLUDED.created_at ELSE assets.created_at END
+        WHERE assets.deleted OR $4
+        RETURNING ` + assetInfoColumns + `, NOT EXISTS (SELECT 1 FROM prev WHERE NOT prev.deleted)
     `
-	_, err := s.db.Exec(ctx, query, name, userID, data)
+
+// UploadAssetWithTransaction создает файл. Если живой файл с таким именем уже есть, без Overwrite
+// возвращает pgx.ErrNoRows, с Overwrite заменяет его. Мягко удаленный файл считается
+// отсутствующим. created сообщает, что файла до запроса не было.
+func (s *Server) UploadAssetWithTransaction(ctx context.Context, dto dto.PutAsset) (asset models.AssetInfo, created bool, err error) {
+	tx, err := s.db.BeginTx(ctx)
+	if err != nil {
+		return asset, false, err
+	}
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(ctx); rollbackErr != nil {
+				slog.ErrorContext(ctx, "tx rollback error", "error", rollbackErr)
+			}
+		}
+	}()
+
+	asset, err = scanAssetInfo(tx.QueryRow(ctx, upsertAssetQuery, dto.Name, dto.UserID, dto.Data, dto.Overwrite), &created)
+	if err != nil {
+		return asset, false, err
+	}
+	if err = insertAssetEvents(ctx, tx, dto.UserID, putEvent(asset, created)); err != nil {
+		return asset, false, err
+	}
+
+	return asset, created, tx.Commit(ctx)
+}
+
+// UpdateAssetWithTransaction заменяет содержимое существующего файла; если файла нет, возвращает pgx.ErrNoRows
+func (s *Server) UpdateAssetWithTransaction(ctx context.Context, dto dto.PutAsset) (asset models.AssetInfo, err error) {
+	tx, err := s.db.BeginTx(ctx)
+	if err != nil {
+		return asset, err
+	}
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(ctx); rollbackErr != nil {
+				slog.ErrorContext(ctx, "tx rollback error", "error", rollbackErr)
+			}
+		}
+	}()
+
+	asset, err = scanAssetInfo(tx.QueryRow(ctx, `
+        UPDATE assets SET data = $3, sha256 = encode(sha256($3), 'hex'), updated_at = NOW()
+        WHERE name = $1 AND uid = $2 AND deleted = FALSE
+        RETURNING `+assetInfoColumns, dto.Name, dto.UserID, dto.Data))
+	if err != nil {
+		return asset, err
+	}
+	if err = insertAssetEvents(ctx, tx, dto.UserID, putEvent(asset, false)); err != nil {
+		return asset, err
+	}
+
+	return asset, tx.Commit(ctx)
+}
+
+// SoftDeleteAssetWithTransaction возвращает false, если живого файла с таким именем нет
+func (s *Server) SoftDeleteAssetWithTransaction(ctx context.Context, dto dto.DeleteAsset) (deleted bool, err error) {
+	tx, err := s.db.BeginTx(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(ctx); rollbackErr != nil {
+				slog.ErrorContext(ctx, "tx rollback error", "error", rollbackErr)
+			}
+		}
+	}()
+
+	tag, err := tx.Exec(ctx, `UPDATE assets SET deleted = TRUE WHERE name = $1 AND uid = $2 AND deleted = FALSE`, dto.Name, dto.UserID)
+	if err != nil {
+		return false, err
+	}
+	if tag.RowsAffected() == 0 {
+		return false, tx.Rollback(ctx)
+	}
+	err = insertAssetEvents(ctx, tx, dto.UserID, models.AssetEvent{Type: models.AssetEventDelete, Name: dto.Name})
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+// HardDeleteAssetWithTransaction удаляет файл, в том числе мягко удаленный, вместе с его ссылками; false, если его нет
+func (s *Server) HardDeleteAssetWithTransaction(ctx context.Context, dto dto.DeleteAsset) (deleted bool, err error) {
+	tx, err := s.db.BeginTx(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(ctx); rollbackErr != nil {
+				slog.ErrorContext(ctx, "tx rollback error", "error", rollbackErr)
+			}
+		}
+	}()
+
+	tag, err := tx.Exec(ctx, `
+        WITH links AS (
+            DELETE FROM share_links WHERE name = $1 AND uid = $2
+        )
+        DELETE FROM assets WHERE name = $1 AND uid = $2
+    `, dto.Name, dto.UserID)
+	if err != nil {
+		return false, err
+	}
+	if tag.RowsAffected() == 0 {
+		return false, tx.Rollback(ctx)
+	}
+	err = insertAssetEvents(ctx, tx, dto.UserID, models.AssetEvent{Type: models.AssetEventDelete, Name: dto.Name, Permanent: true})
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+// RestoreAssetWithTransaction возвращает файл из корзины; false, если мягко удаленного файла с таким именем нет
+func (s *Server) RestoreAssetWithTransaction(ctx context.Context, dto dto.DeleteAsset) (restored bool, err error) {
+	tx, err := s.db.BeginTx(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(ctx); rollbackErr != nil {
+				slog.ErrorContext(ctx, "tx rollback error", "error", rollbackErr)
+			}
+		}
+	}()
+
+	asset, err := scanAssetInfo(tx.QueryRow(ctx, `
+        UPDATE assets SET deleted = FALSE WHERE name = $1 AND uid = $2 AND deleted = TRUE
+        RETURNING `+assetInfoColumns, dto.Name, dto.UserID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, tx.Rollback(ctx)
+	}
+	if err != nil {
+		return false, err
+	}
+	event := models.AssetEvent{Type: models.AssetEventRestore, Name: asset.Name, SHA256: asset.SHA256, Size: asset.Size}
+	if err = insertAssetEvents(ctx, tx, dto.UserID, event); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+// RenameAssetWithTransaction переименовывает живой файл вместе с его ссылками. Мягко удаленный
+// файл с новым именем удаляется окончательно; если файла нет, возвращает pgx.ErrNoRows,
+// если живой файл с новым именем уже есть, ошибку unique violation.
+// В ленте переименование выглядит как удаление старого имени и создание нового.
+func (s *Server) RenameAssetWithTransaction(ctx context.Context, dto dto.RenameAsset) (asset models.AssetInfo, err error) {
+	tx, err := s.db.BeginTx(ctx)
+	if err != nil {
+		return asset, err
+	}
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(ctx); rollbackErr != nil {
+				slog.ErrorContext(ctx, "tx rollback error", "error", rollbackErr)
+			}
+		}
+	}()
+
+	tag, err := tx.Exec(ctx, `
+        WITH links AS (
+            DELETE FROM share_links l USING assets a
+            WHERE l.uid = a.uid AND l.name = a.name AND a.name = $1 AND a.uid = $2 AND a.deleted = TRUE
+        )
+        DELETE FROM assets WHERE name = $1 AND uid = $2 AND deleted = TRUE
+    `, dto.NewName, dto.UserID)
+	if err != nil {
+		return asset, err
+	}
+	var events []models.AssetEvent
+	if tag.RowsAffected() > 0 {
+		events = append(events, models.AssetEvent{Type: models.AssetEventDelete, Name: dto.NewName, Permanent: true})
+	}
+
+	asset, err = scanAssetInfo(tx.QueryRow(ctx, `
+        UPDATE assets SET name = $3, updated_at = NOW()
+        WHERE name = $1 AND uid = $2 AND deleted = FALSE
+        RETURNING `+assetInfoColumns, dto.Name, dto.UserID, dto.NewName))
+	if err != nil {
+		return asset, err
+	}
+
+	_, err = tx.Exec(ctx, `UPDATE share_links SET name = $3 WHERE name = $1 AND uid = $2`, dto.Name, dto.UserID, dto.NewName)
+	if err != nil {
+		return asset, err
+	}
+
+	events = append(events,
+		models.AssetEvent{Type: models.AssetEventDelete, Name: dto.Name, Permanent: true},
+		putEvent(asset, true))
+	if err = insertAssetEvents(ctx, tx, dto.UserID, events...); err != nil {
+		return asset, err
+	}
+
+	return asset, tx.Commit(ctx)
+}
+
+// errAssetExists имя занято живым файлом, а перезапись не запрошена
+var errAssetExists = errors.New("asset already exists")
+
+// CopyAssetWithTransaction копирует файл под новым именем: pgx.ErrNoRows, если исходного
+// файла нет, errAssetExists, если новое имя занято, а Overwrite не задан
+func (s *Server) CopyAssetWithTransaction(ctx context.Context, dto dto.CopyAsset) (asset models.AssetInfo, created bool, err error) {
+	tx, err := s.db.BeginTx(ctx)
+	if err != nil {
+		return asset, false, err
+	}
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(ctx); rollbackErr != nil {
+				slog.ErrorContext(ctx, "tx rollback error", "error", rollbackErr)
+			}
+		}
+	}()
+
+	var data []byte
+	err = tx.QueryRow(ctx, `SELECT data FROM assets WHERE name = $1 AND uid = $2 AND deleted = FALSE FOR SHARE`, dto.Name, dto.UserID).Scan(&data)
+	if err != nil {
+		return asset, false, err
+	}
+
+	asset, err = scanAssetInfo(tx.QueryRow(ctx, upsertAssetQuery, dto.NewName, dto.UserID, data, dto.Overwrite), &created)
+	if errors.Is(err, pgx.ErrNoRows) {
+		err = errAssetExists
+	}
+	if err != nil {
+		return asset, false, err
+	}
+	if err = insertAssetEvents(ctx, tx, dto.UserID, putEvent(asset, created)); err != nil {
+		return asset, false, err
+	}
+
+	return asset, created, tx.Commit(ctx)
+}
+
+// assetEventsChannel канал NOTIFY ленты изменений; в уведомлении id пользователя
+const assetEventsChannel = "asset_events"
+
+// putEvent событие записи содержимого: create для нового файла, update для замены
+func putEvent(asset models.AssetInfo, created bool) models.AssetEvent {
+	event := models.AssetEvent{Type: models.AssetEventUpdate, Name: asset.Name, SHA256: asset.SHA256, Size: asset.Size}
+	if created {
+		event.Type = models.AssetEventCreate
+	}
+	return event
+}
+
+// insertAssetEvents добавляет события в ленту пользователя в транзакции изменения.
+// Счетчик в users держит блокировку строки до коммита, так что seq пользователя
+// становятся видны строго по возрастанию. NOTIFY Postgres доставит после коммита.
+func insertAssetEvents(ctx context.Context, tx pgx.Tx, userID int, events ...models.AssetEvent) error {
+	var last int64
+	err := tx.QueryRow(ctx, `UPDATE users SET asset_event_seq = asset_event_seq + $2 WHERE id = $1 RETURNING asset_event_seq`, userID, len(events)).Scan(&last)
+	if err != nil {
+		return err
+	}
+
+	first := last - int64(len(events)) + 1
+	for i, event := range events {
+		_, err = tx.Exec(ctx, `
+            INSERT INTO asset_events (uid, seq, type, name, sha256, size, permanent)
+            VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7)
+        `, userID, first+int64(i), event.Type, event.Name, event.SHA256, event.Size, event.Permanent)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(ctx, `SELECT pg_notify($1, $2)`, assetEventsChannel, strconv.Itoa(userID))
 	return err
 }
 
-func (s *Server) UpdateAssetQuery(ctx context.Context, name string, userID int, data []byte) error {
+// assetEventColumns колонки asset_events в порядке, который ожидает scanAssetEvent
+const assetEventColumns = `seq, uid, type, name, COALESCE(sha256, ''), size, permanent, created_at`
+
+func scanAssetEvent(row pgx.Row) (models.AssetEvent, error) {
+	var event models.AssetEvent
+	err := row.Scan(&event.Seq, &event.UID, &event.Type, &event.Name, &event.SHA256, &event.Size, &event.Permanent, &event.CreatedAt)
+	return event, err
+}
+
+// AssetEventBoundsQuery latest последний seq пользователя, oldest первый еще хранящийся
+// (latest+1, если хранить нечего): курсор меньше oldest-1 указывает на удаленные события
+func (s *Server) AssetEventBoundsQuery(ctx context.Context, userID int) (latest, oldest int64, err error) {
 	query := `
-        INSERT INTO assets (name, uid, data, created_at) 
-        VALUES ($1, $2, $3, NOW())
-        ON CONFLICT (name, uid) 
-        DO UPDATE SET data = EXCLUDED.data, created_at = EXCLUDED.created_at;
+        SELECT u.asset_event_seq, COALESCE((SELECT MIN(seq) FROM asset_events e WHERE e.uid = u.id), u.asset_event_seq + 1)
+        FROM users u WHERE u.id = $1
     `
-	_, err := s.db.Exec(ctx, query, name, userID, data)
-	return err
+	err = s.db.QueryRow(ctx, query, userID).Scan(&latest, &oldest)
+	return latest, oldest, err
 }
 
-func (s *Server) SoftDeleteAssetQuery(ctx context.Context, dto dto.DeleteAsset) error {
-	query := `UPDATE assets SET deleted = TRUE WHERE name = $1 AND uid = $2`
-	_, err := s.db.Exec(ctx, query, dto.Name, dto.UserID)
-	return err
+// ListAssetEventsQuery события с seq в (Since, Until] по порядку, только имена с префиксом Prefix
+func (s *Server) ListAssetEventsQuery(ctx context.Context, dto dto.ListAssetEvents) ([]models.AssetEvent, error) {
+	query := `
+        SELECT ` + assetEventColumns + ` FROM asset_events
+        WHERE uid = $1 AND seq > $2 AND seq <= $3 AND starts_with(name, $4)
+        ORDER BY seq LIMIT $5
+    `
+	rows, err := s.db.Query(ctx, query, dto.UserID, dto.Since, dto.Until, dto.Prefix, dto.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := make([]models.AssetEvent, 0)
+	for rows.Next() {
+		event, err := scanAssetEvent(rows)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
 }
 
-func (s *Server) HardDeleteAssetQuery(ctx context.Context, dto dto.DeleteAsset) error {
-	query := `DELETE FROM assets WHERE name = $1 AND uid = $2`
-	_, err := s.db.Exec(ctx, query, dto.Name, dto.UserID)
+// DeleteOldAssetEventsQuery удаляет события старше before
+func (s *Server) DeleteOldAssetEventsQuery(ctx context.Context, before time.Time) error {
+	_, err := s.db.Exec(ctx, `DELETE FROM asset_events WHERE created_at < $1`, before)
 	return err
 }
 
-func (s *Server) GetUserByLogin(ctx context.Context, credentials dto.Credentials) (models.User, error) {
+// userColumns колонки users в порядке, который ожидает scanUser
+const userColumns = `u.id, u.login, u.password_hash, u.created_at::text, COALESCE(u.totp_secret, ''), u.totp_enabled, u.role, u.disabled`
+
+func scanUser(row pgx.Row) (models.User, error) {
 	var user models.User
-	err := s.db.QueryRow(ctx, "SELECT id, login, password_hash FROM users WHERE login=$1", credentials.Login).Scan(&user.ID, &user.Login, &user.PasswordHash)
+	err := row.Scan(&user.ID, &user.Login, &user.PasswordHash, &user.CreatedAt, &user.TOTPSecret, &user.TOTPEnabled, &user.Role, &user.Disabled)
+	return user, err
+}
+
+func (s *Server) GetUserByLogin(ctx context.Context, credentials dto.Credentials) (models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users u WHERE u.login=$1`
+	user, err := scanUser(s.db.QueryRow(ctx, query, credentials.Login))
 	if err != nil {
 		return user, err
 	}
 	return user, nil
 }
 
+func (s *Server) GetUserByIDQuery(ctx context.Context, userID int) (models.User, error) {
+	query := `SELECT ` + userColumns + ` FROM users u WHERE u.id=$1`
+	return scanUser(s.db.QueryRow(ctx, query, userID))
+}
+
 func (s *Server) CreateNewSessionQueryWithPostgresTrigger(ctx context.Context, dto dto.CreateNewSession) error {
 	query := `INSERT INTO sessions (id, uid, expires_at, ip_address, active) VALUES ($1, $2, $3, $4, $5)`
 	_, err := s.db.Exec(ctx, query, dto.Token, dto.UserID, dto.ExpiresAt, dto.IPAddress, false)
@@ -80,7 +419,7 @@ func (s *Server) CreateNewSessionWithTransaction(ctx context.Context, dto dto.Cr
 	defer func() {
 		if err != nil {
 			if rollbackErr := tx.Rollback(ctx); rollbackErr != nil {
-				log.Printf("tx rollback error: %v", rollbackErr)
+				slog.ErrorContext(ctx, "tx rollback error", "error", rollbackErr)
 			}
 		}
 	}()
@@ -100,29 +439,693 @@ func (s *Server) CreateNewSessionWithTransaction(ctx context.Context, dto dto.Cr
 	return tx.Commit(ctx)
 }
 
-func (s *Server) DeactivateExpiredSessionsAndReturnUserID(token string) (userID int, err error) {
+func (s *Server) DeactivateExpiredSessionsAndReturnUserID(ctx context.Context, token string) (userID int, role string, err error) {
 	var expiresAt time.Time
-	var active bool
+	var active, disabled bool
 
-	err = s.db.QueryRow(context.Background(), "SELECT uid, expires_at, active FROM sessions WHERE id=$1", token).Scan(&userID, &expiresAt, &active)
+	query := `SELECT s.uid, s.expires_at, s.active, u.role, u.disabled FROM sessions s JOIN users u ON u.id = s.uid WHERE s.id=$1`
+	err = s.db.QueryRow(ctx, query, token).Scan(&userID, &expiresAt, &active, &role, &disabled)
 	if err != nil {
-		return 0, err
+		return 0, "", err
+	}
+
+	// Заблокированный администратором пользователь не проходит даже с живой сессией
+	if disabled {
+		return 0, "", errAccountDisabled
 	}
 
 	// Если сессия активна и еще не истекла
 	if active && time.Now().Before(expiresAt) {
-		return userID, nil
+		return userID, role, nil
 	}
 
-	// Если сессия по времени истекла, но статус active = TRUE - делаем сессию неактивной
+	// Если сессия по времени истекла, но статус active = TRUE - делаем сессию неактивной
 	if active && time.Now().After(expiresAt) {
-		_, err = s.db.Exec(context.Background(), "UPDATE sessions SET active = FALSE WHERE id = $1", token)
+		_, err = s.db.Exec(ctx, "UPDATE sessions SET active = FALSE WHERE id = $1", token)
+		if err != nil {
+			slog.ErrorContext(ctx, "error deactivating session", "error", err)
+			return 0, "", err
+		}
+		return 0, "", http.ErrNoCookie
+	}
+
+	return 0, "", http.ErrNoCookie
+}
+
+func (s *Server) DeactivateSessionQuery(ctx context.Context, token string) error {
+	_, err := s.db.Exec(ctx, "UPDATE sessions SET active = FALSE WHERE id = $1", token)
+	return err
+}
+
+func (s *Server) ListJWTKeysQuery(ctx context.Context) ([]models.JWTKey, error) {
+	query := `SELECT kid, alg, private_key, created_at, retire_at, expires_at FROM jwt_keys WHERE expires_at > NOW() ORDER BY created_at`
+	rows, err := s.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []models.JWTKey
+	for rows.Next() {
+		var key models.JWTKey
+		if err = rows.Scan(&key.Kid, &key.Alg, &key.PrivateKey, &key.CreatedAt, &key.RetireAt, &key.ExpiresAt); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (s *Server) InsertJWTKeyQuery(ctx context.Context, key models.JWTKey) error {
+	query := `INSERT INTO jwt_keys (kid, alg, private_key, retire_at, expires_at) VALUES ($1, $2, $3, $4, $5)`
+	_, err := s.db.Exec(ctx, query, key.Kid, key.Alg, key.PrivateKey, key.RetireAt, key.ExpiresAt)
+	return err
+}
+
+func (s *Server) ListRevokedTokensQuery(ctx context.Context) (map[string]time.Time, error) {
+	rows, err := s.db.Query(ctx, `SELECT jti, expires_at FROM revoked_tokens WHERE expires_at > NOW()`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revoked := make(map[string]time.Time)
+	for rows.Next() {
+		var jti string
+		var expiresAt time.Time
+		if err = rows.Scan(&jti, &expiresAt); err != nil {
+			return nil, err
+		}
+		revoked[jti] = expiresAt
+	}
+	return revoked, rows.Err()
+}
+
+func (s *Server) InsertRevokedTokenQuery(ctx context.Context, jti string, userID int, expiresAt time.Time) error {
+	query := `INSERT INTO revoked_tokens (jti, uid, expires_at) VALUES ($1, $2, $3) ON CONFLICT (jti) DO NOTHING`
+	_, err := s.db.Exec(ctx, query, jti, userID, expiresAt)
+	return err
+}
+
+func (s *Server) DeleteExpiredJWTDataQuery(ctx context.Context) error {
+	_, err := s.db.Exec(ctx, `DELETE FROM revoked_tokens WHERE expires_at <= NOW()`)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.Exec(ctx, `DELETE FROM jwt_keys WHERE expires_at <= NOW()`)
+	return err
+}
+
+func (s *Server) CreateAPIKeyQuery(ctx context.Context, key models.APIKey) (models.APIKey, error) {
+	query := `
+        INSERT INTO api_keys (id, uid, name, key_hash, scopes, path_prefix, expires_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)
+        RETURNING created_at
+    `
+	err := s.db.QueryRow(ctx, query, key.ID, key.UID, key.Name, key.KeyHash, key.Scopes, key.PathPrefix, key.ExpiresAt).Scan(&key.CreatedAt)
+	return key, err
+}
+
+func (s *Server) GetAPIKeyQuery(ctx context.Context, id string) (models.APIKey, error) {
+	var key models.APIKey
+	query := `SELECT id, uid, name, key_hash, scopes, path_prefix, expires_at, created_at, last_used_at, revoked FROM api_keys WHERE id=$1`
+	err := s.db.QueryRow(ctx, query, id).Scan(&key.ID, &key.UID, &key.Name, &key.KeyHash, &key.Scopes, &key.PathPrefix, &key.ExpiresAt, &key.CreatedAt, &key.LastUsedAt, &key.Revoked)
+	return key, err
+}
+
+func (s *Server) GetUserRoleQuery(ctx context.Context, userID int) (role string, disabled bool, err error) {
+	err = s.db.QueryRow(ctx, `SELECT role, disabled FROM users WHERE id = $1`, userID).Scan(&role, &disabled)
+	return role, disabled, err
+}
+
+func (s *Server) ListAPIKeysQuery(ctx context.Context, userID int) ([]models.APIKey, error) {
+	query := `SELECT id, uid, name, scopes, path_prefix, expires_at, created_at, last_used_at, revoked FROM api_keys WHERE uid=$1 AND revoked=FALSE ORDER BY created_at`
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := make([]models.APIKey, 0)
+	for rows.Next() {
+		var key models.APIKey
+		if err = rows.Scan(&key.ID, &key.UID, &key.Name, &key.Scopes, &key.PathPrefix, &key.ExpiresAt, &key.CreatedAt, &key.LastUsedAt, &key.Revoked); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+func (s *Server) RevokeAPIKeyQuery(ctx context.Context, id string, userID int) (bool, error) {
+	tag, err := s.db.Exec(ctx, `UPDATE api_keys SET revoked = TRUE WHERE id = $1 AND uid = $2 AND revoked = FALSE`, id, userID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// TouchAPIKeyQuery обновляет last_used_at не чаще раза в минуту, чтобы не писать в базу на каждый запрос
+func (s *Server) TouchAPIKeyQuery(ctx context.Context, id string) error {
+	query := `UPDATE api_keys SET last_used_at = NOW() WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`
+	_, err := s.db.Exec(ctx, query, id)
+	return err
+}
+
+// SetTOTPSecretQuery сохраняет новый секрет, пока 2FA еще не подтверждена
+func (s *Server) SetTOTPSecretQuery(ctx context.Context, userID int, secret string) (bool, error) {
+	query := `UPDATE users SET totp_secret = $2, totp_last_counter = 0 WHERE id = $1 AND totp_enabled = FALSE`
+	tag, err := s.db.Exec(ctx, query, userID, secret)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (s *Server) EnableTOTPWithTransaction(ctx context.Context, userID int, recoveryCodeHashes []string) error {
+	tx, err := s.db.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(ctx); rollbackErr != nil {
+				slog.ErrorContext(ctx, "tx rollback error", "error", rollbackErr)
+			}
+		}
+	}()
+
+	_, err = tx.Exec(ctx, "UPDATE users SET totp_enabled = TRUE WHERE id = $1", userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "DELETE FROM recovery_codes WHERE uid = $1", userID)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range recoveryCodeHashes {
+		_, err = tx.Exec(ctx, "INSERT INTO recovery_codes (uid, code_hash) VALUES ($1, $2)", userID, hash)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *Server) DisableTOTPWithTransaction(ctx context.Context, userID int) error {
+	tx, err := s.db.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
 		if err != nil {
-			log.Printf("Error deactivating session: %v", err)
+			if rollbackErr := tx.Rollback(ctx); rollbackErr != nil {
+				slog.ErrorContext(ctx, "tx rollback error", "error", rollbackErr)
+			}
+		}
+	}()
+
+	_, err = tx.Exec(ctx, "UPDATE users SET totp_enabled = FALSE, totp_secret = NULL, totp_last_counter = 0 WHERE id = $1", userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, "DELETE FROM recovery_codes WHERE uid = $1", userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// UseTOTPCounterQuery запоминает использованный интервал; false означает повтор кода
+func (s *Server) UseTOTPCounterQuery(ctx context.Context, userID int, counter int64) (bool, error) {
+	query := `UPDATE users SET totp_last_counter = $2 WHERE id = $1 AND totp_last_counter < $2`
+	tag, err := s.db.Exec(ctx, query, userID, counter)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (s *Server) UseRecoveryCodeQuery(ctx context.Context, userID int, codeHash string) (bool, error) {
+	query := `
+        UPDATE recovery_codes SET used_at = NOW()
+        WHERE id = (SELECT id FROM recovery_codes WHERE uid = $1 AND code_hash = $2 AND used_at IS NULL LIMIT 1)
+    `
+	tag, err := s.db.Exec(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (s *Server) CreateLoginChallengeQuery(ctx context.Context, challenge models.LoginChallenge) error {
+	query := `INSERT INTO login_challenges (id, uid, ip_address, expires_at) VALUES ($1, $2, $3, $4)`
+	_, err := s.db.Exec(ctx, query, challenge.ID, challenge.UID, challenge.IPAddress, challenge.ExpiresAt)
+	return err
+}
+
+// AttemptLoginChallengeQuery засчитывает попытку ввода кода и возвращает challenge,
+// если он еще не истек и лимит попыток не исчерпан
+func (s *Server) AttemptLoginChallengeQuery(ctx context.Context, id string, maxAttempts int) (models.LoginChallenge, error) {
+	var challenge models.LoginChallenge
+	query := `
+        UPDATE login_challenges SET attempts = attempts + 1
+        WHERE id = $1 AND expires_at > NOW() AND attempts < $2
+        RETURNING id, uid, host(ip_address), attempts, created_at, expires_at
+    `
+	err := s.db.QueryRow(ctx, query, id, maxAttempts).Scan(&challenge.ID, &challenge.UID, &challenge.IPAddress, &challenge.Attempts, &challenge.CreatedAt, &challenge.ExpiresAt)
+	return challenge, err
+}
+
+func (s *Server) DeleteLoginChallengeQuery(ctx context.Context, id string) error {
+	_, err := s.db.Exec(ctx, `DELETE FROM login_challenges WHERE id = $1 OR expires_at <= NOW()`, id)
+	return err
+}
+
+func (s *Server) CreateOIDCLoginStateQuery(ctx context.Context, state models.OIDCLoginState) error {
+	query := `INSERT INTO oidc_login_states (state, code_verifier, nonce, cookie, expires_at) VALUES ($1, $2, $3, $4, $5)`
+	_, err := s.db.Exec(ctx, query, state.State, state.CodeVerifier, state.Nonce, state.Cookie, state.ExpiresAt)
+	return err
+}
+
+// ConsumeOIDCLoginStateQuery удаляет state и возвращает его, если он не истек: каждый state одноразовый
+func (s *Server) ConsumeOIDCLoginStateQuery(ctx context.Context, state string) (models.OIDCLoginState, error) {
+	var loginState models.OIDCLoginState
+	query := `
+        DELETE FROM oidc_login_states WHERE state = $1 AND expires_at > NOW()
+        RETURNING state, code_verifier, nonce, cookie, created_at, expires_at
+    `
+	err := s.db.QueryRow(ctx, query, state).Scan(&loginState.State, &loginState.CodeVerifier, &loginState.Nonce, &loginState.Cookie, &loginState.CreatedAt, &loginState.ExpiresAt)
+	if err != nil {
+		return loginState, err
+	}
+
+	_, err = s.db.Exec(ctx, `DELETE FROM oidc_login_states WHERE expires_at <= NOW()`)
+	return loginState, err
+}
+
+func (s *Server) GetUserByIdentityQuery(ctx context.Context, issuer, subject string) (models.User, error) {
+	query := `
+        SELECT ` + userColumns + `
+        FROM user_identities i JOIN users u ON u.id = i.uid
+        WHERE i.issuer = $1 AND i.subject = $2
+    `
+	return scanUser(s.db.QueryRow(ctx, query, issuer, subject))
+}
+
+// LinkOrProvisionUserWithTransaction привязывает внешнюю учетную запись к пользователю с логином login
+// (если linkExisting) или создает нового пользователя, подбирая свободный логин
+func (s *Server) LinkOrProvisionUserWithTransaction(ctx context.Context, identity models.UserIdentity, login string, linkExisting bool) (userID int, err error) {
+	tx, err := s.db.BeginTx(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(ctx); rollbackErr != nil {
+				slog.ErrorContext(ctx, "tx rollback error", "error", rollbackErr)
+			}
+		}
+	}()
+
+	if linkExisting {
+		err = tx.QueryRow(ctx, "SELECT id FROM users WHERE login = $1", login).Scan(&userID)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
 			return 0, err
 		}
-		return 0, http.ErrNoCookie
+		err = nil
+	}
+
+	for attempt := 0; userID == 0; attempt++ {
+		candidate := login
+		if attempt > 0 {
+			candidate = fmt.Sprintf("%s-%d", login, attempt)
+		}
+		if attempt >= 100 {
+			return 0, fmt.Errorf("cannot find free login for %q", login)
+		}
+
+		err = tx.QueryRow(ctx, `
+            INSERT INTO users (login, password_hash) VALUES ($1, $2)
+            ON CONFLICT (login) DO NOTHING
+            RETURNING id
+        `, candidate, pkg.UnusablePasswordHash).Scan(&userID)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return 0, err
+		}
+		err = nil
+	}
+
+	_, err = tx.Exec(ctx, "INSERT INTO user_identities (issuer, subject, uid, email) VALUES ($1, $2, $3, $4)", identity.Issuer, identity.Subject, userID, identity.Email)
+	if err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit(ctx)
+}
+
+// GetLoginLockQuery возвращает самый поздний срок блокировки среди keys; нулевое время, если блокировки нет
+func (s *Server) GetLoginLockQuery(ctx context.Context, keys []string) (time.Time, error) {
+	var lockedUntil *time.Time
+	query := `SELECT MAX(locked_until) FROM login_attempts WHERE key = ANY($1) AND locked_until > NOW()`
+	err := s.db.QueryRow(ctx, query, keys).Scan(&lockedUntil)
+	if err != nil || lockedUntil == nil {
+		return time.Time{}, err
+	}
+	return *lockedUntil, nil
+}
+
+// RegisterLoginFailureQuery увеличивает счетчик неудач; счетчик сбрасывается,
+// если и предыдущая неудача, и конец последней блокировки раньше windowStart
+func (s *Server) RegisterLoginFailureQuery(ctx context.Context, key string, windowStart time.Time) (int, error) {
+	var failures int
+	query := `
+        INSERT INTO login_attempts (key, failures, last_failure_at) VALUES ($1, 1, NOW())
+        ON CONFLICT (key) DO UPDATE SET
+            failures = CASE
+                WHEN GREATEST(login_attempts.last_failure_at, login_attempts.locked_until) < $2 THEN 1
+                ELSE login_attempts.failures + 1
+            END,
+            last_failure_at = NOW()
+        RETURNING failures
+    `
+	err := s.db.QueryRow(ctx, query, key, windowStart).Scan(&failures)
+	return failures, err
+}
+
+func (s *Server) LockLoginQuery(ctx context.Context, key string, until time.Time) error {
+	_, err := s.db.Exec(ctx, `UPDATE login_attempts SET locked_until = $2 WHERE key = $1`, key, until)
+	return err
+}
+
+func (s *Server) ResetLoginAttemptsQuery(ctx context.Context, keys []string) (int64, error) {
+	tag, err := s.db.Exec(ctx, `DELETE FROM login_attempts WHERE key = ANY($1)`, keys)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (s *Server) ListLockedLoginsQuery(ctx context.Context) ([]models.LoginAttempt, error) {
+	query := `SELECT key, failures, locked_until, last_failure_at FROM login_attempts WHERE locked_until > NOW() ORDER BY locked_until DESC`
+	rows, err := s.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := make([]models.LoginAttempt, 0)
+	for rows.Next() {
+		var attempt models.LoginAttempt
+		if err = rows.Scan(&attempt.Key, &attempt.Failures, &attempt.LockedUntil, &attempt.LastFailureAt); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, attempt)
+	}
+	return attempts, rows.Err()
+}
+
+func (s *Server) DeleteStaleLoginAttemptsQuery(ctx context.Context, windowStart time.Time) error {
+	query := `DELETE FROM login_attempts WHERE last_failure_at < $1 AND (locked_until IS NULL OR locked_until <= NOW())`
+	_, err := s.db.Exec(ctx, query, windowStart)
+	return err
+}
+
+func (s *Server) PromoteAdminsQuery(ctx context.Context, logins []string) error {
+	_, err := s.db.Exec(ctx, `UPDATE users SET role = 'admin' WHERE login = ANY($1) AND role <> 'admin'`, logins)
+	return err
+}
+
+// likeEscaper экранирует спецсимволы LIKE, чтобы поиск шел по подстроке как есть
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+func (s *Server) ListUsersQuery(ctx context.Context, dto dto.ListUsers) ([]models.User, error) {
+	query := `
+        SELECT ` + userColumns + ` FROM users u
+        WHERE ($1 = '' OR u.login ILIKE '%' || $1 || '%' ESCAPE '\') AND ($2 = '' OR u.role = $2)
+        ORDER BY u.id LIMIT $3 OFFSET $4
+    `
+	rows, err := s.db.Query(ctx, query, likeEscaper.Replace(dto.Query), dto.Role, dto.Limit, dto.Offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := make([]models.User, 0)
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+func (s *Server) SetUserDisabledQuery(ctx context.Context, userID int, disabled bool) (bool, error) {
+	tag, err := s.db.Exec(ctx, `UPDATE users SET disabled = $2 WHERE id = $1`, userID, disabled)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (s *Server) SetUserRoleQuery(ctx context.Context, userID int, role string) (bool, error) {
+	tag, err := s.db.Exec(ctx, `UPDATE users SET role = $2 WHERE id = $1`, userID, role)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (s *Server) SetUserPasswordQuery(ctx context.Context, userID int, passwordHash string) (bool, error) {
+	tag, err := s.db.Exec(ctx, `UPDATE users SET password_hash = $2 WHERE id = $1`, userID, passwordHash)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// ForceLogoutWithTransaction завершает все сессии пользователя и отзывает все выпущенные ему JWT
+func (s *Server) ForceLogoutWithTransaction(ctx context.Context, userID int) (err error) {
+	tx, err := s.db.BeginTx(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			if rollbackErr := tx.Rollback(ctx); rollbackErr != nil {
+				slog.ErrorContext(ctx, "tx rollback error", "error", rollbackErr)
+			}
+		}
+	}()
+
+	_, err = tx.Exec(ctx, "UPDATE sessions SET active = FALSE WHERE uid = $1 AND active = TRUE", userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+        INSERT INTO user_token_revocations (uid, revoked_before) VALUES ($1, date_trunc('second', NOW()))
+        ON CONFLICT (uid) DO UPDATE SET revoked_before = EXCLUDED.revoked_before
+    `, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (s *Server) ListUserTokenRevocationsQuery(ctx context.Context, notBefore time.Time) (map[int]time.Time, error) {
+	rows, err := s.db.Query(ctx, `SELECT uid, revoked_before FROM user_token_revocations WHERE revoked_before > $1`, notBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revocations := make(map[int]time.Time)
+	for rows.Next() {
+		var uid int
+		var revokedBefore time.Time
+		if err = rows.Scan(&uid, &revokedBefore); err != nil {
+			return nil, err
+		}
+		revocations[uid] = revokedBefore
 	}
+	return revocations, rows.Err()
+}
 
-	return 0, http.ErrNoCookie
+func (s *Server) ListAssetInfoQuery(ctx context.Context, dto dto.ListAssets, includeDeleted bool) ([]models.AssetInfo, error) {
+	query := `
+        SELECT ` + assetInfoColumns + ` FROM assets
+        WHERE uid=$1 AND ($5 OR deleted=FALSE) AND starts_with(name, $4)
+        ORDER BY name LIMIT $2 OFFSET $3
+    `
+	rows, err := s.db.Query(ctx, query, dto.UserID, dto.Limit, dto.Offset, dto.Prefix, includeDeleted)
+	if err != nil {
+		return nil, err
+	}
+	return collectAssetInfo(rows)
+}
+
+// ListTrashQuery мягко удаленные файлы пользователя
+func (s *Server) ListTrashQuery(ctx context.Context, dto dto.ListAssets) ([]models.AssetInfo, error) {
+	query := `
+        SELECT ` + assetInfoColumns + ` FROM assets
+        WHERE uid=$1 AND deleted=TRUE AND starts_with(name, $4)
+        ORDER BY name LIMIT $2 OFFSET $3
+    `
+	rows, err := s.db.Query(ctx, query, dto.UserID, dto.Limit, dto.Offset, dto.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	return collectAssetInfo(rows)
+}
+
+func collectAssetInfo(rows pgx.Rows) ([]models.AssetInfo, error) {
+	defer rows.Close()
+
+	assets := make([]models.AssetInfo, 0)
+	for rows.Next() {
+		asset, err := scanAssetInfo(rows)
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, asset)
+	}
+	return assets, rows.Err()
+}
+
+func (s *Server) GetUsageQuery(ctx context.Context, userID int) (models.Usage, error) {
+	usage := models.Usage{UID: userID}
+	query := `
+        SELECT
+            COUNT(*) FILTER (WHERE NOT deleted),
+            COALESCE(SUM(octet_length(data)) FILTER (WHERE NOT deleted), 0),
+            COUNT(*) FILTER (WHERE deleted),
+            COALESCE(SUM(octet_length(data)) FILTER (WHERE deleted), 0),
+            (SELECT COUNT(*) FROM sessions WHERE uid = $1 AND active AND expires_at > NOW()),
+            (SELECT COUNT(*) FROM api_keys WHERE uid = $1 AND NOT revoked)
+        FROM assets WHERE uid = $1
+    `
+	err := s.db.QueryRow(ctx, query, userID).Scan(&usage.Assets, &usage.Bytes, &usage.DeletedAssets, &usage.DeletedBytes, &usage.ActiveSessions, &usage.APIKeys)
+	return usage, err
+}
+
+// CheckAssetsStorageQuery проверяет, что таблица с содержимым файлов доступна на чтение
+func (s *Server) CheckAssetsStorageQuery(ctx context.Context) error {
+	var exists bool
+	return s.db.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM assets)`).Scan(&exists)
+}
+
+func (s *Server) GetStorageStatsQuery(ctx context.Context) (models.StorageStats, error) {
+	var stats models.StorageStats
+	query := `
+        SELECT
+            (SELECT COUNT(*) FROM users),
+            COUNT(*) FILTER (WHERE NOT deleted),
+            COALESCE(SUM(octet_length(data)) FILTER (WHERE NOT deleted), 0),
+            COUNT(*) FILTER (WHERE deleted),
+            COALESCE(SUM(octet_length(data)) FILTER (WHERE deleted), 0),
+            (SELECT COUNT(*) FROM sessions WHERE active AND expires_at > NOW())
+        FROM assets
+    `
+	err := s.db.QueryRow(ctx, query).Scan(&stats.Users, &stats.Assets, &stats.Bytes, &stats.DeletedAssets, &stats.DeletedBytes, &stats.ActiveSessions)
+	return stats, err
+}
+
+// rateLimitRefill остаток корзины с учетом пополнения с момента прошлого запроса
+const rateLimitRefill = `LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM NOW() - b.updated_at)::float8 * $3::float8)`
+
+// TakeRateLimitTokenQuery атомарно пополняет корзину key и списывает из нее токен, если он есть.
+// Возвращает остаток после списания и признак, что токен был списан.
+func (s *Server) TakeRateLimitTokenQuery(ctx context.Context, key string, burst, perSecond float64) (tokens float64, allowed bool, err error) {
+	query := `
+        INSERT INTO rate_limit_buckets AS b (key, tokens, allowed, updated_at)
+        VALUES ($1, $2::float8 - 1, TRUE, NOW())
+        ON CONFLICT (key) DO UPDATE SET
+            tokens = CASE WHEN ` + rateLimitRefill + ` >= 1 THEN ` + rateLimitRefill + ` - 1 ELSE ` + rateLimitRefill + ` END,
+            allowed = ` + rateLimitRefill + ` >= 1,
+            updated_at = NOW()
+        RETURNING tokens, allowed
+    `
+	err = s.db.QueryRow(ctx, query, key, burst, perSecond).Scan(&tokens, &allowed)
+	return tokens, allowed, err
+}
+
+// DeleteIdleRateLimitBucketsQuery удаляет корзины, которые к before уже пополнились до конца
+func (s *Server) DeleteIdleRateLimitBucketsQuery(ctx context.Context, before time.Time) error {
+	_, err := s.db.Exec(ctx, `DELETE FROM rate_limit_buckets WHERE updated_at < $1`, before)
+	return err
+}
+
+// shareLinkColumns колонки share_links в порядке, который ожидает scanShareLink
+const shareLinkColumns = `id, uid, name, created_at, expires_at, downloads`
+
+func scanShareLink(row pgx.Row) (models.ShareLink, error) {
+	var link models.ShareLink
+	err := row.Scan(&link.ID, &link.UID, &link.Name, &link.CreatedAt, &link.ExpiresAt, &link.Downloads)
+	return link, err
+}
+
+// CreateShareLinkQuery создает ссылку на живой файл; если файла нет, возвращает pgx.ErrNoRows
+func (s *Server) CreateShareLinkQuery(ctx context.Context, link models.ShareLink) (models.ShareLink, error) {
+	query := `
+        INSERT INTO share_links (id, uid, name, expires_at)
+        SELECT $1, uid, name, $4 FROM assets WHERE uid = $2 AND name = $3 AND deleted = FALSE
+        RETURNING ` + shareLinkColumns
+	return scanShareLink(s.db.QueryRow(ctx, query, link.ID, link.UID, link.Name, link.ExpiresAt))
+}
+
+// ListShareLinksQuery действующие ссылки пользователя
+func (s *Server) ListShareLinksQuery(ctx context.Context, userID int) ([]models.ShareLink, error) {
+	query := `SELECT ` + shareLinkColumns + ` FROM share_links WHERE uid = $1 AND expires_at > NOW() ORDER BY created_at DESC`
+	rows, err := s.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := make([]models.ShareLink, 0)
+	for rows.Next() {
+		link, err := scanShareLink(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+// DeleteShareLinkQuery отзывает ссылку; false, если у пользователя такой ссылки нет
+func (s *Server) DeleteShareLinkQuery(ctx context.Context, id string, userID int) (bool, error) {
+	tag, err := s.db.Exec(ctx, `DELETE FROM share_links WHERE id = $1 AND uid = $2`, id, userID)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+// GetSharedAssetQuery отдает файл по действующей ссылке и считает скачивание;
+// если ссылка истекла или файл удален, возвращает pgx.ErrNoRows
+func (s *Server) GetSharedAssetQuery(ctx context.Context, id string) (name, sha256 string, data []byte, err error) {
+	query := `
+        UPDATE share_links l SET downloads = l.downloads + 1
+        FROM assets a
+        WHERE l.id = $1 AND l.expires_at > NOW() AND a.uid = l.uid AND a.name = l.name AND a.deleted = FALSE
+        RETURNING a.name, a.sha256, a.data
+    `
+	err = s.db.QueryRow(ctx, query, id).Scan(&name, &sha256, &data)
+	return name, sha256, data, err
+}
+
+// DeleteExpiredShareLinksQuery удаляет ссылки, истекшие до before
+func (s *Server) DeleteExpiredShareLinksQuery(ctx context.Context, before time.Time) error {
+	_, err := s.db.Exec(ctx, `DELETE FROM share_links WHERE expires_at < $1`, before)
+	return err
 }
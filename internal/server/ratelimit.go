@@ -0,0 +1,222 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"web-storage-service/internal/config"
+	"web-storage-service/pkg"
+)
+
+// rateClass группа маршрутов с общим лимитом
+type rateClass string
+
+const (
+	rateClassAuth  rateClass = "auth"
+	rateClassRead  rateClass = "read"
+	rateClassWrite rateClass = "write"
+	// rateClassIP общий лимит адреса перед аутентификацией
+	rateClassIP rateClass = "ip"
+)
+
+// rateLimitCleanupInterval как часто удаляются корзины, которые уже пополнились до конца
+const rateLimitCleanupInterval = time.Minute
+
+// rateLimit корзина токенов емкостью burst, пополняемая на perSecond токенов в секунду
+type rateLimit struct {
+	burst     float64
+	perSecond float64
+}
+
+func newRateLimit(l config.RateLimit) rateLimit {
+	return rateLimit{burst: float64(l.Burst), perSecond: float64(l.PerMinute) / 60}
+}
+
+// refillTime за сколько пустая корзина наполнится до конца
+func (l rateLimit) refillTime() time.Duration {
+	return time.Duration(l.burst / l.perSecond * float64(time.Second))
+}
+
+// rateLimitStore хранит корзины; take пополняет корзину key и списывает токен, если он есть
+type rateLimitStore interface {
+	take(ctx context.Context, key string, limit rateLimit) (tokens float64, allowed bool, err error)
+	deleteIdle(ctx context.Context, before time.Time) error
+}
+
+type rateLimiter struct {
+	store  rateLimitStore
+	limits map[rateClass]rateLimit
+}
+
+func newRateLimiter(s *Server, cfg config.RateLimitConfig) *rateLimiter {
+	var store rateLimitStore = &memoryRateLimitStore{buckets: make(map[string]*tokenBucket)}
+	if cfg.Store == config.RateLimitStorePostgres {
+		store = postgresRateLimitStore{s}
+	}
+	return &rateLimiter{
+		store: store,
+		limits: map[rateClass]rateLimit{
+			rateClassAuth:  newRateLimit(cfg.Auth),
+			rateClassRead:  newRateLimit(cfg.Read),
+			rateClassWrite: newRateLimit(cfg.Write),
+			rateClassIP:    newRateLimit(cfg.IP),
+		},
+	}
+}
+
+// RateLimitMiddleware ограничивает частоту запросов: для аутентифицированных по пользователю,
+// для остальных по IP. Чтобы видеть пользователя, ставится внутри AuthMiddleware.
+func (s *Server) RateLimitMiddleware(next http.Handler) http.Handler {
+	if s.rateLimiter == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		class := rateClassOf(r)
+		key := string(class) + ":ip:" + pkg.ClientIP(r)
+		if userID, ok := r.Context().Value(UserIDKey).(int); ok {
+			key = string(class) + ":user:" + strconv.Itoa(userID)
+		}
+		if s.takeRateLimit(w, r, class, key) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// IPRateLimitMiddleware ограничивает запросы с одного IP до AuthMiddleware, чтобы
+// запросы с неверными токенами и ключами тоже расходовали лимит
+func (s *Server) IPRateLimitMiddleware(next http.Handler) http.Handler {
+	if s.rateLimiter == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.takeRateLimit(w, r, rateClassIP, string(rateClassIP)+":"+pkg.ClientIP(r)) {
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// takeRateLimit списывает токен из корзины key; если токенов нет, отвечает 429 и возвращает false
+func (s *Server) takeRateLimit(w http.ResponseWriter, r *http.Request, class rateClass, key string) bool {
+	ctx := r.Context()
+	limit := s.rateLimiter.limits[class]
+
+	tokens, allowed, err := s.rateLimiter.store.take(ctx, key, limit)
+	if err != nil {
+		// сбой хранилища лимитов не должен останавливать сервис
+		slog.WarnContext(ctx, "rate limit store error, request allowed", "error", err)
+		return true
+	}
+
+	setRateLimitHeaders(w.Header(), limit, tokens)
+	if !allowed {
+		s.metrics.rateLimited.Inc(string(class))
+		retryAfter := time.Duration((1 - tokens) / limit.perSecond * float64(time.Second))
+		TooManyRequestsError(w, r, CodeRateLimited, retryAfter)
+		return false
+	}
+	return true
+}
+
+func rateClassOf(r *http.Request) rateClass {
+	switch {
+	case strings.HasPrefix(routeFromContext(r.Context()), "/api/auth"):
+		return rateClassAuth
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return rateClassRead
+	default:
+		return rateClassWrite
+	}
+}
+
+// setRateLimitHeaders заголовки по draft-ietf-httpapi-ratelimit-headers:
+// Reset через сколько секунд корзина снова будет полной
+func setRateLimitHeaders(h http.Header, limit rateLimit, tokens float64) {
+	window := int(math.Ceil(limit.burst / limit.perSecond))
+	reset := int(math.Ceil((limit.burst - tokens) / limit.perSecond))
+	h.Set("RateLimit-Limit", strconv.Itoa(int(limit.burst)))
+	h.Set("RateLimit-Remaining", strconv.Itoa(int(math.Max(0, math.Floor(tokens)))))
+	h.Set("RateLimit-Reset", strconv.Itoa(reset))
+	h.Set("RateLimit-Policy", strconv.Itoa(int(limit.burst))+";w="+strconv.Itoa(window))
+}
+
+func (s *Server) runRateLimitCleanup(ctx context.Context) {
+	var idle time.Duration
+	for _, limit := range s.rateLimiter.limits {
+		idle = max(idle, limit.refillTime())
+	}
+
+	ticker := time.NewTicker(rateLimitCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.rateLimiter.store.deleteIdle(ctx, time.Now().Add(-idle)); err != nil {
+				slog.Error("error deleting idle rate limit buckets", "error", err)
+			}
+		}
+	}
+}
+
+// memoryRateLimitStore лимиты одного инстанса: за балансировщиком на N инстансов клиент получит до N раз больше
+type memoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func (m *memoryRateLimitStore) take(_ context.Context, key string, limit rateLimit) (float64, bool, error) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: limit.burst, updated: now}
+		m.buckets[key] = b
+	}
+	b.tokens = math.Min(limit.burst, b.tokens+now.Sub(b.updated).Seconds()*limit.perSecond)
+	b.updated = now
+
+	if b.tokens < 1 {
+		return b.tokens, false, nil
+	}
+	b.tokens--
+	return b.tokens, true, nil
+}
+
+func (m *memoryRateLimitStore) deleteIdle(_ context.Context, before time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for key, b := range m.buckets {
+		if b.updated.Before(before) {
+			delete(m.buckets, key)
+		}
+	}
+	return nil
+}
+
+// postgresRateLimitStore общие лимиты для всех инстансов, время берется из базы
+type postgresRateLimitStore struct {
+	s *Server
+}
+
+func (p postgresRateLimitStore) take(ctx context.Context, key string, limit rateLimit) (float64, bool, error) {
+	return p.s.TakeRateLimitTokenQuery(ctx, key, limit.burst, limit.perSecond)
+}
+
+func (p postgresRateLimitStore) deleteIdle(ctx context.Context, before time.Time) error {
+	return p.s.DeleteIdleRateLimitBucketsQuery(ctx, before)
+}
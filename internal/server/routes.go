@@ -2,22 +2,118 @@ package server
 
 import (
 	"net/http"
+	"web-storage-service/internal/models"
 )
 
+// routeMux запоминает зарегистрированные шаблоны, чтобы тесты сверяли их с описанием OpenAPI
+type routeMux struct {
+	*http.ServeMux
+	patterns []string
+}
+
+func (m *routeMux) Handle(pattern string, handler http.Handler) {
+	m.patterns = append(m.patterns, pattern)
+	m.ServeMux.Handle(pattern, handler)
+}
+
+func (m *routeMux) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	m.Handle(pattern, http.HandlerFunc(handler))
+}
+
 func (s *Server) RegisterRoutes() http.Handler {
+	r := s.routes()
+
+	// access log внутри трассировки, чтобы его записи получили trace_id
+	// CORS оборачивает весь маршрутизатор: preflight OPTIONS не зарегистрирован ни на одном маршруте
+	var handler http.Handler = r.ServeMux
+	handler = s.CORSMiddleware(handler)
+	handler = s.MetricsMiddleware(handler)
+	handler = s.AccessLogMiddleware(handler)
+	handler = s.TracingMiddleware(handler)
+	handler = s.RouteMiddleware(r.ServeMux)(handler)
+	handler = s.RequestIDMiddleware(handler)
+
+	return handler
+}
+
+// routes регистрирует маршруты; каждый маршрут API должен быть описан в apiOperations
+func (s *Server) routes() *routeMux {
+	r := &routeMux{ServeMux: http.NewServeMux()}
+
+	// лимит по IP до AuthMiddleware ограничивает перебор токенов, лимит внутри
+	// AuthMiddleware считает запросы по пользователю, а не по IP
+	authed := func(h http.HandlerFunc) http.Handler {
+		return s.IPRateLimitMiddleware(s.AuthMiddleware(s.RateLimitMiddleware(h)))
+	}
+	admin := func(h http.HandlerFunc) http.Handler {
+		return s.IPRateLimitMiddleware(s.AuthMiddleware(s.RequireRole(models.RoleAdmin)(s.RateLimitMiddleware(h))))
+	}
+	public := func(h http.HandlerFunc) http.Handler {
+		return s.RateLimitMiddleware(h)
+	}
+
+	r.Handle("GET /health", admin(s.HealthHandler))
+	r.HandleFunc("GET /livez", s.LivezHandler)
+	r.HandleFunc("GET /readyz", s.ReadyHandler)
+	r.HandleFunc("GET /metrics", s.MetricsHandler)
+
+	r.Handle("POST /api/auth", public(s.AuthHandler))
+	r.Handle("POST /api/auth/2fa", public(s.CompleteTwoFactorLoginHandler))
+	r.Handle("GET /api/auth/oidc/login", public(s.OIDCLoginHandler))
+	r.Handle("GET /api/auth/oidc/callback", public(s.OIDCCallbackHandler))
+	r.Handle("POST /api/logout", authed(s.LogoutHandler))
+	r.HandleFunc("GET /.well-known/jwks.json", s.JWKSHandler)
+
+	r.Handle("POST /api/upload-asset/{name}", authed(s.UploadAssetHandler))
+	r.Handle("PUT /api/update-asset/{name}", authed(s.UpdateAssetHandler))
+	r.Handle("GET /api/asset/{name}", authed(s.DownloadAssetHandler))
+	r.Handle("PUT /api/delete-asset/{name}", authed(s.SoftDeleteAssetHandler))
+	r.Handle("DELETE /api/delete-asset/{name}", authed(s.HardDeleteAssetHandler))
+	r.Handle("GET /api/assets", authed(s.ListAssetsHandler))
+	r.Handle("POST /api/rename-asset/{name}", authed(s.RenameAssetHandler))
+	r.Handle("POST /api/copy-asset/{name}", authed(s.CopyAssetHandler))
+	r.Handle("POST /api/restore-asset/{name}", authed(s.RestoreAssetHandler))
+	r.Handle("GET /api/trash", authed(s.ListTrashHandler))
+	r.Handle("GET /api/changes", authed(s.ChangesHandler))
+	r.Handle("GET /api/changes/stream", authed(s.ChangesStreamHandler))
+
+	r.Handle("POST /api/share-asset/{name}", authed(s.CreateShareLinkHandler))
+	r.Handle("GET /api/shares", authed(s.ListShareLinksHandler))
+	r.Handle("DELETE /api/shares/{id}", authed(s.DeleteShareLinkHandler))
+	r.Handle("GET /s/{id}", public(s.SharedAssetHandler))
+
+	r.Handle("POST /api/keys", authed(s.CreateAPIKeyHandler))
+	r.Handle("GET /api/keys", authed(s.ListAPIKeysHandler))
+	r.Handle("DELETE /api/keys/{id}", authed(s.RevokeAPIKeyHandler))
 
-	r := http.NewServeMux()
+	r.Handle("POST /api/2fa/enroll", authed(s.EnrollTOTPHandler))
+	r.Handle("POST /api/2fa/confirm", authed(s.ConfirmTOTPHandler))
+	r.Handle("POST /api/2fa/disable", authed(s.DisableTOTPHandler))
 
-	r.HandleFunc("GET /health", s.HealthHandler) // TODO: оставить доступ только для админов
+	r.Handle("GET /api/admin/lockouts", admin(s.ListLockoutsHandler))
+	r.Handle("DELETE /api/admin/lockouts", admin(s.UnlockHandler))
 
-	r.HandleFunc("POST /api/auth", s.AuthHandler)
+	r.Handle("GET /api/admin/users", admin(s.AdminListUsersHandler))
+	r.Handle("GET /api/admin/users/{id}", admin(s.AdminGetUserHandler))
+	r.Handle("POST /api/admin/users/{id}/disable", admin(s.AdminDisableUserHandler))
+	r.Handle("POST /api/admin/users/{id}/enable", admin(s.AdminEnableUserHandler))
+	r.Handle("PUT /api/admin/users/{id}/role", admin(s.AdminSetUserRoleHandler))
+	r.Handle("PUT /api/admin/users/{id}/password", admin(s.AdminResetPasswordHandler))
+	r.Handle("DELETE /api/admin/users/{id}/sessions", admin(s.AdminForceLogoutHandler))
+	r.Handle("GET /api/admin/users/{id}/assets", admin(s.AdminListUserAssetsHandler))
+	r.Handle("GET /api/admin/users/{id}/usage", admin(s.AdminUserUsageHandler))
 
-	r.Handle("POST /api/upload-asset/{name}", s.AuthMiddleware(http.HandlerFunc(s.UploadAssetHandler)))
-	r.Handle("PUT /api/update-asset/{name}", s.AuthMiddleware(http.HandlerFunc(s.UpdateAssetHandler)))
-	r.Handle("GET /api/asset/{name}", s.AuthMiddleware(http.HandlerFunc(s.DownloadAssetHandler)))
-	r.Handle("PUT /api/delete-asset/{name}", s.AuthMiddleware(http.HandlerFunc(s.SoftDeleteAssetHandler)))
-	r.Handle("DELETE /api/delete-asset/{name}", s.AuthMiddleware(http.HandlerFunc(s.HardDeleteAssetHandler)))
-	r.Handle("GET /api/assets", s.AuthMiddleware(http.HandlerFunc(s.ListAssetsHandler)))
+	// страницы и документ OpenAPI сами в OpenAPI не описываются
+	if s.cfg.Web.UIEnabled {
+		r.Handle("GET /ui/", s.UIHandler())
+		r.HandleFunc("GET /ui/config.json", s.UIConfigHandler)
+		r.Handle("GET /{$}", http.RedirectHandler("/ui/", http.StatusFound))
+	}
+	if s.cfg.Web.DocsEnabled {
+		r.HandleFunc("GET /openapi.json", s.OpenAPIHandler())
+		r.Handle("GET /docs/", s.DocsHandler())
+		r.Handle("GET /docs", http.RedirectHandler("/docs/", http.StatusMovedPermanently))
+	}
 
 	return r
 }
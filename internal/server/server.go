@@ -1,52 +1,214 @@
 package server
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
-	"os"
-	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 	"web-storage-service/pkg"
 
+	"web-storage-service/internal/config"
 	"web-storage-service/internal/database"
+	"web-storage-service/internal/oidc"
+	"web-storage-service/internal/tracing"
 )
 
-var (
-	port int
-)
+type Server struct {
+	cfg config.Config
 
-func init() {
-	// TODO: Если использовать "github.com/joho/godotenv/autoload",
-	// TODO: можно будет убрать init() функции
-	err := pkg.LoadEnv(".env")
-	if err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
-	}
+	db database.Service
 
-	port, _ = strconv.Atoi(os.Getenv("PORT"))
-}
+	// jwt == nil, если сервис работает только с сессиями в базе
+	jwt *jwtKeyring
 
-type Server struct {
-	port int
+	// oidc == nil, если вход через внешнего провайдера не настроен
+	oidc *oidc.Provider
 
-	db database.Service
+	lockout lockoutPolicy
+
+	// rateLimiter == nil, если RATE_LIMIT_ENABLED=false
+	rateLimiter *rateLimiter
+
+	// bandwidth == nil, если скорость передачи файлов не ограничена
+	bandwidth *bandwidthLimits
+
+	metrics *serverMetrics
+
+	// changes будит ожидающие запросы ленты изменений
+	changes *changeHub
+
+	// tracer == nil, если трассировка выключена
+	tracer *tracing.Tracer
+
+	http *http.Server
+
+	// ready сбрасывается в начале остановки, чтобы /readyz вывел инстанс из балансировки
+	ready atomic.Bool
+	// readiness последние результаты проверок зависимостей для /readyz
+	readiness readinessCache
+
+	// stopWorkers отменяет контекст фоновых задач, workers ждет их завершения
+	stopWorkers context.CancelFunc
+	workers     sync.WaitGroup
 }
 
-func NewServer() *http.Server {
+// NewServer загружает ключи JWT, если они нужны, и запускает фоновые задачи
+func NewServer(cfg config.Config, db database.Service, tracer *tracing.Tracer) (*Server, error) {
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
 	NewServer := &Server{
-		port: port,
+		cfg: cfg,
+
+		stopWorkers: stopWorkers,
+
+		tracer: tracer,
+
+		db: db,
+
+		changes: newChangeHub(),
+
+		lockout: lockoutPolicy{
+			maxFailures:   cfg.Lockout.MaxFailures,
+			ipMaxFailures: cfg.Lockout.IPMaxFailures,
+			window:        cfg.Lockout.FailureWindow,
+			baseLockout:   cfg.Lockout.BaseLockout,
+			maxLockout:    cfg.Lockout.MaxLockout,
+		},
+	}
+
+	// ключи загружаются до запуска фоновых задач, чтобы при ошибке нечего было останавливать
+	if cfg.Auth.Mode == config.AuthModeJWT {
+		if err := NewServer.loadJWT(cfg.Auth); err != nil {
+			stopWorkers()
+			return nil, err
+		}
+	}
+
+	// ADMIN_LOGINS назначает первых администраторов, дальше роли меняются через admin API
+	if len(cfg.Auth.AdminLogins) > 0 {
+		if err := NewServer.PromoteAdminsQuery(context.Background(), cfg.Auth.AdminLogins); err != nil {
+			slog.Error("error promoting admins", "error", err)
+		}
+	}
+
+	NewServer.goWorker(workersCtx, NewServer.runLoginAttemptsCleanup)
+	NewServer.goWorker(workersCtx, NewServer.runShareLinksCleanup)
+	NewServer.goWorker(workersCtx, NewServer.runChangeListener)
+	NewServer.goWorker(workersCtx, NewServer.runChangesCleanup)
+
+	if bw := cfg.Bandwidth; bw.GlobalKBps > 0 || bw.AdminKBps > 0 || bw.UserKBps > 0 || bw.ReadOnlyKBps > 0 {
+		NewServer.bandwidth = newBandwidthLimits(bw)
+	}
 
-		db: database.New(),
+	if cfg.RateLimit.Enabled {
+		NewServer.rateLimiter = newRateLimiter(NewServer, cfg.RateLimit)
+		NewServer.goWorker(workersCtx, NewServer.runRateLimitCleanup)
 	}
 
-	server := &http.Server{
-		Addr:         fmt.Sprintf(":%d", NewServer.port),
+	if NewServer.jwt != nil {
+		NewServer.goWorker(workersCtx, NewServer.runJWTMaintenance)
+	}
+
+	if cfg.OIDC.Enabled() {
+		NewServer.oidc = oidc.NewProvider(oidc.Config{
+			Issuer:       cfg.OIDC.Issuer,
+			ClientID:     cfg.OIDC.ClientID,
+			ClientSecret: cfg.OIDC.ClientSecret,
+			RedirectURL:  cfg.OIDC.RedirectURL,
+			Scopes:       cfg.OIDC.Scopes,
+			HTTPClient: &http.Client{
+				Timeout:   10 * time.Second,
+				Transport: tracer.Transport(http.DefaultTransport),
+			},
+		})
+	}
+
+	NewServer.metrics = newServerMetrics(NewServer)
+
+	NewServer.http = &http.Server{
+		Addr:         fmt.Sprintf(":%d", cfg.Port),
 		Handler:      NewServer.RegisterRoutes(),
 		IdleTimeout:  time.Minute,
 		ReadTimeout:  10 * time.Second,
 		WriteTimeout: 30 * time.Second,
+		// ошибки TLS-рукопожатий и паники обработчиков идут в общий лог
+		ErrorLog: slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
 	}
+	// Shutdown ждет завершения запросов, а long-poll и SSE-потоки без этого висели бы до дедлайна
+	NewServer.http.RegisterOnShutdown(NewServer.changes.close)
+	NewServer.ready.Store(true)
+
+	return NewServer, nil
+}
+
+func (s *Server) loadJWT(cfg config.AuthConfig) error {
+	secret, err := cfg.DecodeJWTKeySecret()
+	if err != nil {
+		return fmt.Errorf("decoding JWT_KEY_SECRET: %w", err)
+	}
+	if s.jwt, err = newJWTKeyring(cfg.JWTAlg, cfg.JWTIssuer, cfg.JWTTTL, cfg.JWTKeyRotation, secret); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	if err = s.refreshJWTKeys(ctx); err != nil {
+		return fmt.Errorf("loading jwt keys: %w", err)
+	}
+	if err = s.refreshRevokedTokens(ctx); err != nil {
+		return fmt.Errorf("loading revoked tokens: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) goWorker(ctx context.Context, fn func(ctx context.Context)) {
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		fn(ctx)
+	}()
+}
+
+// ListenAndServe слушает порт по TLS, если заданы сертификат и ключ, иначе по HTTP.
+// После Shutdown возвращает http.ErrServerClosed.
+func (s *Server) ListenAndServe() error {
+	if pkg.DoFilesExist(s.cfg.CertFile, s.cfg.KeyFile) {
+		slog.Info("listening", "addr", s.http.Addr, "tls", true)
+		return s.http.ListenAndServeTLS(s.cfg.CertFile, s.cfg.KeyFile)
+	}
+	slog.Info("listening", "addr", s.http.Addr, "tls", false)
+	return s.http.ListenAndServe()
+}
+
+// Ready сообщает, принимает ли инстанс новый трафик
+func (s *Server) Ready() bool {
+	return s.ready.Load()
+}
+
+// Shutdown снимает готовность, выжидает ShutdownDelay, перестает принимать
+// соединения и ждет текущие запросы до отмены ctx, после чего останавливает
+// фоновые задачи. Пул соединений с базой закрывает владелец db.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.ready.Store(false)
+	slog.Info("shutting down, draining in-flight requests")
+
+	if s.cfg.ShutdownDelay > 0 {
+		select {
+		case <-time.After(s.cfg.ShutdownDelay):
+		case <-ctx.Done():
+		}
+	}
+
+	err := s.http.Shutdown(ctx)
+	if err != nil {
+		slog.Error("error draining connections", "error", err)
+		// соединения, не успевшие завершиться к дедлайну, обрываем
+		_ = s.http.Close()
+	}
+
+	s.stopWorkers()
+	s.workers.Wait()
 
-	return server
+	return err
 }
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"web-storage-service/internal/dto"
+	"web-storage-service/internal/models"
+	"web-storage-service/pkg"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// shareLinkResponse ссылка вместе с готовым URL для передачи получателю
+type shareLinkResponse struct {
+	models.ShareLink
+	URL string `json:"url"`
+}
+
+// shareURL собирает абсолютный адрес ссылки из запроса, по которому ее создали
+func shareURL(r *http.Request, id string) string {
+	scheme := "https"
+	if r.TLS == nil {
+		scheme = "http"
+	}
+	return scheme + "://" + r.Host + "/s/" + id
+}
+
+// CreateShareLinkHandler создает публичную ссылку на файл; срок жизни задается
+// expires_in в секундах и ограничен SHARE_LINK_MAX_TTL
+func (s *Server) CreateShareLinkHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := ctx.Value(UserIDKey).(int)
+	name := r.PathValue("name")
+	// ссылка открывает файл любому, поэтому ее создание требует права на запись, а не только на чтение
+	if !requireScope(w, r, ScopeAssetsWrite) || !requireAssetAccess(w, r, name) {
+		return
+	}
+
+	var request dto.CreateShareLink
+	// тело необязательно: без него действует SHARE_LINK_TTL
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		BadRequestError(w, r)
+		return
+	}
+	ttl := s.cfg.Web.ShareLinkTTL
+	if request.ExpiresIn != 0 {
+		// сравнение в секундах до умножения, чтобы огромное значение не переполнило Duration
+		if request.ExpiresIn > int64(s.cfg.Web.ShareLinkMaxTTL.Seconds()) {
+			request.ExpiresIn = -1
+		}
+		ttl = time.Duration(request.ExpiresIn) * time.Second
+	}
+	if ttl <= 0 || ttl > s.cfg.Web.ShareLinkMaxTTL {
+		WriteError(w, r, &APIError{Status: http.StatusBadRequest, Code: CodeInvalidRequest, Detail: "expires_in must be between 1 and " + s.cfg.Web.ShareLinkMaxTTL.String()})
+		return
+	}
+
+	link, err := s.CreateShareLinkQuery(ctx, models.ShareLink{
+		ID:        pkg.GenerateRandomID(24),
+		UID:       userID,
+		Name:      name,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		NotFoundError(w, r, "asset")
+		return
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err = json.NewEncoder(w).Encode(shareLinkResponse{ShareLink: link, URL: shareURL(r, link.ID)}); err != nil {
+		slog.ErrorContext(ctx, "error writing response", "error", err)
+	}
+}
+
+func (s *Server) ListShareLinksHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := ctx.Value(UserIDKey).(int)
+	if !requireScope(w, r, ScopeAssetsRead) {
+		return
+	}
+
+	links, err := s.ListShareLinksQuery(ctx, userID)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	// API-ключ с префиксом видит только ссылки на свои файлы
+	prefix, _ := ctx.Value(AssetPrefixKey).(string)
+	response := make([]shareLinkResponse, 0, len(links))
+	for _, link := range links {
+		if strings.HasPrefix(link.Name, prefix) {
+			response = append(response, shareLinkResponse{ShareLink: link, URL: shareURL(r, link.ID)})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(response); err != nil {
+		slog.ErrorContext(ctx, "error writing response", "error", err)
+	}
+}
+
+func (s *Server) DeleteShareLinkHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := ctx.Value(UserIDKey).(int)
+	if !requireScope(w, r, ScopeAssetsWrite) {
+		return
+	}
+
+	deleted, err := s.DeleteShareLinkQuery(ctx, r.PathValue("id"), userID)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if !deleted {
+		NotFoundError(w, r, "share link")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SharedAssetHandler отдает файл по публичной ссылке без входа
+func (s *Server) SharedAssetHandler(w http.ResponseWriter, r *http.Request) {
+	name, sha256, data, err := s.GetSharedAssetQuery(r.Context(), r.PathValue("id"))
+	if errors.Is(err, pgx.ErrNoRows) {
+		NotFoundError(w, r, "share link")
+		return
+	}
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	s.metrics.downloadBytes.Add(float64(len(data)))
+	w.Header().Set("ETag", strconv.Quote(sha256))
+	// ссылка и есть секрет, ее не должны сохранять кэши и Referer
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	s.writeAssetContent(w, r, name, data)
+}
+
+func (s *Server) runShareLinksCleanup(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.DeleteExpiredShareLinksQuery(ctx, time.Now()); err != nil {
+				slog.Error("error deleting expired share links", "error", err)
+			}
+		}
+	}
+}
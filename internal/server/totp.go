@@ -0,0 +1,271 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+	"web-storage-service/internal/dto"
+	"web-storage-service/internal/models"
+	"web-storage-service/pkg"
+)
+
+const (
+	loginChallengeTTL         = 5 * time.Minute
+	loginChallengeMaxAttempts = 5
+	recoveryCodesCount        = 10
+	// допускаем расхождение часов клиента на один 30-секундный интервал
+	totpSkew = 1
+)
+
+// startTwoFactorLogin отвечает на успешную проверку пароля challenge-ом,
+// который нужно завершить кодом TOTP на /api/auth/2fa
+func (s *Server) startTwoFactorLogin(w http.ResponseWriter, r *http.Request, user models.User) {
+	challenge := models.LoginChallenge{
+		ID:        pkg.GenerateRandomID(32),
+		UID:       user.ID,
+		IPAddress: pkg.ClientIP(r),
+		ExpiresAt: time.Now().Add(loginChallengeTTL),
+	}
+
+	err := s.CreateLoginChallengeQuery(r.Context(), challenge)
+	if err != nil {
+		InternalServerError(w, r, fmt.Errorf("creating login challenge: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(map[string]interface{}{
+		"two_factor_required": true,
+		"challenge":           challenge.ID,
+		"expires_at":          challenge.ExpiresAt,
+	})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+}
+
+func (s *Server) CompleteTwoFactorLoginHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var request dto.CompleteTwoFactorLogin
+
+	cookie, ok := s.cookieLoginRequested(w, r)
+	if !ok {
+		return
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || request.Challenge == "" || request.Code == "" {
+		BadRequestError(w, r)
+		return
+	}
+
+	ip := pkg.ClientIP(r)
+	// логин неизвестен, пока не найден challenge, поэтому сначала проверяется только IP
+	if !s.checkLoginLock(w, r, "") {
+		return
+	}
+
+	challenge, err := s.AttemptLoginChallengeQuery(ctx, request.Challenge, loginChallengeMaxAttempts)
+	if err != nil {
+		s.registerLoginFailure(ctx, "", ip)
+		s.authFailure(authFailureSecondFactor)
+		UnauthorizedError(w, r, CodeInvalidChallenge, "invalid or expired challenge")
+		return
+	}
+
+	// challenge завершается с того же адреса, с которого введен пароль,
+	// чтобы утекший идентификатор нельзя было использовать откуда-то еще
+	if !pkg.SameIP(challenge.IPAddress, ip) {
+		s.registerLoginFailure(ctx, "", ip)
+		s.authFailure(authFailureSecondFactor)
+		UnauthorizedError(w, r, CodeInvalidChallenge, "invalid or expired challenge")
+		return
+	}
+
+	user, err := s.GetUserByIDQuery(ctx, challenge.UID)
+	if err != nil {
+		s.authFailure(authFailureSecondFactor)
+		UnauthorizedError(w, r, CodeInvalidChallenge, "invalid or expired challenge")
+		return
+	}
+	if !s.checkLoginLock(w, r, user.Login) {
+		return
+	}
+
+	ok, err = s.verifySecondFactor(ctx, user, request.Code)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if !ok {
+		s.registerLoginFailure(ctx, user.Login, ip)
+		s.authFailure(authFailureSecondFactor)
+		UnauthorizedError(w, r, CodeInvalidSecondFactor, "invalid two-factor code")
+		return
+	}
+	s.registerLoginSuccess(ctx, user.Login)
+
+	if err = s.DeleteLoginChallengeQuery(ctx, challenge.ID); err != nil {
+		slog.ErrorContext(ctx, "error deleting login challenge", "error", err)
+	}
+
+	s.respondWithToken(w, r, user, cookie)
+}
+
+// verifySecondFactor принимает либо текущий код TOTP, либо неиспользованный код восстановления
+func (s *Server) verifySecondFactor(ctx context.Context, user models.User, code string) (bool, error) {
+	if !user.TOTPEnabled || user.TOTPSecret == "" {
+		return false, nil
+	}
+
+	if counter, ok := pkg.ValidateTOTP(user.TOTPSecret, code, time.Now(), totpSkew); ok {
+		return s.UseTOTPCounterQuery(ctx, user.ID, counter)
+	}
+
+	return s.UseRecoveryCodeQuery(ctx, user.ID, pkg.HashRecoveryCode(code))
+}
+
+func (s *Server) EnrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := ctx.Value(UserIDKey).(int)
+	if !requireScope(w, r, ScopeAccountManage) {
+		return
+	}
+
+	user, err := s.GetUserByIDQuery(ctx, userID)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	secret := pkg.GenerateTOTPSecret()
+	updated, err := s.SetTOTPSecretQuery(ctx, userID, secret)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if !updated {
+		ConflictError(w, r, CodeTOTPAlreadyEnabled, "two-factor authentication is already enabled")
+		return
+	}
+
+	// otpauth_uri предназначен для QR-кода в приложении-аутентификаторе
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(map[string]string{
+		"secret":      secret,
+		"otpauth_uri": pkg.TOTPURI(s.cfg.Auth.TOTPIssuer, user.Login, secret),
+	})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+}
+
+func (s *Server) ConfirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := ctx.Value(UserIDKey).(int)
+	if !requireScope(w, r, ScopeAccountManage) {
+		return
+	}
+
+	var request dto.TOTPCode
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		BadRequestError(w, r)
+		return
+	}
+
+	user, err := s.GetUserByIDQuery(ctx, userID)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if user.TOTPEnabled {
+		ConflictError(w, r, CodeTOTPAlreadyEnabled, "two-factor authentication is already enabled")
+		return
+	}
+	if user.TOTPSecret == "" {
+		BadRequestError(w, r)
+		return
+	}
+
+	counter, ok := pkg.ValidateTOTP(user.TOTPSecret, request.Code, time.Now(), totpSkew)
+	if !ok {
+		s.authFailure(authFailureSecondFactor)
+		UnauthorizedError(w, r, CodeInvalidSecondFactor, "invalid two-factor code")
+		return
+	}
+
+	codes := pkg.GenerateRecoveryCodes(recoveryCodesCount)
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = pkg.HashRecoveryCode(code)
+	}
+
+	if err = s.EnableTOTPWithTransaction(ctx, userID, hashes); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if _, err = s.UseTOTPCounterQuery(ctx, userID, counter); err != nil {
+		slog.ErrorContext(ctx, "error saving totp counter", "error", err)
+	}
+
+	// Коды восстановления показываем один раз
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":         "enabled",
+		"recovery_codes": codes,
+	})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+}
+
+func (s *Server) DisableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	userID := ctx.Value(UserIDKey).(int)
+	if !requireScope(w, r, ScopeAccountManage) {
+		return
+	}
+
+	var request dto.TOTPCode
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		BadRequestError(w, r)
+		return
+	}
+
+	user, err := s.GetUserByIDQuery(ctx, userID)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	ok, err := s.verifySecondFactor(ctx, user, request.Code)
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+	if !ok {
+		s.authFailure(authFailureSecondFactor)
+		UnauthorizedError(w, r, CodeInvalidSecondFactor, "invalid two-factor code")
+		return
+	}
+
+	if err = s.DisableTOTPWithTransaction(ctx, userID); err != nil {
+		WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	err = json.NewEncoder(w).Encode(map[string]string{"status": "disabled"})
+	if err != nil {
+		WriteError(w, r, err)
+		return
+	}
+}
@@ -0,0 +1,19 @@
+package server
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TracingMiddleware открывает серверный спан на запрос с именем по шаблону маршрута;
+// метод в имени приводится так же, как в метриках, чтобы имена спанов не плодились
+func (s *Server) TracingMiddleware(next http.Handler) http.Handler {
+	return s.tracer.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trace.SpanFromContext(r.Context()).SetAttributes(attribute.String("http.route", routeFromContext(r.Context())))
+		next.ServeHTTP(w, r)
+	}), func(r *http.Request) string {
+		return methodLabel(r) + " " + routeFromContext(r.Context())
+	})
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"embed"
+	"encoding/json"
+	"io/fs"
+	"log/slog"
+	"net/http"
+)
+
+// webFiles статические файлы веб-интерфейса и документации API, встроенные в бинарник
+//
+//go:embed web docs
+var webFiles embed.FS
+
+// uiContentSecurityPolicy запрещает встроенные скрипты и чужие ресурсы: страница
+// ходит только в API этого же сервиса
+const uiContentSecurityPolicy = "default-src 'self'; img-src 'self' data:; frame-ancestors 'none'; base-uri 'none'; form-action 'self'"
+
+// UIHandler отдает веб-интерфейс на /ui/
+func (s *Server) UIHandler() http.Handler {
+	return staticFiles("web", "/ui/")
+}
+
+// DocsHandler отдает страницу документации API на /docs/
+func (s *Server) DocsHandler() http.Handler {
+	return staticFiles("docs", "/docs/")
+}
+
+// staticFiles отдает каталог dir из webFiles под префиксом prefix
+func staticFiles(dir, prefix string) http.Handler {
+	files, err := fs.Sub(webFiles, dir)
+	if err != nil {
+		panic(err)
+	}
+	fileServer := http.StripPrefix(prefix, http.FileServerFS(files))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		setUIHeaders(w)
+		fileServer.ServeHTTP(w, r)
+	})
+}
+
+// UIConfigHandler сообщает странице, как входить: через cookie или с Bearer-токеном
+func (s *Server) UIConfigHandler(w http.ResponseWriter, r *http.Request) {
+	setUIHeaders(w)
+	w.Header().Set("Content-Type", "application/json")
+	err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"cookie_sessions": s.cfg.Auth.CookieSessions,
+		"csrf_cookie":     s.cfg.Auth.CookieName + "_csrf",
+		"csrf_header":     CSRFHeader,
+	})
+	if err != nil {
+		slog.ErrorContext(r.Context(), "error writing response", "error", err)
+	}
+}
+
+func setUIHeaders(w http.ResponseWriter) {
+	h := w.Header()
+	h.Set("Content-Security-Policy", uiContentSecurityPolicy)
+	h.Set("X-Content-Type-Options", "nosniff")
+	h.Set("X-Frame-Options", "DENY")
+	h.Set("Referrer-Policy", "same-origin")
+	// файлы меняются вместе с бинарником, поэтому браузер должен их перепроверять
+	h.Set("Cache-Control", "no-cache")
+}
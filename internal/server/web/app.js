@@ -0,0 +1,465 @@
+'use strict';
+
+// Веб-интерфейс поверх того же REST API, что и у остальных клиентов.
+// С AUTH_COOKIE_SESSIONS токен живет в HttpOnly cookie, иначе в sessionStorage вкладки.
+(function () {
+  const PAGE_SIZE = 200;
+
+  const state = {
+    config: { cookie_sessions: false, csrf_cookie: '', csrf_header: 'X-CSRF-Token' },
+    token: sessionStorage.getItem('wss_token'),
+    challenge: null,
+    prefix: '',
+    view: 'files',
+  };
+
+  const $ = (id) => document.getElementById(id);
+
+  class APIError extends Error {
+    constructor(status, code, detail) {
+      super(detail);
+      this.status = status;
+      this.code = code;
+    }
+  }
+
+  function readCookie(name) {
+    for (const part of document.cookie.split(';')) {
+      const [key, ...rest] = part.trim().split('=');
+      if (key === name) return decodeURIComponent(rest.join('='));
+    }
+    return '';
+  }
+
+  async function api(method, url, body) {
+    const headers = {};
+    if (state.token) {
+      headers.Authorization = 'Bearer ' + state.token;
+    } else if (state.config.cookie_sessions) {
+      const csrf = readCookie(state.config.csrf_cookie);
+      if (csrf) headers[state.config.csrf_header] = csrf;
+    }
+    if (body !== undefined && !(body instanceof Blob)) {
+      headers['Content-Type'] = 'application/json';
+      body = JSON.stringify(body);
+    }
+
+    const resp = await fetch(url, { method, headers, body, credentials: 'same-origin' });
+    if (!resp.ok) {
+      let problem = {};
+      try { problem = await resp.json(); } catch (e) { /* тело не JSON */ }
+      throw new APIError(resp.status, problem.code || '', problem.detail || resp.statusText);
+    }
+    return resp;
+  }
+
+  const assetURL = (action, name, query) =>
+    '/api/' + action + '/' + encodeURIComponent(name) + (query ? '?' + query : '');
+
+  // --- статус и ошибки ---
+
+  function setStatus(text, isError) {
+    const el = $('status');
+    el.textContent = text || '';
+    el.classList.toggle('error', !!isError);
+  }
+
+  function handleError(err) {
+    if (err instanceof APIError && err.status === 401) {
+      showLogin();
+      setStatus('Your session has expired, please sign in again.', true);
+      return;
+    }
+    setStatus(err.message || String(err), true);
+  }
+
+  // --- вход и выход ---
+
+  function show(id) {
+    for (const el of ['login-form', 'totp-form', 'files-view', 'trash-view', 'shares-view']) {
+      $(el).hidden = el !== id;
+    }
+    $('nav').hidden = id === 'login-form' || id === 'totp-form';
+  }
+
+  function showLogin() {
+    state.token = null;
+    sessionStorage.removeItem('wss_token');
+    show('login-form');
+    $('login-form').elements.login.focus();
+  }
+
+  function loginQuery() {
+    return state.config.cookie_sessions ? '?cookie=true' : '';
+  }
+
+  async function completeLogin(resp) {
+    const data = await resp.json();
+    if (data.two_factor_required) {
+      state.challenge = data.challenge;
+      show('totp-form');
+      $('totp-form').elements.code.focus();
+      return;
+    }
+    if (data.token) {
+      state.token = data.token;
+      sessionStorage.setItem('wss_token', data.token);
+    }
+    state.challenge = null;
+    setStatus('');
+    switchView('files').catch(handleError);
+  }
+
+  $('login-form').addEventListener('submit', async (ev) => {
+    ev.preventDefault();
+    const form = ev.target;
+    try {
+      const resp = await api('POST', '/api/auth' + loginQuery(), {
+        login: form.elements.login.value,
+        password: form.elements.password.value,
+      });
+      form.elements.password.value = '';
+      await completeLogin(resp);
+    } catch (err) {
+      setStatus(err.status === 401 ? 'Wrong login or password.' : err.message, true);
+    }
+  });
+
+  $('totp-form').addEventListener('submit', async (ev) => {
+    ev.preventDefault();
+    const form = ev.target;
+    try {
+      const resp = await api('POST', '/api/auth/2fa' + loginQuery(), {
+        challenge: state.challenge,
+        code: form.elements.code.value.trim(),
+      });
+      form.elements.code.value = '';
+      await completeLogin(resp);
+    } catch (err) {
+      if (err.code === 'invalid_challenge') {
+        showLogin();
+        setStatus('The sign-in attempt has expired, please start again.', true);
+        return;
+      }
+      setStatus(err.message, true);
+    }
+  });
+
+  $('logout').addEventListener('click', async () => {
+    try {
+      await api('POST', '/api/logout');
+    } catch (err) {
+      // сессия уже могла истечь, на выход это не влияет
+    }
+    showLogin();
+    setStatus('You have been signed out.');
+  });
+
+  // --- общие элементы таблиц ---
+
+  function formatSize(bytes) {
+    const units = ['B', 'KB', 'MB', 'GB'];
+    let i = 0;
+    while (bytes >= 1024 && i < units.length - 1) {
+      bytes /= 1024;
+      i++;
+    }
+    return (i === 0 ? bytes : bytes.toFixed(1)) + ' ' + units[i];
+  }
+
+  const formatDate = (value) => new Date(value).toLocaleString();
+
+  function cell(content) {
+    const td = document.createElement('td');
+    if (content instanceof Node) td.appendChild(content);
+    else td.textContent = content === undefined ? '' : content;
+    return td;
+  }
+
+  function button(label, onClick, danger) {
+    const b = document.createElement('button');
+    b.type = 'button';
+    b.textContent = label;
+    if (danger) b.className = 'danger';
+    b.addEventListener('click', onClick);
+    return b;
+  }
+
+  function link(label, onClick) {
+    const a = document.createElement('a');
+    a.textContent = label;
+    a.addEventListener('click', onClick);
+    return a;
+  }
+
+  function actions(...buttons) {
+    const td = document.createElement('td');
+    td.className = 'actions';
+    td.append(...buttons);
+    return td;
+  }
+
+  function emptyRow(tbody, text) {
+    const td = cell(text);
+    td.colSpan = 4;
+    td.className = 'empty';
+    tbody.appendChild(document.createElement('tr')).appendChild(td);
+  }
+
+  // listAll собирает все страницы списка, API отдает их по PAGE_SIZE
+  async function listAll(url) {
+    const assets = [];
+    for (let page = 1; ; page++) {
+      const sep = url.includes('?') ? '&' : '?';
+      const resp = await api('GET', url + sep + 'page=' + page + '&size=' + PAGE_SIZE);
+      const data = await resp.json();
+      assets.push(...data.assets);
+      if (!data.hasMore) return assets;
+    }
+  }
+
+  // --- файлы и папки ---
+
+  const baseName = (name) => name.slice(name.lastIndexOf('/') + 1);
+
+  function renderBreadcrumbs() {
+    const ol = $('breadcrumbs');
+    ol.replaceChildren();
+    const parts = state.prefix.split('/').filter(Boolean);
+    const crumb = (label, prefix) => {
+      const li = document.createElement('li');
+      li.appendChild(link(label, () => openFolder(prefix)));
+      ol.appendChild(li);
+    };
+    crumb('My files', '');
+    parts.forEach((part, i) => crumb(part, parts.slice(0, i + 1).join('/') + '/'));
+  }
+
+  function openFolder(prefix) {
+    state.prefix = prefix;
+    loadFiles().catch(handleError);
+  }
+
+  async function loadFiles() {
+    renderBreadcrumbs();
+    const assets = await listAll('/api/assets?details=true&prefix=' + encodeURIComponent(state.prefix));
+
+    // имена с / образуют папки: показываем только первый уровень под текущим префиксом
+    const folders = new Set();
+    const files = [];
+    for (const asset of assets) {
+      const rest = asset.name.slice(state.prefix.length);
+      const slash = rest.indexOf('/');
+      if (slash >= 0) folders.add(rest.slice(0, slash));
+      else files.push(asset);
+    }
+
+    const tbody = $('files');
+    tbody.replaceChildren();
+    for (const folder of [...folders].sort()) {
+      const tr = tbody.appendChild(document.createElement('tr'));
+      tr.append(
+        cell(link('📁 ' + folder + '/', () => openFolder(state.prefix + folder + '/'))),
+        cell(''), cell(''), cell(''));
+    }
+    for (const asset of files) {
+      const tr = tbody.appendChild(document.createElement('tr'));
+      tr.append(
+        cell(link(baseName(asset.name), () => download(asset.name).catch(handleError))),
+        cell(formatSize(asset.size)),
+        cell(formatDate(asset.updated_at)),
+        actions(
+          button('Download', () => download(asset.name).catch(handleError)),
+          button('Rename', () => rename(asset.name).catch(handleError)),
+          button('Share', () => share(asset.name).catch(handleError)),
+          button('Delete', () => moveToTrash(asset.name).catch(handleError), true)));
+    }
+    if (!folders.size && !files.length) {
+      emptyRow(tbody, state.prefix ? 'This folder is empty. Upload files to keep it.' : 'No files yet.');
+    }
+  }
+
+  async function download(name) {
+    const resp = await api('GET', assetURL('asset', name, 'raw=true'));
+    const url = URL.createObjectURL(await resp.blob());
+    const a = document.createElement('a');
+    a.href = url;
+    a.download = baseName(name);
+    document.body.appendChild(a);
+    a.click();
+    a.remove();
+    setTimeout(() => URL.revokeObjectURL(url), 1000);
+  }
+
+  async function upload(files) {
+    let done = 0;
+    for (const file of files) {
+      const name = state.prefix + file.name;
+      setStatus('Uploading ' + file.name + ' (' + (done + 1) + ' of ' + files.length + ')…');
+      try {
+        await api('POST', assetURL('upload-asset', name), file);
+      } catch (err) {
+        if (err.code !== 'asset_exists') throw err;
+        if (!confirm(file.name + ' already exists. Replace it?')) continue;
+        await api('POST', assetURL('upload-asset', name, 'overwrite=true'), file);
+      }
+      done++;
+    }
+    setStatus('Uploaded ' + done + ' of ' + files.length + ' file(s).');
+    await loadFiles();
+  }
+
+  async function rename(name) {
+    const newName = prompt('New name (use / to move it to another folder):', name);
+    if (!newName || newName === name) return;
+    await api('POST', assetURL('rename-asset', name), { name: newName });
+    setStatus('Renamed ' + name + ' to ' + newName + '.');
+    await loadFiles();
+  }
+
+  async function moveToTrash(name) {
+    await api('PUT', assetURL('delete-asset', name));
+    setStatus(name + ' moved to trash.');
+    await loadFiles();
+  }
+
+  $('new-folder').addEventListener('click', () => {
+    const name = prompt('Folder name:');
+    if (!name) return;
+    openFolder(state.prefix + name.replace(/^\/+|\/+$/g, '') + '/');
+  });
+
+  $('file-input').addEventListener('change', (ev) => {
+    const files = [...ev.target.files];
+    ev.target.value = '';
+    upload(files).catch(handleError);
+  });
+
+  const dropzone = $('dropzone');
+  dropzone.addEventListener('dragover', (ev) => {
+    ev.preventDefault();
+    dropzone.classList.add('over');
+  });
+  dropzone.addEventListener('dragleave', () => dropzone.classList.remove('over'));
+  dropzone.addEventListener('drop', (ev) => {
+    ev.preventDefault();
+    dropzone.classList.remove('over');
+    const files = [...ev.dataTransfer.files];
+    if (files.length) upload(files).catch(handleError);
+  });
+
+  // --- корзина ---
+
+  async function loadTrash() {
+    const assets = await listAll('/api/trash');
+    const tbody = $('trash');
+    tbody.replaceChildren();
+    for (const asset of assets) {
+      const tr = tbody.appendChild(document.createElement('tr'));
+      tr.append(
+        cell(asset.name),
+        cell(formatSize(asset.size)),
+        cell(formatDate(asset.updated_at)),
+        actions(
+          button('Restore', () => restore(asset.name).catch(handleError)),
+          button('Delete forever', () => deleteForever(asset.name).catch(handleError), true)));
+    }
+    if (!assets.length) emptyRow(tbody, 'Trash is empty.');
+  }
+
+  async function restore(name) {
+    await api('POST', assetURL('restore-asset', name));
+    setStatus(name + ' restored.');
+    await loadTrash();
+  }
+
+  async function deleteForever(name) {
+    if (!confirm('Delete ' + name + ' forever? This cannot be undone.')) return;
+    await api('DELETE', assetURL('delete-asset', name));
+    setStatus(name + ' deleted forever.');
+    await loadTrash();
+  }
+
+  // --- ссылки ---
+
+  function showShareLink(name, url) {
+    $('share-name').textContent = name;
+    $('share-url').value = url;
+    $('share-dialog').showModal();
+    $('share-url').select();
+  }
+
+  $('share-copy').addEventListener('click', async () => {
+    try {
+      await navigator.clipboard.writeText($('share-url').value);
+      setStatus('Link copied.');
+    } catch (err) {
+      $('share-url').select();
+    }
+  });
+
+  async function share(name) {
+    const hours = prompt('Link lifetime in hours:', '24');
+    if (hours === null) return;
+    const expiresIn = Math.round(parseFloat(hours) * 3600);
+    if (!(expiresIn > 0)) {
+      setStatus('Enter a positive number of hours.', true);
+      return;
+    }
+    const resp = await api('POST', assetURL('share-asset', name), { expires_in: expiresIn });
+    const data = await resp.json();
+    showShareLink(name, data.url);
+  }
+
+  async function loadShares() {
+    const resp = await api('GET', '/api/shares');
+    const shares = await resp.json();
+    const tbody = $('shares');
+    tbody.replaceChildren();
+    for (const s of shares) {
+      const tr = tbody.appendChild(document.createElement('tr'));
+      tr.append(
+        cell(s.name),
+        cell(formatDate(s.expires_at)),
+        cell(String(s.downloads)),
+        actions(
+          button('Show link', () => showShareLink(s.name, s.url)),
+          button('Revoke', () => revoke(s).catch(handleError), true)));
+    }
+    if (!shares.length) emptyRow(tbody, 'No active links.');
+  }
+
+  async function revoke(s) {
+    await api('DELETE', '/api/shares/' + encodeURIComponent(s.id));
+    setStatus('Link to ' + s.name + ' revoked.');
+    await loadShares();
+  }
+
+  // --- переключение разделов ---
+
+  const loaders = { files: loadFiles, trash: loadTrash, shares: loadShares };
+
+  function switchView(view) {
+    state.view = view;
+    show(view + '-view');
+    for (const tab of document.querySelectorAll('.tab')) {
+      tab.classList.toggle('active', tab.dataset.view === view);
+    }
+    return loaders[view]();
+  }
+
+  for (const tab of document.querySelectorAll('.tab')) {
+    tab.addEventListener('click', () => {
+      setStatus('');
+      switchView(tab.dataset.view).catch(handleError);
+    });
+  }
+
+  // при открытии страницы сессия может уже быть: cookie или токен этой вкладки
+  fetch('config.json')
+    .then((resp) => resp.json())
+    .then((config) => { state.config = config; })
+    .catch(() => { /* без конфигурации работаем с Bearer-токеном */ })
+    .then(() => switchView('files'))
+    .catch((err) => (err.status === 401 ? showLogin() : handleError(err)));
+})();
@@ -0,0 +1,66 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxStatementLength длинные запросы обрезаются, чтобы не раздувать спаны
+const maxStatementLength = 2048
+
+type queryKey struct{}
+
+type queryTracer struct {
+	tracer *Tracer
+}
+
+// QueryTracer возвращает pgx.QueryTracer, который создает спан на каждый запрос.
+// Запросы вне трассы (фоновые задачи) не записываются, чтобы не плодить корневые спаны.
+func (t *Tracer) QueryTracer() pgx.QueryTracer {
+	return queryTracer{tracer: t}
+}
+
+func (q queryTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	if !trace.SpanContextFromContext(ctx).IsValid() {
+		return ctx
+	}
+
+	statement := strings.Join(strings.Fields(data.SQL), " ")
+	operation, _, _ := strings.Cut(statement, " ")
+	operation = strings.ToUpper(operation)
+	if len(statement) > maxStatementLength {
+		statement = statement[:maxStatementLength]
+	}
+
+	ctx, span := q.tracer.Start(ctx, "db "+operation, trace.SpanKindClient,
+		attribute.String("db.system", "postgresql"),
+		attribute.String("db.operation", operation),
+		attribute.String("db.statement", statement),
+	)
+	if conn != nil {
+		span.SetAttributes(attribute.String("db.name", conn.Config().Database))
+	}
+	// спан запроса хранится под своим ключом: в TraceQueryEnd нельзя
+	// по ошибке завершить родительский спан, если этот не был создан
+	return context.WithValue(ctx, queryKey{}, span)
+}
+
+func (q queryTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	span, _ := ctx.Value(queryKey{}).(trace.Span)
+	if span == nil {
+		return
+	}
+
+	if data.Err != nil {
+		span.RecordError(data.Err)
+		span.SetStatus(codes.Error, data.Err.Error())
+	} else {
+		span.SetAttributes(attribute.Int64("db.rows_affected", data.CommandTag.RowsAffected()))
+	}
+	span.End()
+}
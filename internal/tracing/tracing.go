@@ -0,0 +1,149 @@
+// Package tracing настраивает OpenTelemetry SDK: экспорт спанов по OTLP/HTTP
+// или в stdout, сэмплирование по доле трасс и распространение W3C trace
+// context (traceparent, tracestate) и baggage во входящих и исходящих запросах.
+//
+// Методы безопасны для nil *Tracer: при выключенной трассировке код сервиса
+// вызывает их без проверок и получает неактивные спаны.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+)
+
+// instrumentationName имя, под которым спаны сервиса попадают в коллектор
+const instrumentationName = "web-storage-service"
+
+type Config struct {
+	ServiceName string
+	// Exporter один из ExporterNone, ExporterOTLP, ExporterStdout
+	Exporter string
+	// Endpoint адрес OTLP/HTTP коллектора, например http://localhost:4318
+	Endpoint string
+	// SampleRatio доля корневых трасс, которые записываются, от 0 до 1
+	SampleRatio float64
+	// Output куда пишет stdout-экспортер, по умолчанию os.Stdout
+	Output io.Writer
+}
+
+type Tracer struct {
+	provider   *sdktrace.TracerProvider
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// New создает трассировщик; для ExporterNone возвращает nil, что означает выключенную трассировку
+func New(cfg Config) (*Tracer, error) {
+	var exporter sdktrace.SpanExporter
+	var err error
+	switch cfg.Exporter {
+	case "", ExporterNone:
+		return nil, nil
+	case ExporterOTLP:
+		exporter, err = otlptracehttp.New(context.Background(), otlptracehttp.WithEndpointURL(otlpTracesURL(cfg.Endpoint)))
+	case ExporterStdout:
+		output := cfg.Output
+		if output == nil {
+			output = os.Stdout
+		}
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(output))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q", cfg.Exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("creating %s trace exporter: %w", cfg.Exporter, err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName)))
+	if err != nil {
+		return nil, err
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		// решение о записи принимает корень трассы, дочерние спаны и входящие
+		// запросы следуют флагу sampled родителя
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	return &Tracer{
+		provider:   provider,
+		tracer:     provider.Tracer(instrumentationName),
+		propagator: propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}),
+	}, nil
+}
+
+// otlpTracesURL принимает базовый адрес коллектора, как OTEL_EXPORTER_OTLP_ENDPOINT,
+// и добавляет путь /v1/traces, если его нет
+func otlpTracesURL(endpoint string) string {
+	url := strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url += "/v1/traces"
+	}
+	return url
+}
+
+// Shutdown отправляет накопленные спаны и останавливает экспорт
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	return t.provider.Shutdown(ctx)
+}
+
+// Start начинает спан, дочерний к спану из ctx. Спан обязательно завершать через End.
+func (t *Tracer) Start(ctx context.Context, name string, kind trace.SpanKind, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if t == nil {
+		return ctx, noop.Span{}
+	}
+	return t.tracer.Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+}
+
+// Handler открывает серверный спан на запрос, продолжая трассу из traceparent и
+// tracestate; name возвращает имя спана по запросу
+func (t *Tracer) Handler(next http.Handler, name func(r *http.Request) string) http.Handler {
+	if t == nil {
+		return next
+	}
+	return otelhttp.NewHandler(next, "",
+		otelhttp.WithTracerProvider(t.provider),
+		otelhttp.WithPropagators(t.propagator),
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string { return name(r) }),
+	)
+}
+
+// Transport оборачивает base: каждый исходящий запрос получает клиентский спан
+// и заголовки trace context
+func (t *Tracer) Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	if t == nil {
+		return base
+	}
+	return otelhttp.NewTransport(base,
+		otelhttp.WithTracerProvider(t.provider),
+		otelhttp.WithPropagators(t.propagator),
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string { return "HTTP " + r.Method }),
+	)
+}
@@ -0,0 +1,289 @@
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/trace"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// collector принимает OTLP/HTTP и разбирает тело по protobuf-схеме OTLP
+type collector struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []*coltracepb.ExportTraceServiceRequest
+}
+
+func newCollector(t *testing.T) *collector {
+	t.Helper()
+	c := &collector{}
+	c.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/x-protobuf" {
+			t.Errorf("unexpected export %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+			http.Error(w, "unsupported", http.StatusBadRequest)
+			return
+		}
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var req coltracepb.ExportTraceServiceRequest
+		if err = proto.Unmarshal(body, &req); err != nil {
+			t.Errorf("export payload does not match the OTLP schema: %v", err)
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		c.mu.Lock()
+		c.requests = append(c.requests, &req)
+		c.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/x-protobuf")
+		resp, _ := proto.Marshal(&coltracepb.ExportTraceServiceResponse{})
+		_, _ = w.Write(resp)
+	}))
+	t.Cleanup(c.Close)
+	return c
+}
+
+// spans все экспортированные спаны по имени
+func (c *collector) spans() map[string]*tracepb.Span {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	spans := make(map[string]*tracepb.Span)
+	for _, req := range c.requests {
+		for _, rs := range req.ResourceSpans {
+			for _, ss := range rs.ScopeSpans {
+				for _, span := range ss.Spans {
+					spans[span.Name] = span
+				}
+			}
+		}
+	}
+	return spans
+}
+
+func (c *collector) serviceNames() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var names []string
+	for _, req := range c.requests {
+		for _, rs := range req.ResourceSpans {
+			for _, attr := range rs.Resource.Attributes {
+				if attr.Key == "service.name" {
+					names = append(names, attr.Value.GetStringValue())
+				}
+			}
+		}
+	}
+	return names
+}
+
+func newTestTracer(t *testing.T, c *collector, ratio float64) *Tracer {
+	t.Helper()
+	// адрес без /v1/traces, как в OTEL_EXPORTER_OTLP_ENDPOINT
+	tracer, err := New(Config{ServiceName: "wss-test", Exporter: ExporterOTLP, Endpoint: c.URL, SampleRatio: ratio})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tracer
+}
+
+func shutdown(t *testing.T, tracer *Tracer) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tracer.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func attr(span *tracepb.Span, key string) string {
+	for _, kv := range span.Attributes {
+		if kv.Key == key {
+			if s := kv.Value.GetStringValue(); s != "" {
+				return s
+			}
+			return strconv.FormatInt(kv.Value.GetIntValue(), 10)
+		}
+	}
+	return ""
+}
+
+func TestOTLPExport(t *testing.T) {
+	c := newCollector(t)
+	tracer := newTestTracer(t, c, 1)
+
+	ctx, parent := tracer.Start(context.Background(), "parent", trace.SpanKindServer, attribute.String("http.route", "/api/assets"))
+	_, child := tracer.Start(ctx, "child", trace.SpanKindClient, attribute.Int("retry", 3))
+	child.End()
+	parent.End()
+	shutdown(t, tracer)
+
+	spans := c.spans()
+	p, ch := spans["parent"], spans["child"]
+	if p == nil || ch == nil {
+		t.Fatalf("exported spans %v, want parent and child", spans)
+	}
+	if p.Kind != tracepb.Span_SPAN_KIND_SERVER || ch.Kind != tracepb.Span_SPAN_KIND_CLIENT {
+		t.Errorf("kinds = %v, %v", p.Kind, ch.Kind)
+	}
+	if string(ch.TraceId) != string(p.TraceId) || string(ch.ParentSpanId) != string(p.SpanId) {
+		t.Errorf("child is not linked to parent: %x/%x vs %x/%x", ch.TraceId, ch.ParentSpanId, p.TraceId, p.SpanId)
+	}
+	if len(p.TraceId) != 16 || len(p.SpanId) != 8 || len(p.ParentSpanId) != 0 {
+		t.Errorf("invalid ids in %v", p)
+	}
+	if attr(p, "http.route") != "/api/assets" || attr(ch, "retry") != "3" {
+		t.Errorf("attributes = %v, %v", p.Attributes, ch.Attributes)
+	}
+	if p.EndTimeUnixNano < p.StartTimeUnixNano || p.StartTimeUnixNano == 0 {
+		t.Errorf("invalid timestamps %d..%d", p.StartTimeUnixNano, p.EndTimeUnixNano)
+	}
+	if names := c.serviceNames(); len(names) == 0 || names[0] != "wss-test" {
+		t.Errorf("service.name = %v", names)
+	}
+}
+
+func TestPropagation(t *testing.T) {
+	c := newCollector(t)
+	tracer := newTestTracer(t, c, 1)
+
+	const tracestate = "vendor=abc,other=1"
+	var (
+		serverSC trace.SpanContext
+		member   string
+	)
+	backend := httptest.NewServer(tracer.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serverSC = trace.SpanContextFromContext(r.Context())
+		member = baggage.FromContext(r.Context()).Member("tenant").Value()
+	}), func(r *http.Request) string { return "server " + r.URL.Path }))
+	defer backend.Close()
+
+	// вызывающая сторона передает tracestate и baggage, которые сервис должен сохранить
+	incoming := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    mustTraceID(t, "4bf92f3577b34da6a3ce929d0e0e4736"),
+		SpanID:     trace.SpanID{0, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+	state, err := trace.ParseTraceState(tracestate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	incoming = incoming.WithTraceState(state)
+	tenant, _ := baggage.NewMember("tenant", "acme")
+	bag, _ := baggage.New(tenant)
+	ctx := baggage.ContextWithBaggage(trace.ContextWithRemoteSpanContext(context.Background(), incoming), bag)
+
+	client := &http.Client{Transport: tracer.Transport(nil)}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, backend.URL+"/ping", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	shutdown(t, tracer)
+
+	if serverSC.TraceID() != incoming.TraceID() {
+		t.Errorf("server trace id = %s, want %s", serverSC.TraceID(), incoming.TraceID())
+	}
+	if serverSC.TraceState().String() != tracestate {
+		t.Errorf("tracestate = %q, want %q", serverSC.TraceState().String(), tracestate)
+	}
+	if member != "acme" {
+		t.Errorf("baggage tenant = %q, want acme", member)
+	}
+
+	spans := c.spans()
+	clientSpan, serverSpan := spans["HTTP GET"], spans["server /ping"]
+	if clientSpan == nil || serverSpan == nil {
+		t.Fatalf("exported spans %v, want client and server spans", spans)
+	}
+	if string(serverSpan.ParentSpanId) != string(clientSpan.SpanId) {
+		t.Errorf("server span parent = %x, want client span %x", serverSpan.ParentSpanId, clientSpan.SpanId)
+	}
+	if serverSpan.TraceState != tracestate {
+		t.Errorf("exported tracestate = %q", serverSpan.TraceState)
+	}
+}
+
+func TestSampling(t *testing.T) {
+	c := newCollector(t)
+	tracer := newTestTracer(t, c, 0)
+
+	// корневые трассы при доле 0 не записываются
+	_, root := tracer.Start(context.Background(), "root", trace.SpanKindServer)
+	if root.SpanContext().IsSampled() {
+		t.Error("root span sampled with ratio 0")
+	}
+	root.End()
+
+	// но решение вызывающей стороны записать трассу соблюдается
+	parent := trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    mustTraceID(t, "0af7651916cd43dd8448eb211c80319c"),
+		SpanID:     trace.SpanID{1, 2, 3, 4, 5, 6, 7, 8},
+		TraceFlags: trace.FlagsSampled,
+		Remote:     true,
+	})
+	_, child := tracer.Start(trace.ContextWithRemoteSpanContext(context.Background(), parent), "child", trace.SpanKindServer)
+	child.End()
+	shutdown(t, tracer)
+
+	spans := c.spans()
+	if spans["root"] != nil || spans["child"] == nil {
+		t.Fatalf("exported spans %v, want only child", spans)
+	}
+}
+
+func TestNilTracer(t *testing.T) {
+	var tracer *Tracer
+	ctx, span := tracer.Start(context.Background(), "noop", trace.SpanKindInternal)
+	span.SetAttributes(attribute.String("k", "v"))
+	span.End()
+	if trace.SpanContextFromContext(ctx).IsValid() {
+		t.Error("nil tracer must not start spans")
+	}
+	if tracer.Transport(nil) != http.DefaultTransport {
+		t.Error("nil tracer must not wrap the transport")
+	}
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOTLPTracesURL(t *testing.T) {
+	for endpoint, want := range map[string]string{
+		"http://localhost:4318":              "http://localhost:4318/v1/traces",
+		"http://localhost:4318/":             "http://localhost:4318/v1/traces",
+		"https://otel.example.com/v1/traces": "https://otel.example.com/v1/traces",
+	} {
+		if got := otlpTracesURL(endpoint); got != want {
+			t.Errorf("otlpTracesURL(%q) = %q, want %q", endpoint, got, want)
+		}
+	}
+}
+
+func mustTraceID(t *testing.T, s string) trace.TraceID {
+	t.Helper()
+	var id trace.TraceID
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != len(id) {
+		t.Fatalf("invalid trace id %q", s)
+	}
+	copy(id[:], b)
+	return id
+}
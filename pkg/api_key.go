@@ -0,0 +1,38 @@
+package pkg
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"strings"
+)
+
+const apiKeyPrefix = "wss_"
+
+// GenerateAPIKey создает новый API-ключ вида wss_<id>_<secret>.
+// id хранится открыто и используется для поиска, secret - только в виде хэша.
+func GenerateAPIKey() (id, key string) {
+	id = GenerateRandomID(8)
+	return id, apiKeyPrefix + id + "_" + GenerateRandomID(32)
+}
+
+// ParseAPIKey возвращает id ключа, если token похож на API-ключ
+func ParseAPIKey(token string) (string, bool) {
+	if !strings.HasPrefix(token, apiKeyPrefix) {
+		return "", false
+	}
+	id, secret, ok := strings.Cut(strings.TrimPrefix(token, apiKeyPrefix), "_")
+	if !ok || id == "" || secret == "" {
+		return "", false
+	}
+	return id, true
+}
+
+func HashAPIKey(key string) string {
+	hash := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(hash[:])
+}
+
+func ValidateAPIKey(key, hash string) bool {
+	return subtle.ConstantTimeCompare([]byte(HashAPIKey(key)), []byte(hash)) == 1
+}
@@ -0,0 +1,305 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// AssetInfo метаданные файла, как их отдает сервер
+type AssetInfo struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+	// SHA256 hex-хэш содержимого, он же ETag
+	SHA256    string    `json:"sha256"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Deleted   bool      `json:"deleted"`
+}
+
+// ProgressFunc получает число переданных байт и общий размер (-1, если неизвестен)
+type ProgressFunc func(done, total int64)
+
+// UploadOptions необязательные параметры Upload и Update
+type UploadOptions struct {
+	// Overwrite заменяет существующий файл в Upload; в Update создает отсутствующий
+	Overwrite bool
+	// Size размер содержимого, если r не умеет Len() или Seek;
+	// без него тело уходит chunked
+	Size     int64
+	Progress ProgressFunc
+}
+
+// Upload загружает новый файл из r. Если файл уже есть и Overwrite не задан,
+// возвращает ошибку, для которой errors.Is(err, ErrAssetExists).
+// Повторить загрузку после сбоя клиент может, только если r реализует io.Seeker.
+func (c *Client) Upload(ctx context.Context, name string, r io.Reader, opts *UploadOptions) (AssetInfo, error) {
+	return c.put(ctx, http.MethodPost, assetPath("upload-asset", name), "overwrite", r, opts)
+}
+
+// Update заменяет содержимое существующего файла; с Overwrite создает отсутствующий
+func (c *Client) Update(ctx context.Context, name string, r io.Reader, opts *UploadOptions) (AssetInfo, error) {
+	return c.put(ctx, http.MethodPut, assetPath("update-asset", name), "upsert", r, opts)
+}
+
+func (c *Client) put(ctx context.Context, method, path, flag string, r io.Reader, opts *UploadOptions) (AssetInfo, error) {
+	if opts == nil {
+		opts = &UploadOptions{}
+	}
+	size := opts.Size
+	if size <= 0 {
+		size = readerSize(r)
+	}
+	query := url.Values{}
+	if opts.Overwrite {
+		query.Set(flag, "true")
+	}
+	body := r
+	if opts.Progress != nil {
+		body = &progressReader{r: r, total: size, progress: opts.Progress}
+	}
+
+	resp, err := c.do(ctx, request{method: method, path: path, query: query, body: body, contentLength: size})
+	if err != nil {
+		return AssetInfo{}, err
+	}
+	var info AssetInfo
+	err = decode(resp, &info)
+	return info, err
+}
+
+// readerSize размер тела для Content-Length, если его можно узнать без чтения
+func readerSize(r io.Reader) int64 {
+	switch v := r.(type) {
+	case interface{ Len() int }:
+		return int64(v.Len())
+	case io.Seeker:
+		cur, err := v.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return -1
+		}
+		end, err := v.Seek(0, io.SeekEnd)
+		if err != nil {
+			return -1
+		}
+		if _, err = v.Seek(cur, io.SeekStart); err != nil {
+			return -1
+		}
+		return end - cur
+	}
+	return -1
+}
+
+// progressReader сообщает о прочитанных байтах; при повторе запроса тело
+// перематывается через Seek, и счетчик начинается заново
+type progressReader struct {
+	r        io.Reader
+	done     int64
+	total    int64
+	progress ProgressFunc
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.done += int64(n)
+		p.progress(p.done, p.total)
+	}
+	return n, err
+}
+
+func (p *progressReader) Seek(offset int64, whence int) (int64, error) {
+	s, ok := p.r.(io.Seeker)
+	if !ok {
+		return 0, errors.New("body is not seekable")
+	}
+	pos, err := s.Seek(offset, whence)
+	if err == nil && whence == io.SeekStart {
+		p.done = 0
+	}
+	return pos, err
+}
+
+// Download пишет содержимое файла в w потоком и возвращает число записанных байт
+func (c *Client) Download(ctx context.Context, name string, w io.Writer, progress ProgressFunc) (int64, error) {
+	resp, err := c.do(ctx, request{
+		method: http.MethodGet,
+		path:   assetPath("asset", name),
+		query:  url.Values{"raw": {"true"}},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if progress != nil {
+		w = &progressWriter{w: w, total: resp.ContentLength, progress: progress}
+	}
+	return io.Copy(w, resp.Body)
+}
+
+type progressWriter struct {
+	w        io.Writer
+	done     int64
+	total    int64
+	progress ProgressFunc
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.done += int64(n)
+	p.progress(p.done, p.total)
+	return n, err
+}
+
+// Delete переносит файл в корзину
+func (c *Client) Delete(ctx context.Context, name string) error {
+	return c.call(ctx, http.MethodPut, assetPath("delete-asset", name), nil)
+}
+
+// Purge удаляет файл безвозвратно вместе с его ссылками
+func (c *Client) Purge(ctx context.Context, name string) error {
+	return c.call(ctx, http.MethodDelete, assetPath("delete-asset", name), nil)
+}
+
+// Restore возвращает файл из корзины
+func (c *Client) Restore(ctx context.Context, name string) error {
+	return c.call(ctx, http.MethodPost, assetPath("restore-asset", name), nil)
+}
+
+// Rename переименовывает файл; занятое имя дает ErrAssetExists
+func (c *Client) Rename(ctx context.Context, name, newName string) (AssetInfo, error) {
+	resp, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   assetPath("rename-asset", name),
+		json:   map[string]string{"name": newName},
+	})
+	if err != nil {
+		return AssetInfo{}, err
+	}
+	var info AssetInfo
+	err = decode(resp, &info)
+	return info, err
+}
+
+// Copy копирует файл под новым именем; занятое имя без overwrite дает ErrAssetExists
+func (c *Client) Copy(ctx context.Context, name, newName string, overwrite bool) (AssetInfo, error) {
+	resp, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   assetPath("copy-asset", name),
+		json:   map[string]interface{}{"name": newName, "overwrite": overwrite},
+	})
+	if err != nil {
+		return AssetInfo{}, err
+	}
+	var info AssetInfo
+	err = decode(resp, &info)
+	return info, err
+}
+
+func (c *Client) call(ctx context.Context, method, path string, body interface{}) error {
+	resp, err := c.do(ctx, request{method: method, path: path, json: body})
+	if err != nil {
+		return err
+	}
+	return discard(resp)
+}
+
+// ListOptions параметры обхода списка файлов
+type ListOptions struct {
+	// Prefix только файлы с этим префиксом имени, например "docs/"
+	Prefix string
+	// PageSize файлов на страницу, по умолчанию и не больше 100
+	PageSize int
+}
+
+// AssetIterator постраничный обход списка, страницы запрашиваются по мере чтения:
+//
+//	it := c.Assets(ctx, client.ListOptions{Prefix: "docs/"})
+//	for it.Next() {
+//		fmt.Println(it.Asset().Name)
+//	}
+//	if err := it.Err(); err != nil { ... }
+type AssetIterator struct {
+	ctx   context.Context
+	c     *Client
+	path  string
+	query url.Values
+	size  int
+
+	page    int
+	buf     []AssetInfo
+	cur     AssetInfo
+	hasMore bool
+	err     error
+}
+
+// Assets обходит файлы пользователя
+func (c *Client) Assets(ctx context.Context, opts ListOptions) *AssetIterator {
+	query := url.Values{"details": {"true"}}
+	if opts.Prefix != "" {
+		query.Set("prefix", opts.Prefix)
+	}
+	return c.iterate(ctx, "/api/assets", query, opts.PageSize)
+}
+
+// Trash обходит файлы в корзине
+func (c *Client) Trash(ctx context.Context, opts ListOptions) *AssetIterator {
+	query := url.Values{}
+	if opts.Prefix != "" {
+		query.Set("prefix", opts.Prefix)
+	}
+	return c.iterate(ctx, "/api/trash", query, opts.PageSize)
+}
+
+func (c *Client) iterate(ctx context.Context, path string, query url.Values, size int) *AssetIterator {
+	if size <= 0 {
+		size = 100
+	}
+	query.Set("size", strconv.Itoa(size))
+	return &AssetIterator{ctx: ctx, c: c, path: path, query: query, size: size, hasMore: true}
+}
+
+// Next переходит к следующему файлу; false в конце списка или при ошибке
+func (it *AssetIterator) Next() bool {
+	for len(it.buf) == 0 {
+		if !it.hasMore || it.err != nil {
+			return false
+		}
+		it.fetch()
+	}
+	it.cur, it.buf = it.buf[0], it.buf[1:]
+	return true
+}
+
+func (it *AssetIterator) fetch() {
+	it.page++
+	it.query.Set("page", strconv.Itoa(it.page))
+	resp, err := it.c.do(it.ctx, request{method: http.MethodGet, path: it.path, query: it.query})
+	if err != nil {
+		it.err = err
+		return
+	}
+	var page struct {
+		Assets  []AssetInfo `json:"assets"`
+		HasMore bool        `json:"hasMore"`
+	}
+	if it.err = decode(resp, &page); it.err != nil {
+		return
+	}
+	it.buf, it.hasMore = page.Assets, page.HasMore && len(page.Assets) > 0
+}
+
+// Asset текущий файл после успешного Next
+func (it *AssetIterator) Asset() AssetInfo {
+	return it.cur
+}
+
+// Err ошибка, на которой остановился обход
+func (it *AssetIterator) Err() error {
+	return it.err
+}
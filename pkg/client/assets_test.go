@@ -0,0 +1,218 @@
+package client_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+	"web-storage-service/pkg/client"
+)
+
+// progressLog запоминает вызовы ProgressFunc
+type progressLog struct {
+	calls []int64
+	total int64
+}
+
+func (p *progressLog) progress(done, total int64) {
+	p.calls = append(p.calls, done)
+	p.total = total
+}
+
+func (p *progressLog) last() int64 {
+	if len(p.calls) == 0 {
+		return 0
+	}
+	return p.calls[len(p.calls)-1]
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func loggedIn(t *testing.T, ctx context.Context, c *client.Client) *client.Client {
+	t.Helper()
+	if err := c.Login(ctx, "alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestUploadWithProgress(t *testing.T) {
+	ts, _ := newDatabaseServer(t, nil)
+	ctx := context.Background()
+	c := loggedIn(t, ctx, newClient(t, ts))
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), 1<<16)
+	var p progressLog
+	info, err := c.Upload(ctx, "docs/big.bin", bytes.NewReader(content), &client.UploadOptions{Progress: p.progress})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "docs/big.bin" || info.Size != int64(len(content)) || info.SHA256 != sha256Hex(content) {
+		t.Errorf("info = %+v, want name, size %d and sha256 of the content", info, len(content))
+	}
+	if p.total != int64(len(content)) || p.last() != int64(len(content)) || !slices.IsSorted(p.calls) {
+		t.Errorf("progress reported %v of %d, want increasing up to %d", p.calls, p.total, len(content))
+	}
+
+	if _, err = c.Upload(ctx, "docs/big.bin", strings.NewReader("new"), nil); !errors.Is(err, client.ErrAssetExists) {
+		t.Errorf("second upload err = %v, want ErrAssetExists", err)
+	}
+	info, err = c.Upload(ctx, "docs/big.bin", strings.NewReader("new"), &client.UploadOptions{Overwrite: true})
+	if err != nil || info.Size != 3 || info.SHA256 != sha256Hex([]byte("new")) {
+		t.Errorf("overwrite = %+v, %v", info, err)
+	}
+
+	// размер неизвестен: тело уходит chunked, прогресс без общего размера
+	p = progressLog{}
+	info, err = c.Upload(ctx, "docs/stream.txt", io.MultiReader(strings.NewReader("streamed "), strings.NewReader("body")), &client.UploadOptions{Progress: p.progress})
+	if err != nil || info.Size != int64(len("streamed body")) {
+		t.Errorf("streamed upload = %+v, %v", info, err)
+	}
+	if p.total != -1 || p.last() != int64(len("streamed body")) {
+		t.Errorf("progress reported %d of %d, want %d of -1", p.last(), p.total, len("streamed body"))
+	}
+}
+
+func TestUploadRetriedAfterServiceUnavailable(t *testing.T) {
+	ts, log := newDatabaseServer(t, unavailableFirst("/api/upload-asset/", 1, "0"))
+	ctx := context.Background()
+	c := loggedIn(t, ctx, newClient(t, ts))
+
+	// тело перематывается для повтора, и прогресс начинается заново
+	content := bytes.Repeat([]byte("retry"), 1<<14)
+	var p progressLog
+	info, err := c.Upload(ctx, "retry.bin", bytes.NewReader(content), &client.UploadOptions{Progress: p.progress})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := log.count("POST /api/upload-asset/retry.bin"); got != 2 {
+		t.Errorf("upload requests = %d, want 2", got)
+	}
+	if info.SHA256 != sha256Hex(content) || p.last() != int64(len(content)) {
+		t.Errorf("info = %+v, progress %d, want the full content", info, p.last())
+	}
+
+	// тело без Seek повторить нельзя, и 503 возвращается вызывающему
+	ts, log = newDatabaseServer(t, unavailableFirst("/api/upload-asset/", 1, "0"))
+	c = loggedIn(t, ctx, newClient(t, ts))
+	_, err = c.Upload(ctx, "once.txt", io.MultiReader(strings.NewReader("once")), nil)
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.Status != 503 {
+		t.Fatalf("err = %v, want 503", err)
+	}
+	if got := log.count("POST /api/upload-asset/once.txt"); got != 1 {
+		t.Errorf("upload requests = %d, want 1", got)
+	}
+}
+
+func TestDownload(t *testing.T) {
+	ts, _ := newDatabaseServer(t, nil)
+	ctx := context.Background()
+	c := loggedIn(t, ctx, newClient(t, ts))
+
+	content := bytes.Repeat([]byte{0, 1, 2, 0xff}, 100_000)
+	if _, err := c.Upload(ctx, "dir/data.bin", bytes.NewReader(content), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	var p progressLog
+	n, err := c.Download(ctx, "dir/data.bin", &buf, p.progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(content)) || !bytes.Equal(buf.Bytes(), content) {
+		t.Errorf("downloaded %d bytes, want %d identical bytes", n, len(content))
+	}
+	if p.total != int64(len(content)) || p.last() != int64(len(content)) {
+		t.Errorf("progress reported %d of %d, want %d of %d", p.last(), p.total, len(content), len(content))
+	}
+
+	_, err = c.Download(ctx, "dir/missing.bin", io.Discard, nil)
+	var apiErr *client.Error
+	if !errors.Is(err, client.ErrNotFound) || !errors.As(err, &apiErr) || apiErr.Status != 404 {
+		t.Errorf("missing asset err = %v, want ErrNotFound", err)
+	}
+
+	// файл в корзине не скачивается, после восстановления снова доступен
+	if err = c.Delete(ctx, "dir/data.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Download(ctx, "dir/data.bin", io.Discard, nil); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("trashed asset err = %v, want ErrNotFound", err)
+	}
+	if err = c.Restore(ctx, "dir/data.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if n, err = c.Download(ctx, "dir/data.bin", io.Discard, nil); err != nil || n != int64(len(content)) {
+		t.Errorf("restored asset: %d bytes, %v", n, err)
+	}
+}
+
+func TestAssetIterator(t *testing.T) {
+	ts, log := newDatabaseServer(t, nil)
+	ctx := context.Background()
+	c := loggedIn(t, ctx, newClient(t, ts))
+
+	var want []string
+	for i := 0; i < 7; i++ {
+		name := fmt.Sprintf("pages/%02d.txt", i)
+		if _, err := c.Upload(ctx, name, strings.NewReader(name), nil); err != nil {
+			t.Fatal(err)
+		}
+		want = append(want, name)
+	}
+	if _, err := c.Upload(ctx, "other/skip.txt", strings.NewReader("x"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	it := c.Assets(ctx, client.ListOptions{Prefix: "pages/", PageSize: 3})
+	for it.Next() {
+		asset := it.Asset()
+		if asset.Size != int64(len(asset.Name)) || asset.SHA256 != sha256Hex([]byte(asset.Name)) {
+			t.Errorf("asset %+v has wrong metadata", asset)
+		}
+		got = append(got, asset.Name)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(got)
+	if !slices.Equal(got, want) {
+		t.Errorf("listed %v, want %v", got, want)
+	}
+	// страницы 3 + 3 + 1: неполная третья страница заканчивает обход
+	if n := log.count("GET /api/assets"); n != 3 {
+		t.Errorf("page requests = %d, want 3", n)
+	}
+
+	// страница больше 100 урезается сервером, и обход все равно проходит весь список
+	it = c.Assets(ctx, client.ListOptions{PageSize: 500})
+	count := 0
+	for it.Next() {
+		count++
+	}
+	if it.Err() != nil || count != len(want)+1 {
+		t.Errorf("listed %d assets, %v, want %d", count, it.Err(), len(want)+1)
+	}
+
+	// ошибка запроса страницы останавливает обход и доступна через Err
+	if err := c.Logout(ctx); err != nil {
+		t.Fatal(err)
+	}
+	it = c.Assets(ctx, client.ListOptions{})
+	if it.Next() || !errors.Is(it.Err(), client.ErrNotLoggedIn) {
+		t.Errorf("iterator without token: Err = %v, want ErrNotLoggedIn", it.Err())
+	}
+}
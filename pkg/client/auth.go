@@ -0,0 +1,98 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+type loginResponse struct {
+	Token             string `json:"token"`
+	ExpiresIn         int64  `json:"expires_in"`
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	Challenge         string `json:"challenge"`
+}
+
+// Login входит по логину и паролю. Если у пользователя включена 2FA, возвращает
+// ErrTwoFactorRequired, и вход завершает CompleteTwoFactor. Логин и пароль
+// запоминаются, чтобы клиент сам входил заново, когда токен истечет.
+func (c *Client) Login(ctx context.Context, login, password string) error {
+	c.mu.Lock()
+	c.login, c.password = login, password
+	c.mu.Unlock()
+	return c.Refresh(ctx)
+}
+
+// Refresh получает новый токен по логину и паролю из Login или WithCredentials.
+// Пользователю с 2FA нужен CompleteTwoFactor, поэтому Refresh вернет ErrTwoFactorRequired.
+func (c *Client) Refresh(ctx context.Context) error {
+	c.mu.Lock()
+	login, password := c.login, c.password
+	c.mu.Unlock()
+
+	resp, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/api/auth",
+		json:   map[string]string{"login": login, "password": password},
+		public: true,
+	})
+	if err != nil {
+		return err
+	}
+	var body loginResponse
+	if err = decode(resp, &body); err != nil {
+		return err
+	}
+	return c.acceptLogin(body)
+}
+
+// CompleteTwoFactor завершает вход кодом TOTP или кодом восстановления
+func (c *Client) CompleteTwoFactor(ctx context.Context, code string) error {
+	c.mu.Lock()
+	challenge := c.challenge
+	c.mu.Unlock()
+
+	resp, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/api/auth/2fa",
+		json:   map[string]string{"challenge": challenge, "code": code},
+		public: true,
+	})
+	if err != nil {
+		return err
+	}
+	var body loginResponse
+	if err = decode(resp, &body); err != nil {
+		return err
+	}
+	return c.acceptLogin(body)
+}
+
+func (c *Client) acceptLogin(body loginResponse) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if body.TwoFactorRequired {
+		c.challenge = body.Challenge
+		return ErrTwoFactorRequired
+	}
+	c.token, c.challenge = body.Token, ""
+	c.expiresAt = time.Time{}
+	if body.ExpiresIn > 0 {
+		c.expiresAt = time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+	}
+	return nil
+}
+
+// Logout завершает сессию на сервере и забывает токен и пароль
+func (c *Client) Logout(ctx context.Context) error {
+	resp, err := c.do(ctx, request{method: http.MethodPost, path: "/api/logout"})
+	if err == nil {
+		err = discard(resp)
+	}
+
+	c.mu.Lock()
+	c.token, c.expiresAt, c.login, c.password = "", time.Time{}, "", ""
+	c.mu.Unlock()
+	return err
+}
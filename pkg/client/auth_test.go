@@ -0,0 +1,98 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"web-storage-service/pkg/client"
+)
+
+// listAll обходит все файлы и возвращает ошибку обхода
+func listAll(ctx context.Context, c *client.Client) ([]client.AssetInfo, error) {
+	var assets []client.AssetInfo
+	it := c.Assets(ctx, client.ListOptions{})
+	for it.Next() {
+		assets = append(assets, it.Asset())
+	}
+	return assets, it.Err()
+}
+
+func TestLoginAndRefresh(t *testing.T) {
+	ts, log := newDatabaseServer(t, nil)
+	ctx := context.Background()
+	c := newClient(t, ts)
+
+	if err := c.Login(ctx, "alice", "wrong"); !errors.Is(err, client.ErrInvalidCredentials) || !errors.Is(err, client.ErrUnauthorized) {
+		t.Fatalf("login with a wrong password err = %v, want invalid_credentials", err)
+	}
+	if token, _ := c.Token(); token != "" {
+		t.Errorf("token %q kept after a failed login", token)
+	}
+
+	if err := c.Login(ctx, "alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	first, _ := c.Token()
+	if first == "" {
+		t.Fatal("no token after login")
+	}
+	if _, err := listAll(ctx, c); err != nil {
+		t.Fatalf("listing with the new token: %v", err)
+	}
+
+	if err := c.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+	second, _ := c.Token()
+	if second == "" || second == first {
+		t.Errorf("refresh returned token %q, want a new one", second)
+	}
+	if _, err := listAll(ctx, c); err != nil {
+		t.Fatalf("listing after refresh: %v", err)
+	}
+	if got := log.count("POST /api/auth"); got != 3 {
+		t.Errorf("login requests = %d, want 3", got)
+	}
+
+	if err := c.Logout(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listAll(ctx, c); !errors.Is(err, client.ErrNotLoggedIn) {
+		t.Errorf("after logout err = %v, want ErrNotLoggedIn", err)
+	}
+	if _, err := listAll(ctx, newClient(t, ts, client.WithToken(second))); !errors.Is(err, client.ErrUnauthorized) {
+		t.Errorf("token after logout err = %v, want 401", err)
+	}
+}
+
+func TestLoginAgainWhenTokenRevoked(t *testing.T) {
+	ts, log := newDatabaseServer(t, nil)
+	ctx := context.Background()
+
+	// с WithCredentials клиент входит сам при первом запросе
+	c := newClient(t, ts, client.WithCredentials("alice", "secret"))
+	if _, err := listAll(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	revoked, _ := c.Token()
+	if revoked == "" || log.count("POST /api/auth") != 1 {
+		t.Fatalf("token %q after %d logins, want one login", revoked, log.count("POST /api/auth"))
+	}
+
+	// сессию завершили в другом месте: на 401 клиент один раз входит заново и повторяет запрос
+	if err := newClient(t, ts, client.WithToken(revoked)).Logout(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := listAll(ctx, c); err != nil {
+		t.Fatalf("listing after the session was revoked: %v", err)
+	}
+	if token, _ := c.Token(); token == revoked || token == "" {
+		t.Errorf("token = %q, want a new session", token)
+	}
+	if got := log.count("POST /api/auth"); got != 2 {
+		t.Errorf("login requests = %d, want 2", got)
+	}
+	if got := log.count("GET /api/assets"); got != 3 {
+		t.Errorf("list requests = %d, want 3 (one of them rejected with 401)", got)
+	}
+}
@@ -0,0 +1,83 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Типы событий ленты изменений
+const (
+	EventCreate  = "create"
+	EventUpdate  = "update"
+	EventDelete  = "delete"
+	EventRestore = "restore"
+)
+
+// ChangeEvent событие ленты изменений
+type ChangeEvent struct {
+	Seq  int64  `json:"seq"`
+	Type string `json:"type"`
+	Name string `json:"name"`
+	// SHA256 и Size версии файла после события; у delete пустые
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+	// Permanent у delete: файл удален окончательно, а не перенесен в корзину
+	Permanent bool      `json:"permanent"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ChangePage ответ ленты: Cursor передается в следующий вызов Changes
+type ChangePage struct {
+	Cursor  int64         `json:"cursor"`
+	Events  []ChangeEvent `json:"events"`
+	HasMore bool          `json:"hasMore"`
+}
+
+// ChangesOptions параметры Changes
+type ChangesOptions struct {
+	// Prefix только файлы с этим префиксом имени
+	Prefix string
+	// Wait сколько сервер ждет событий, если их еще нет; 0 отвечает сразу.
+	// Сервер ограничивает ожидание CHANGES_MAX_WAIT.
+	Wait time.Duration
+}
+
+// ErrCursorExpired события после курсора уже удалены: нужно перечитать список
+// файлов и продолжить с CurrentCursor
+var ErrCursorExpired = &Error{Code: CodeCursorExpired}
+
+// CurrentCursor текущий курсор ленты. Чтобы ничего не пропустить, его берут до
+// чтения списка файлов и затем следят за изменениями с него.
+func (c *Client) CurrentCursor(ctx context.Context) (int64, error) {
+	page, err := c.changes(ctx, url.Values{})
+	return page.Cursor, err
+}
+
+// Changes события после курсора since. Если HasMore, следующая страница уже готова;
+// иначе следующий вызов ждет новых событий до opts.Wait.
+func (c *Client) Changes(ctx context.Context, since int64, opts *ChangesOptions) (ChangePage, error) {
+	if opts == nil {
+		opts = &ChangesOptions{}
+	}
+	query := url.Values{
+		"since": {strconv.FormatInt(since, 10)},
+		"wait":  {strconv.Itoa(int(opts.Wait / time.Second))},
+	}
+	if opts.Prefix != "" {
+		query.Set("prefix", opts.Prefix)
+	}
+	return c.changes(ctx, query)
+}
+
+func (c *Client) changes(ctx context.Context, query url.Values) (ChangePage, error) {
+	var page ChangePage
+	resp, err := c.do(ctx, request{method: http.MethodGet, path: "/api/changes", query: query})
+	if err != nil {
+		return page, err
+	}
+	err = decode(resp, &page)
+	return page, err
+}
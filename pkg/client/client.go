@@ -0,0 +1,329 @@
+// Package client типизированный Go-клиент web-storage-service: вход, загрузка и
+// скачивание файлов потоком, списки с постраничным обходом, корзина и ссылки.
+//
+//	c, _ := client.New("https://storage.example.com")
+//	if err := c.Login(ctx, "alice", "secret"); err != nil { ... }
+//	info, err := c.Upload(ctx, "docs/report.pdf", f, nil)
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RetryPolicy повтор запросов, которые сервер не обработал (429, 503) или которые
+// безопасно повторить (GET/PUT/DELETE при сетевой ошибке, 502, 504)
+type RetryPolicy struct {
+	// MaxAttempts всего попыток вместе с первой; 1 выключает повторы
+	MaxAttempts int
+	// MinBackoff пауза перед первым повтором, дальше удваивается до MaxBackoff.
+	// Retry-After длиннее MaxBackoff не ждем и возвращаем ошибку.
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultRetryPolicy политика по умолчанию
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 4, MinBackoff: 200 * time.Millisecond, MaxBackoff: 10 * time.Second}
+
+// refreshBefore за сколько до истечения токена клиент входит заново
+const refreshBefore = 30 * time.Second
+
+type Client struct {
+	baseURL *url.URL
+	http    *http.Client
+	retry   RetryPolicy
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+	// login и password запоминаются для Refresh и автоматического повторного входа
+	login, password string
+	challenge       string
+}
+
+// Option настройка клиента для New
+type Option func(*Client)
+
+// WithHTTPClient задает http.Client, например с собственным TLS или таймаутом
+func WithHTTPClient(h *http.Client) Option {
+	return func(c *Client) { c.http = h }
+}
+
+// WithToken использует готовый токен: API-ключ, токен сессии или JWT
+func WithToken(token string) Option {
+	return func(c *Client) { c.token = token }
+}
+
+// WithCredentials входит при первом запросе и заново, когда токен истекает
+func WithCredentials(login, password string) Option {
+	return func(c *Client) { c.login, c.password = login, password }
+}
+
+// WithRetry заменяет DefaultRetryPolicy
+func WithRetry(p RetryPolicy) Option {
+	return func(c *Client) { c.retry = p }
+}
+
+// New создает клиент для сервиса по адресу baseURL, например https://storage.example.com
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("parsing base url: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("base url must be http or https, got %q", baseURL)
+	}
+	c := &Client{baseURL: u, http: http.DefaultClient, retry: DefaultRetryPolicy}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.retry.MaxAttempts < 1 {
+		c.retry.MaxAttempts = 1
+	}
+	return c, nil
+}
+
+// Token текущий токен и время его истечения (нулевое, если сервер его не сообщил)
+func (c *Client) Token() (token string, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token, c.expiresAt
+}
+
+// request описание одного вызова API
+type request struct {
+	method string
+	// path уже экранированный путь, например /api/asset/a%2Fb.txt
+	path  string
+	query url.Values
+	// json тело в JSON; body сырое тело, для повторов оно должно быть io.Seeker
+	json          interface{}
+	body          io.Reader
+	contentLength int64
+	// public запрос без токена
+	public bool
+}
+
+// do выполняет запрос с повторами и повторным входом; ответы 4xx/5xx превращаются в *Error
+func (c *Client) do(ctx context.Context, req request) (*http.Response, error) {
+	var payload []byte
+	if req.json != nil {
+		var err error
+		if payload, err = json.Marshal(req.json); err != nil {
+			return nil, err
+		}
+	}
+	// сырое тело можно отправить заново, только если его можно перемотать
+	var seeker io.Seeker
+	var start int64
+	if req.body != nil {
+		if s, ok := req.body.(io.Seeker); ok {
+			if pos, err := s.Seek(0, io.SeekCurrent); err == nil {
+				seeker, start = s, pos
+			}
+		}
+	}
+	rewindable := req.body == nil || seeker != nil
+	idempotent := req.method == http.MethodGet || req.method == http.MethodHead ||
+		req.method == http.MethodPut || req.method == http.MethodDelete
+
+	reauthenticated := false
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && seeker != nil {
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return nil, err
+			}
+		}
+
+		httpReq, err := c.newRequest(ctx, req, payload)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := c.http.Do(httpReq)
+		last := attempt >= c.retry.MaxAttempts || !rewindable
+		if err != nil {
+			if last || !idempotent || ctx.Err() != nil {
+				return nil, err
+			}
+			if err = sleep(ctx, c.backoff(attempt)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if resp.StatusCode < 400 {
+			return resp, nil
+		}
+
+		apiErr := parseError(resp)
+		// истекший токен: входим заново один раз, если известны логин и пароль
+		if resp.StatusCode == http.StatusUnauthorized && !req.public && !reauthenticated && rewindable && c.hasCredentials() {
+			reauthenticated = true
+			if err = c.Refresh(ctx); err != nil {
+				return nil, err
+			}
+			attempt--
+			continue
+		}
+		if last || !c.retryable(apiErr, idempotent) {
+			return nil, apiErr
+		}
+		wait := max(c.backoff(attempt), apiErr.RetryAfter)
+		if err = sleep(ctx, wait); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *Client) newRequest(ctx context.Context, req request, payload []byte) (*http.Request, error) {
+	u := *c.baseURL
+	u.RawPath = c.baseURL.EscapedPath() + req.path
+	u.Path, _ = url.PathUnescape(u.RawPath)
+	u.RawQuery = req.query.Encode()
+
+	var body io.Reader
+	switch {
+	case payload != nil:
+		body = bytes.NewReader(payload)
+	case req.body != nil:
+		// NopCloser, чтобы транспорт не закрыл файл вызывающего между повторами
+		body = io.NopCloser(req.body)
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, req.method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		httpReq.Header.Set("Content-Type", "application/json")
+	}
+	if req.body != nil {
+		httpReq.Header.Set("Content-Type", "application/octet-stream")
+		// -1, если размер неизвестен: тогда тело уходит chunked
+		httpReq.ContentLength = req.contentLength
+	}
+	httpReq.Header.Set("Accept", "application/json")
+
+	if !req.public {
+		token, err := c.currentToken(ctx)
+		if err != nil {
+			return nil, err
+		}
+		httpReq.Header.Set("Authorization", "Bearer "+token)
+	}
+	return httpReq, nil
+}
+
+// currentToken возвращает токен, при необходимости входя заново по сохраненным логину и паролю
+func (c *Client) currentToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	token, expiresAt := c.token, c.expiresAt
+	c.mu.Unlock()
+
+	expiring := !expiresAt.IsZero() && time.Until(expiresAt) < refreshBefore
+	if (token == "" || expiring) && c.hasCredentials() {
+		if err := c.Refresh(ctx); err != nil {
+			return "", err
+		}
+		token, _ = c.Token()
+	}
+	if token == "" {
+		return "", ErrNotLoggedIn
+	}
+	return token, nil
+}
+
+func (c *Client) hasCredentials() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.login != ""
+}
+
+func (c *Client) retryable(err *Error, idempotent bool) bool {
+	switch err.Status {
+	case http.StatusTooManyRequests:
+		// блокировку входа ждать бессмысленно, а слишком долгий Retry-After вернем вызывающему
+		return err.Code == CodeRateLimited && err.RetryAfter <= c.retry.MaxBackoff
+	case http.StatusServiceUnavailable:
+		return err.RetryAfter <= c.retry.MaxBackoff
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return idempotent
+	}
+	return false
+}
+
+// backoff экспоненциальная пауза с разбросом, чтобы клиенты не повторяли запросы одновременно
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.retry.MinBackoff << (attempt - 1)
+	if d > c.retry.MaxBackoff || d <= 0 {
+		d = c.retry.MaxBackoff
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// parseError читает application/problem+json и закрывает тело ответа
+func parseError(resp *http.Response) *Error {
+	defer resp.Body.Close()
+
+	var problem struct {
+		Detail    string    `json:"detail"`
+		Code      ErrorCode `json:"code"`
+		RequestID string    `json:"request_id"`
+	}
+	_ = json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&problem)
+
+	apiErr := &Error{
+		Status:    resp.StatusCode,
+		Code:      problem.Code,
+		Detail:    problem.Detail,
+		RequestID: problem.RequestID,
+	}
+	if apiErr.RequestID == "" {
+		apiErr.RequestID = resp.Header.Get("X-Request-ID")
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		apiErr.RetryAfter = time.Duration(seconds) * time.Second
+	}
+	return apiErr
+}
+
+// decode читает JSON-ответ в v и закрывает тело
+func decode(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("decoding response: %w", err)
+	}
+	return nil
+}
+
+// discard дочитывает и закрывает тело, чтобы соединение вернулось в пул
+func discard(resp *http.Response) error {
+	defer resp.Body.Close()
+	_, err := io.Copy(io.Discard, resp.Body)
+	return err
+}
+
+// assetPath путь метода API для файла; / в имени экранируется, как того ждет сервер
+func assetPath(action, name string) string {
+	return "/api/" + action + "/" + url.PathEscape(name)
+}
@@ -0,0 +1,304 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"web-storage-service/internal/config"
+	"web-storage-service/internal/database"
+	"web-storage-service/internal/server"
+	"web-storage-service/pkg"
+	"web-storage-service/pkg/client"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Тесты поднимают настоящие маршруты server.RegisterRoutes на httptest.Server.
+// Сценарии с входом и файлами идут против PostgreSQL из DB_* (каждый тест в своей
+// временной базе) и пропускаются, если DB_DATABASE не задан. Ошибки и повторы
+// проверяются без базы: ее заменяет unavailableDB.
+
+// testPolicy короткие паузы, чтобы тесты повторов не ждали секундами
+var testPolicy = client.RetryPolicy{MaxAttempts: 4, MinBackoff: 10 * time.Millisecond, MaxBackoff: 2 * time.Second}
+
+// testConfig настройки сервера по умолчанию с DB_* из окружения; без базы
+// подставляются заглушки, чтобы конфигурация прошла проверку
+func testConfig(t *testing.T) config.Config {
+	t.Helper()
+	var args []string
+	if os.Getenv("DB_DATABASE") == "" {
+		args = append(args, "-db-database=unused", "-db-username=unused")
+	}
+	cfg, _, err := config.Load(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// requestLog считает запросы к маршрутам вида "GET /api/assets"
+type requestLog struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (l *requestLog) count(route string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.counts[route]
+}
+
+// newTestServer запускает сервер с маршрутами RegisterRoutes; wrap, если задан,
+// стоит перед ними, как балансировщик
+func newTestServer(t *testing.T, cfg config.Config, db database.Service, wrap func(http.Handler) http.Handler) (*httptest.Server, *requestLog) {
+	t.Helper()
+	srv, err := server.NewServer(cfg, db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(ctx)
+	})
+
+	log := &requestLog{counts: make(map[string]int)}
+	handler := srv.RegisterRoutes()
+	if wrap != nil {
+		handler = wrap(handler)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		log.mu.Lock()
+		log.counts[r.Method+" "+r.URL.Path]++
+		log.mu.Unlock()
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+	return ts, log
+}
+
+// newDatabaseServer сервер на временной базе; лимиты частоты выключены, чтобы частые входы не упирались в 429
+func newDatabaseServer(t *testing.T, wrap func(http.Handler) http.Handler) (*httptest.Server, *requestLog) {
+	t.Helper()
+	cfg := testConfig(t)
+	cfg.RateLimit.Enabled = false
+	return newTestServer(t, cfg, testDatabase(t, cfg), wrap)
+}
+
+func newClient(t *testing.T, ts *httptest.Server, opts ...client.Option) *client.Client {
+	t.Helper()
+	opts = append([]client.Option{client.WithHTTPClient(ts.Client()), client.WithRetry(testPolicy)}, opts...)
+	c, err := client.New(ts.URL, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+// testDatabase создает временную базу с примененными миграциями и удаляет ее после теста.
+// В миграциях есть пользователь alice с паролем secret.
+func testDatabase(t *testing.T, cfg config.Config) database.Service {
+	t.Helper()
+	if os.Getenv("DB_DATABASE") == "" {
+		t.Skip("set DB_HOST, DB_DATABASE, DB_USERNAME and DB_PASSWORD to run tests against PostgreSQL")
+	}
+
+	admin, err := database.New(cfg.Database, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(admin.Close)
+
+	name := "wss_test_" + strings.ToLower(pkg.GenerateRandomID(8))
+	if _, err = admin.Exec(context.Background(), "CREATE DATABASE "+pgx.Identifier{name}.Sanitize()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec(context.Background(), "DROP DATABASE "+pgx.Identifier{name}.Sanitize()+" WITH (FORCE)"); err != nil {
+			t.Errorf("dropping test database: %v", err)
+		}
+	})
+
+	dbCfg := cfg.Database
+	dbCfg.Name, dbCfg.AutoMigrate = name, true
+	db, err := database.New(dbCfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+	return db
+}
+
+var errDatabaseDown = errors.New("database is down")
+
+// unavailableDB база, которая не отвечает: проверки токенов на ней не проходят
+type unavailableDB struct{}
+
+type errRow struct{}
+
+func (errRow) Scan(...interface{}) error { return errDatabaseDown }
+
+func (unavailableDB) Exec(context.Context, string, ...interface{}) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, errDatabaseDown
+}
+
+func (unavailableDB) ExecContext(context.Context, string, ...interface{}) (pgconn.CommandTag, error) {
+	return pgconn.CommandTag{}, errDatabaseDown
+}
+
+func (unavailableDB) QueryRow(context.Context, string, ...interface{}) pgx.Row { return errRow{} }
+
+func (unavailableDB) Query(context.Context, string, ...interface{}) (pgx.Rows, error) {
+	return nil, errDatabaseDown
+}
+
+func (unavailableDB) BeginTx(context.Context) (pgx.Tx, error) { return nil, errDatabaseDown }
+
+func (unavailableDB) Listen(ctx context.Context, _ string, _ func(string)) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (unavailableDB) Health() map[string]string { return map[string]string{"status": "down"} }
+
+func (unavailableDB) Ping(context.Context) error { return errDatabaseDown }
+
+func (unavailableDB) PoolStats() database.PoolStats { return database.PoolStats{} }
+
+func (unavailableDB) MigrateUp(context.Context) ([]int, error) { return nil, errDatabaseDown }
+
+func (unavailableDB) MigrateDown(context.Context, int) ([]int, error) { return nil, errDatabaseDown }
+
+func (unavailableDB) MigrationStatus(context.Context) ([]database.MigrationStatus, error) {
+	return nil, errDatabaseDown
+}
+
+func (unavailableDB) ForceMigrationVersion(context.Context, int) error { return errDatabaseDown }
+
+func (unavailableDB) Close() {}
+
+func TestErrorMapping(t *testing.T) {
+	ts, _ := newTestServer(t, testConfig(t), unavailableDB{}, nil)
+	ctx := context.Background()
+
+	_, err := newClient(t, ts).Download(ctx, "a.txt", nil, nil)
+	if !errors.Is(err, client.ErrNotLoggedIn) {
+		t.Errorf("without token err = %v, want ErrNotLoggedIn", err)
+	}
+
+	_, err = newClient(t, ts, client.WithToken("not-a-session")).Download(ctx, "a.txt", nil, nil)
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("err = %v, want *client.Error", err)
+	}
+	if apiErr.Status != http.StatusUnauthorized || apiErr.Code != client.CodeInvalidToken || apiErr.RequestID == "" {
+		t.Errorf("err = %+v, want 401 invalid_token with a request id", apiErr)
+	}
+	if !errors.Is(err, client.ErrUnauthorized) || errors.Is(err, client.ErrForbidden) || errors.Is(err, client.ErrInvalidCredentials) {
+		t.Errorf("errors.Is does not match by status and code: %v", err)
+	}
+	if !strings.Contains(err.Error(), apiErr.RequestID) {
+		t.Errorf("error message %q does not include the request id", err)
+	}
+}
+
+func TestRetryRateLimited(t *testing.T) {
+	cfg := testConfig(t)
+	// одна попытка в корзине на IP, пополнение за 20 мс
+	cfg.RateLimit.IP = config.RateLimit{PerMinute: 3000, Burst: 1}
+	ts, log := newTestServer(t, cfg, unavailableDB{}, nil)
+	ctx := context.Background()
+
+	// первый запрос с того же адреса расходует корзину
+	c := newClient(t, ts, client.WithToken("not-a-session"))
+	if _, err := c.Download(ctx, "a.txt", nil, nil); !errors.Is(err, client.ErrUnauthorized) {
+		t.Fatalf("err = %v, want 401", err)
+	}
+
+	start := time.Now()
+	_, err := c.Download(ctx, "a.txt", nil, nil)
+	// после 429 клиент ждет Retry-After и доходит до проверки токена
+	if !errors.Is(err, client.ErrUnauthorized) {
+		t.Fatalf("err = %v, want 401 after retrying 429", err)
+	}
+	if got := log.count("GET /api/asset/a.txt"); got != 3 {
+		t.Errorf("requests = %d, want 3", got)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("retried after %v, want to wait Retry-After of 1s", elapsed)
+	}
+
+	// Retry-After длиннее MaxBackoff вызывающему возвращается сразу
+	cfg.RateLimit.IP = config.RateLimit{PerMinute: 1, Burst: 1}
+	ts, log = newTestServer(t, cfg, unavailableDB{}, nil)
+	c = newClient(t, ts, client.WithToken("not-a-session"))
+	_, _ = c.Download(ctx, "a.txt", nil, nil)
+	_, err = c.Download(ctx, "a.txt", nil, nil)
+	var apiErr *client.Error
+	if !errors.Is(err, client.ErrRateLimited) || !errors.As(err, &apiErr) || apiErr.RetryAfter != time.Minute {
+		t.Fatalf("err = %v, want rate_limited with Retry-After 60s", err)
+	}
+	if got := log.count("GET /api/asset/a.txt"); got != 2 {
+		t.Errorf("requests = %d, want 2 without retries", got)
+	}
+}
+
+// unavailableFirst отвечает 503 на первые n запросов с путем на prefix, как балансировщик во время выкладки
+func unavailableFirst(prefix string, n int32, retryAfter string) func(http.Handler) http.Handler {
+	var served atomic.Int32
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, prefix) && served.Add(1) <= n {
+				w.Header().Set("Content-Type", "application/problem+json")
+				w.Header().Set("Retry-After", retryAfter)
+				w.WriteHeader(http.StatusServiceUnavailable)
+				fmt.Fprint(w, `{"status":503,"code":"unavailable","detail":"upstream restarting"}`)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestRetryServiceUnavailable(t *testing.T) {
+	ctx := context.Background()
+
+	ts, log := newTestServer(t, testConfig(t), unavailableDB{}, unavailableFirst("/api/", 2, "0"))
+	_, err := newClient(t, ts, client.WithToken("not-a-session")).Download(ctx, "a.txt", nil, nil)
+	if !errors.Is(err, client.ErrUnauthorized) {
+		t.Fatalf("err = %v, want 401 from the server after two 503", err)
+	}
+	if got := log.count("GET /api/asset/a.txt"); got != 3 {
+		t.Errorf("requests = %d, want 3", got)
+	}
+
+	// неидемпотентный POST тоже повторяется: 503 значит, что запрос не обработан
+	ts, log = newTestServer(t, testConfig(t), unavailableDB{}, unavailableFirst("/api/", 1, "0"))
+	_, err = newClient(t, ts, client.WithToken("not-a-session")).Rename(ctx, "a.txt", "b.txt")
+	if !errors.Is(err, client.ErrUnauthorized) {
+		t.Fatalf("err = %v, want 401 after one 503", err)
+	}
+	if got := log.count("POST /api/rename-asset/a.txt"); got != 2 {
+		t.Errorf("requests = %d, want 2", got)
+	}
+
+	// попытки кончились: возвращается последняя ошибка 503
+	ts, log = newTestServer(t, testConfig(t), unavailableDB{}, unavailableFirst("/api/", 10, "0"))
+	_, err = newClient(t, ts, client.WithToken("not-a-session")).Download(ctx, "a.txt", nil, nil)
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.Status != http.StatusServiceUnavailable || apiErr.Detail != "upstream restarting" {
+		t.Fatalf("err = %v, want 503", err)
+	}
+	if got := log.count("GET /api/asset/a.txt"); got != testPolicy.MaxAttempts {
+		t.Errorf("requests = %d, want %d", got, testPolicy.MaxAttempts)
+	}
+}
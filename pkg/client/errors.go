@@ -0,0 +1,89 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ErrorCode стабильный код ошибки из поля code ответа application/problem+json
+type ErrorCode string
+
+// Коды совпадают с кодами сервера (internal/server/exceptions.go)
+const (
+	CodeInternal            ErrorCode = "internal_error"
+	CodeInvalidRequest      ErrorCode = "invalid_request"
+	CodeUnauthorized        ErrorCode = "unauthorized"
+	CodeInvalidCredentials  ErrorCode = "invalid_credentials"
+	CodeInvalidToken        ErrorCode = "invalid_token"
+	CodeInvalidChallenge    ErrorCode = "invalid_challenge"
+	CodeInvalidSecondFactor ErrorCode = "invalid_second_factor"
+	CodeOIDCLoginFailed     ErrorCode = "oidc_login_failed"
+	CodeForbidden           ErrorCode = "forbidden"
+	CodeInsufficientScope   ErrorCode = "insufficient_scope"
+	CodeUserDisabled        ErrorCode = "user_disabled"
+	CodeNotFound            ErrorCode = "not_found"
+	CodeConflict            ErrorCode = "conflict"
+	CodeAssetExists         ErrorCode = "asset_exists"
+	CodeTOTPAlreadyEnabled  ErrorCode = "totp_already_enabled"
+	CodeValidationFailed    ErrorCode = "validation_failed"
+	CodeLoginLocked         ErrorCode = "login_locked"
+	CodeRateLimited         ErrorCode = "rate_limited"
+	CodeCSRFFailed          ErrorCode = "csrf_failed"
+	CodeCursorExpired       ErrorCode = "cursor_expired"
+)
+
+// Error ответ сервера с кодом 4xx/5xx
+type Error struct {
+	Status    int
+	Code      ErrorCode
+	Detail    string
+	RequestID string
+	// RetryAfter из заголовка Retry-After, если сервер его прислал
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("web-storage: %d %s", e.Status, e.Code)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	if e.RequestID != "" {
+		msg += " (request " + e.RequestID + ")"
+	}
+	return msg
+}
+
+// Is сравнивает ошибки по коду, а ошибку-образец без кода по статусу,
+// поэтому работают errors.Is(err, client.ErrNotFound) и errors.Is(err, client.ErrUnauthorized)
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	if t.Code == "" {
+		return t.Status == e.Status
+	}
+	return t.Code == e.Code
+}
+
+// Ошибки для errors.Is по самым частым кодам
+var (
+	// ErrUnauthorized любой 401: нет токена, токен истек или отозван
+	ErrUnauthorized       = &Error{Status: http.StatusUnauthorized}
+	ErrInvalidCredentials = &Error{Code: CodeInvalidCredentials}
+	// ErrForbidden любой 403, в том числе нехватка прав API-ключа
+	ErrForbidden   = &Error{Status: http.StatusForbidden}
+	ErrNotFound    = &Error{Code: CodeNotFound}
+	ErrAssetExists = &Error{Code: CodeAssetExists}
+	ErrRateLimited = &Error{Code: CodeRateLimited}
+	ErrLoginLocked = &Error{Code: CodeLoginLocked}
+)
+
+// ErrTwoFactorRequired возвращает Login, если у пользователя включена 2FA;
+// вход завершается вызовом CompleteTwoFactor с кодом
+var ErrTwoFactorRequired = errors.New("web-storage: two-factor code required")
+
+// ErrNotLoggedIn запрос требует входа, а токена у клиента нет
+var ErrNotLoggedIn = errors.New("web-storage: not logged in")
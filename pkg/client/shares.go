@@ -0,0 +1,49 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ShareLink публичная ссылка на файл
+type ShareLink struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Downloads int64     `json:"downloads"`
+}
+
+// Share создает ссылку на файл; ttl 0 оставляет срок по умолчанию сервера
+func (c *Client) Share(ctx context.Context, name string, ttl time.Duration) (ShareLink, error) {
+	body := map[string]int64{}
+	if ttl > 0 {
+		body["expires_in"] = int64(ttl / time.Second)
+	}
+	resp, err := c.do(ctx, request{method: http.MethodPost, path: assetPath("share-asset", name), json: body})
+	if err != nil {
+		return ShareLink{}, err
+	}
+	var link ShareLink
+	err = decode(resp, &link)
+	return link, err
+}
+
+// ShareLinks действующие ссылки пользователя
+func (c *Client) ShareLinks(ctx context.Context) ([]ShareLink, error) {
+	resp, err := c.do(ctx, request{method: http.MethodGet, path: "/api/shares"})
+	if err != nil {
+		return nil, err
+	}
+	var links []ShareLink
+	err = decode(resp, &links)
+	return links, err
+}
+
+// RevokeShareLink отзывает ссылку до истечения срока
+func (c *Client) RevokeShareLink(ctx context.Context, id string) error {
+	return c.call(ctx, http.MethodDelete, "/api/shares/"+url.PathEscape(id), nil)
+}
@@ -0,0 +1,442 @@
+// Package dirsync двусторонняя синхронизация локального каталога с файлами
+// пользователя под префиксом. Изменения определяются по SHA-256 относительно
+// состояния последней синхронизации; хэш локального файла пересчитывается,
+// только если изменились его размер или время изменения. Передаются только
+// изменившиеся файлы. Если файл изменился с обеих сторон, серверная версия
+// остается под своим именем, а локальная сохраняется и загружается как копия
+// name.conflict-<время>.ext.
+package dirsync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"web-storage-service/pkg/client"
+)
+
+// Op вид действия синхронизации
+type Op string
+
+const (
+	OpUpload       Op = "upload"
+	OpDownload     Op = "download"
+	OpDeleteRemote Op = "delete-remote"
+	OpDeleteLocal  Op = "delete-local"
+	// OpConflict локальная версия сохранена как копия Conflict, серверная скачана
+	OpConflict Op = "conflict"
+)
+
+// Action одно действие прохода; Err заполнен, если оно не удалось
+type Action struct {
+	Op   Op     `json:"op"`
+	Path string `json:"path"`
+	// Conflict имя копии локальной версии для OpConflict
+	Conflict string `json:"conflict,omitempty"`
+	Size     int64  `json:"size"`
+	Err      error  `json:"-"`
+}
+
+// Options параметры синхронизации
+type Options struct {
+	// Prefix префикс имен на сервере; пустой синхронизирует все файлы пользователя
+	Prefix string
+	// Workers параллельных передач, по умолчанию 4
+	Workers int
+	// DryRun только сообщает о действиях, ничего не меняя
+	DryRun bool
+	// OnAction вызывается после каждого действия, в том числе неудачного;
+	// вызовы не пересекаются, даже когда передачи идут параллельно
+	OnAction func(Action)
+}
+
+type Syncer struct {
+	client *client.Client
+	dir    string
+	opts   Options
+
+	// mu защищает state во время параллельных передач, reportMu вызовы OnAction
+	mu       sync.Mutex
+	reportMu sync.Mutex
+	state    state
+	// dirs каталоги последнего обхода, за ними следит Watch
+	dirs []string
+}
+
+// New создает синхронизацию каталога dir; префикс дополняется / до имени каталога
+func New(c *client.Client, dir string, opts Options) (*Syncer, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	if opts.Prefix = strings.Trim(opts.Prefix, "/"); opts.Prefix != "" {
+		opts.Prefix += "/"
+	}
+	if opts.Workers < 1 {
+		opts.Workers = 4
+	}
+	return &Syncer{client: c, dir: abs, opts: opts}, nil
+}
+
+// localFile локальная версия файла на момент обхода
+type localFile struct {
+	fileState
+	path string
+}
+
+// Run выполняет один проход синхронизации и возвращает выполненные действия.
+// Ошибка отдельного файла не прерывает проход: она попадает в Action.Err,
+// а Run возвращает сводную ошибку.
+func (s *Syncer) Run(ctx context.Context) ([]Action, error) {
+	st, err := loadState(s.dir, s.opts.Prefix)
+	if err != nil {
+		return nil, err
+	}
+	s.state = st
+
+	local, err := s.scanLocal()
+	if err != nil {
+		return nil, err
+	}
+	remote, err := s.scanRemote(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	actions := s.plan(local, remote)
+	if s.opts.DryRun {
+		for _, action := range actions {
+			s.report(action)
+		}
+		return actions, nil
+	}
+
+	s.apply(ctx, actions, local, remote)
+	if err = saveState(s.dir, s.state); err != nil {
+		return actions, err
+	}
+
+	failed := 0
+	for _, action := range actions {
+		if action.Err != nil {
+			failed++
+		}
+	}
+	if err = ctx.Err(); err != nil {
+		return actions, err
+	}
+	if failed > 0 {
+		return actions, fmt.Errorf("%d of %d changes failed", failed, len(actions))
+	}
+	return actions, nil
+}
+
+// scanLocal обходит каталог; хэш берется из состояния, если размер и время изменения не менялись
+func (s *Syncer) scanLocal() (map[string]localFile, error) {
+	files := map[string]localFile{}
+	dirs := []string{}
+	err := filepath.WalkDir(s.dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			dirs = append(dirs, p)
+			return nil
+		}
+		if !d.Type().IsRegular() || isInternal(p) {
+			return nil
+		}
+		rel, err := filepath.Rel(s.dir, p)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		rel = filepath.ToSlash(rel)
+		file := localFile{fileState: fileState{Size: info.Size(), ModTime: info.ModTime()}, path: p}
+		if prev, ok := s.state.Files[rel]; ok && prev.Size == file.Size && prev.ModTime.Equal(file.ModTime) {
+			file.SHA256 = prev.SHA256
+		} else if file.SHA256, err = hashFile(p); err != nil {
+			return err
+		}
+		files[rel] = file
+		return nil
+	})
+	s.dirs = dirs
+	return files, err
+}
+
+func (s *Syncer) scanRemote(ctx context.Context) (map[string]client.AssetInfo, error) {
+	assets := map[string]client.AssetInfo{}
+	it := s.client.Assets(ctx, client.ListOptions{Prefix: s.opts.Prefix})
+	for it.Next() {
+		asset := it.Asset()
+		rel := strings.TrimPrefix(asset.Name, s.opts.Prefix)
+		// имя, которое нельзя записать внутри каталога, пропускается
+		if !filepath.IsLocal(filepath.FromSlash(rel)) || isInternal(rel) {
+			continue
+		}
+		assets[rel] = asset
+	}
+	return assets, it.Err()
+}
+
+// plan сравнивает стороны с состоянием последней синхронизации
+func (s *Syncer) plan(local map[string]localFile, remote map[string]client.AssetInfo) []Action {
+	names := map[string]bool{}
+	for name := range local {
+		names[name] = true
+	}
+	for name := range remote {
+		names[name] = true
+	}
+	for name := range s.state.Files {
+		names[name] = true
+	}
+
+	var actions []Action
+	for name := range names {
+		l, lok := local[name]
+		r, rok := remote[name]
+		base := s.state.Files[name].SHA256
+
+		switch {
+		case l.SHA256 == r.SHA256:
+			// стороны совпадают: запоминаем общую версию или забываем удаленный с обеих сторон файл
+			if lok {
+				s.state.Files[name] = l.fileState
+			} else {
+				delete(s.state.Files, name)
+			}
+		case r.SHA256 == base:
+			// изменилась только локальная сторона
+			if lok {
+				actions = append(actions, Action{Op: OpUpload, Path: name, Size: l.Size})
+			} else {
+				actions = append(actions, Action{Op: OpDeleteRemote, Path: name})
+			}
+		case l.SHA256 == base:
+			// изменился только сервер
+			if rok {
+				actions = append(actions, Action{Op: OpDownload, Path: name, Size: r.Size})
+			} else {
+				actions = append(actions, Action{Op: OpDeleteLocal, Path: name})
+			}
+		case !lok:
+			// удален локально, но изменен на сервере: изменение важнее удаления
+			actions = append(actions, Action{Op: OpDownload, Path: name, Size: r.Size})
+		case !rok:
+			actions = append(actions, Action{Op: OpUpload, Path: name, Size: l.Size})
+		default:
+			actions = append(actions, Action{Op: OpConflict, Path: name, Conflict: conflictName(name, time.Now()), Size: r.Size})
+		}
+	}
+	sort.Slice(actions, func(i, j int) bool { return actions[i].Path < actions[j].Path })
+	return actions
+}
+
+// conflictName docs/report.pdf -> docs/report.conflict-20240131-150405.pdf
+func conflictName(name string, now time.Time) string {
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + ".conflict-" + now.Format("20060102-150405") + ext
+}
+
+func (s *Syncer) apply(ctx context.Context, actions []Action, local map[string]localFile, remote map[string]client.AssetInfo) {
+	queue := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < s.opts.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				action := &actions[i]
+				action.Err = s.applyOne(ctx, action, local[action.Path], remote[action.Path])
+				s.report(*action)
+			}
+		}()
+	}
+
+feed:
+	for i := range actions {
+		select {
+		case queue <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+}
+
+func (s *Syncer) applyOne(ctx context.Context, action *Action, l localFile, r client.AssetInfo) error {
+	switch action.Op {
+	case OpUpload:
+		return s.upload(ctx, action.Path, l, r.Name != "")
+	case OpDownload:
+		return s.download(ctx, action.Path, l)
+	case OpDeleteRemote:
+		err := s.client.Delete(ctx, s.opts.Prefix+action.Path)
+		if err != nil && !errors.Is(err, client.ErrNotFound) {
+			return err
+		}
+		s.forget(action.Path)
+		return nil
+	case OpDeleteLocal:
+		if err := unchanged(l.path, l); err != nil {
+			return err
+		}
+		if err := os.Remove(filepath.Join(s.dir, filepath.FromSlash(action.Path))); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		s.forget(action.Path)
+		return nil
+	case OpConflict:
+		// локальная версия переезжает в копию, которая загружается как новый файл,
+		// а под исходным именем оказывается серверная версия
+		if err := unchanged(l.path, l); err != nil {
+			return err
+		}
+		copyPath := filepath.Join(s.dir, filepath.FromSlash(action.Conflict))
+		if err := os.Rename(l.path, copyPath); err != nil {
+			return err
+		}
+		l.path = copyPath
+		if err := s.upload(ctx, action.Conflict, l, false); err != nil {
+			return err
+		}
+		return s.download(ctx, action.Path, localFile{})
+	}
+	return fmt.Errorf("unknown action %q", action.Op)
+}
+
+// upload отправляет файл; новый файл загружается без перезаписи, чтобы не затереть
+// файл, появившийся на сервере после обхода: такой конфликт разрешит следующий проход
+func (s *Syncer) upload(ctx context.Context, name string, l localFile, exists bool) error {
+	f, err := os.Open(l.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var info client.AssetInfo
+	if exists {
+		info, err = s.client.Update(ctx, s.opts.Prefix+name, f, &client.UploadOptions{Overwrite: true})
+	} else {
+		info, err = s.client.Upload(ctx, s.opts.Prefix+name, f, nil)
+	}
+	if err != nil {
+		return err
+	}
+	// размер и время из обхода: если файл менялся во время загрузки,
+	// следующий проход пересчитает хэш и загрузит его снова
+	s.remember(name, fileState{SHA256: info.SHA256, Size: l.Size, ModTime: l.ModTime})
+	return nil
+}
+
+// download пишет файл во временный и переименовывает, только если локальная версия
+// не изменилась после обхода
+func (s *Syncer) download(ctx context.Context, name string, l localFile) error {
+	target := filepath.Join(s.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(target), internalPrefix+"-*.part")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := sha256.New()
+	_, err = s.client.Download(ctx, s.opts.Prefix+name, io.MultiWriter(tmp, hash), nil)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if l.path != "" {
+		err = unchanged(l.path, l)
+	} else if _, statErr := os.Stat(target); statErr == nil {
+		err = errLocalChanged
+	}
+	if err != nil {
+		return err
+	}
+	if err = os.Rename(tmp.Name(), target); err != nil {
+		return err
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+	s.remember(name, fileState{SHA256: hex.EncodeToString(hash.Sum(nil)), Size: info.Size(), ModTime: info.ModTime()})
+	return nil
+}
+
+var errLocalChanged = errors.New("local file changed during sync, will retry")
+
+// unchanged проверяет, что файл не меняли после обхода
+func unchanged(p string, l localFile) error {
+	info, err := os.Stat(p)
+	if err != nil {
+		return err
+	}
+	if info.Size() != l.Size || !info.ModTime().Equal(l.ModTime) {
+		return errLocalChanged
+	}
+	return nil
+}
+
+func (s *Syncer) remember(name string, fs fileState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.state.Files[name] = fs
+}
+
+func (s *Syncer) forget(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.state.Files, name)
+}
+
+func (s *Syncer) report(action Action) {
+	s.reportMu.Lock()
+	defer s.reportMu.Unlock()
+	if s.opts.OnAction != nil {
+		s.opts.OnAction(action)
+	}
+}
+
+func hashFile(p string) (string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := sha256.New()
+	if _, err = io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
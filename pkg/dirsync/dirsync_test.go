@@ -0,0 +1,320 @@
+package dirsync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"web-storage-service/pkg/client"
+)
+
+func sha(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestPlan(t *testing.T) {
+	// local, remote и base содержимое файла на диске, на сервере и при последней
+	// синхронизации; пустая строка значит, что файла там нет
+	tests := []struct {
+		name                string
+		local, remote, base string
+		op                  Op
+		// remembered версия в состоянии после plan для файлов без действия
+		remembered bool
+	}{
+		{name: "unchanged", local: "v1", remote: "v1", base: "v1", remembered: true},
+		{name: "new on both with same content", local: "v1", remote: "v1", remembered: true},
+		{name: "deleted on both", base: "v1"},
+		{name: "new locally", local: "v1", op: OpUpload},
+		{name: "changed locally", local: "v2", remote: "v1", base: "v1", op: OpUpload},
+		{name: "deleted locally", remote: "v1", base: "v1", op: OpDeleteRemote},
+		{name: "new remotely", remote: "v1", op: OpDownload},
+		{name: "changed remotely", local: "v1", remote: "v2", base: "v1", op: OpDownload},
+		{name: "deleted remotely", local: "v1", base: "v1", op: OpDeleteLocal},
+		{name: "changed on both", local: "v2", remote: "v3", base: "v1", op: OpConflict},
+		{name: "new on both with different content", local: "v1", remote: "v2", op: OpConflict},
+		{name: "deleted locally, changed remotely", remote: "v2", base: "v1", op: OpDownload},
+		{name: "deleted remotely, changed locally", local: "v2", base: "v1", op: OpUpload},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const name = "docs/report.txt"
+			local := map[string]localFile{}
+			remote := map[string]client.AssetInfo{}
+			s := &Syncer{state: state{Files: map[string]fileState{}}}
+			if tt.local != "" {
+				local[name] = localFile{fileState: fileState{SHA256: sha(tt.local), Size: int64(len(tt.local))}}
+			}
+			if tt.remote != "" {
+				remote[name] = client.AssetInfo{Name: name, SHA256: sha(tt.remote), Size: int64(len(tt.remote))}
+			}
+			if tt.base != "" {
+				s.state.Files[name] = fileState{SHA256: sha(tt.base)}
+			}
+
+			actions := s.plan(local, remote)
+			if tt.op == "" {
+				if len(actions) != 0 {
+					t.Fatalf("actions = %+v, want none", actions)
+				}
+				got, ok := s.state.Files[name]
+				if ok != tt.remembered || (ok && got.SHA256 != sha(tt.local)) {
+					t.Errorf("state = %+v, %v, want remembered %v", got, ok, tt.remembered)
+				}
+				return
+			}
+
+			if len(actions) != 1 || actions[0].Op != tt.op || actions[0].Path != name {
+				t.Fatalf("actions = %+v, want %s %s", actions, tt.op, name)
+			}
+			if tt.op == OpConflict && !strings.HasPrefix(actions[0].Conflict, "docs/report.conflict-") {
+				t.Errorf("conflict copy = %q", actions[0].Conflict)
+			}
+			// до выполнения действия состояние не меняется
+			if got := s.state.Files[name].SHA256; tt.base != "" && got != sha(tt.base) {
+				t.Errorf("state changed by plan: %s", got)
+			}
+		})
+	}
+}
+
+func TestConflictName(t *testing.T) {
+	now := time.Date(2024, 1, 31, 15, 4, 5, 0, time.UTC)
+	for name, want := range map[string]string{
+		"docs/report.pdf": "docs/report.conflict-20240131-150405.pdf",
+		"notes":           "notes.conflict-20240131-150405",
+		"a.tar.gz":        "a.tar.conflict-20240131-150405.gz",
+	} {
+		if got := conflictName(name, now); got != want {
+			t.Errorf("conflictName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+// fakeAPI хранит файлы в памяти и отвечает на запросы, которые делает Syncer
+type fakeAPI struct {
+	mu       sync.Mutex
+	files    map[string]string
+	requests []string
+}
+
+func newFakeAPI(t *testing.T, files map[string]string) (*fakeAPI, *client.Client) {
+	t.Helper()
+	api := &fakeAPI{files: files}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/assets", func(w http.ResponseWriter, r *http.Request) {
+		var assets []client.AssetInfo
+		for name, content := range api.files {
+			if strings.HasPrefix(name, r.URL.Query().Get("prefix")) {
+				assets = append(assets, client.AssetInfo{Name: name, Size: int64(len(content)), SHA256: sha(content)})
+			}
+		}
+		sort.Slice(assets, func(i, j int) bool { return assets[i].Name < assets[j].Name })
+		writeJSON(w, http.StatusOK, map[string]interface{}{"assets": assets, "hasMore": false})
+	})
+	mux.HandleFunc("POST /api/upload-asset/{name}", func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := api.files[r.PathValue("name")]; ok && r.URL.Query().Get("overwrite") != "true" {
+			writeJSON(w, http.StatusConflict, map[string]string{"code": string(client.CodeAssetExists)})
+			return
+		}
+		api.store(w, r)
+	})
+	mux.HandleFunc("PUT /api/update-asset/{name}", api.store)
+	mux.HandleFunc("GET /api/asset/{name}", func(w http.ResponseWriter, r *http.Request) {
+		content, ok := api.files[r.PathValue("name")]
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"code": string(client.CodeNotFound)})
+			return
+		}
+		_, _ = io.WriteString(w, content)
+	})
+	mux.HandleFunc("PUT /api/delete-asset/{name}", func(w http.ResponseWriter, r *http.Request) {
+		delete(api.files, r.PathValue("name"))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		api.mu.Lock()
+		defer api.mu.Unlock()
+		request := r.Method + " " + r.URL.Path
+		if r.URL.Query().Has("overwrite") {
+			request += "?overwrite"
+		}
+		api.requests = append(api.requests, request)
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(ts.Close)
+
+	c, err := client.New(ts.URL, client.WithHTTPClient(ts.Client()), client.WithToken("test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return api, c
+}
+
+func (api *fakeAPI) store(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	name := r.PathValue("name")
+	api.files[name] = string(body)
+	writeJSON(w, http.StatusOK, client.AssetInfo{Name: name, Size: int64(len(body)), SHA256: sha(string(body))})
+}
+
+func (api *fakeAPI) file(name string) (string, bool) {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	content, ok := api.files[name]
+	return content, ok
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeFile(t *testing.T, p, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, p string) string {
+	t.Helper()
+	data, err := os.ReadFile(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRunConflict(t *testing.T) {
+	dir := t.TempDir()
+	api, c := newFakeAPI(t, map[string]string{"docs/notes.txt": "server edit", "other/skip.txt": "x"})
+
+	// с прошлой синхронизации файл изменили и локально, и на сервере
+	writeFile(t, filepath.Join(dir, "notes.txt"), "local edit")
+	err := saveState(dir, state{Prefix: "docs/", Files: map[string]fileState{"notes.txt": {SHA256: sha("original")}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(c, dir, Options{Prefix: "docs"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions, err := s.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 1 || actions[0].Op != OpConflict || actions[0].Path != "notes.txt" {
+		t.Fatalf("actions = %+v, want one conflict on notes.txt", actions)
+	}
+	copyName := actions[0].Conflict
+	if !strings.HasPrefix(copyName, "notes.conflict-") || !strings.HasSuffix(copyName, ".txt") {
+		t.Fatalf("conflict copy = %q", copyName)
+	}
+
+	// под исходным именем серверная версия, локальная переехала в копию
+	if got := readFile(t, filepath.Join(dir, "notes.txt")); got != "server edit" {
+		t.Errorf("notes.txt = %q, want the server version", got)
+	}
+	if got := readFile(t, filepath.Join(dir, copyName)); got != "local edit" {
+		t.Errorf("%s = %q, want the local version", copyName, got)
+	}
+
+	// копия загружена новым файлом без перезаписи, серверная версия не тронута
+	if got, _ := api.file("docs/" + copyName); got != "local edit" {
+		t.Errorf("uploaded copy = %q, want the local version", got)
+	}
+	if got, _ := api.file("docs/notes.txt"); got != "server edit" {
+		t.Errorf("docs/notes.txt on the server = %q, want it unchanged", got)
+	}
+	api.mu.Lock()
+	requests := append([]string(nil), api.requests...)
+	api.mu.Unlock()
+	for _, request := range requests {
+		if strings.HasSuffix(request, "?overwrite") || strings.HasPrefix(request, "PUT ") {
+			t.Errorf("request %q overwrites a file on the server", request)
+		}
+	}
+
+	// следующий проход видит совпадающие стороны и ничего не делает
+	actions, err = s.Run(context.Background())
+	if err != nil || len(actions) != 0 {
+		t.Errorf("second run = %+v, %v, want no actions", actions, err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "other")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("file outside the prefix was synced: %v", err)
+	}
+}
+
+func TestDeleteLocal(t *testing.T) {
+	dir := t.TempDir()
+	_, c := newFakeAPI(t, map[string]string{})
+	s, err := New(c, dir, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.state = state{Files: map[string]fileState{}}
+
+	scanned := func(name string) localFile {
+		p := filepath.Join(dir, name)
+		info, err := os.Stat(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.state.Files[name] = fileState{SHA256: sha(readFile(t, p)), Size: info.Size(), ModTime: info.ModTime()}
+		return localFile{fileState: s.state.Files[name], path: p}
+	}
+
+	// файл изменили после обхода: удалять его нельзя
+	writeFile(t, filepath.Join(dir, "edited.txt"), "v1")
+	l := scanned("edited.txt")
+	writeFile(t, l.path, "v1 and a local edit")
+	action := Action{Op: OpDeleteLocal, Path: "edited.txt"}
+	if err = s.applyOne(context.Background(), &action, l, client.AssetInfo{}); !errors.Is(err, errLocalChanged) {
+		t.Errorf("err = %v, want errLocalChanged", err)
+	}
+	if got := readFile(t, l.path); got != "v1 and a local edit" {
+		t.Errorf("edited.txt = %q, want the local edit kept", got)
+	}
+	if _, ok := s.state.Files["edited.txt"]; !ok {
+		t.Error("edited.txt forgotten although it was not deleted")
+	}
+
+	// неизмененный файл удаляется и забывается
+	writeFile(t, filepath.Join(dir, "sub", "same.txt"), "v1")
+	l = scanned("sub/same.txt")
+	action = Action{Op: OpDeleteLocal, Path: "sub/same.txt"}
+	if err = s.applyOne(context.Background(), &action, l, client.AssetInfo{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(l.path); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("sub/same.txt not deleted: %v", err)
+	}
+	if _, ok := s.state.Files["sub/same.txt"]; ok {
+		t.Error("sub/same.txt still in the state")
+	}
+}
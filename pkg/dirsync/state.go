@@ -0,0 +1,78 @@
+package dirsync
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// stateFile хранит состояние последней синхронизации в корне каталога.
+// Файлы с префиксом .wssync, в том числе временные, не синхронизируются.
+const (
+	stateFile      = ".wssync-state.json"
+	internalPrefix = ".wssync"
+)
+
+// fileState версия файла, на которой стороны последний раз совпадали:
+// хэш общий, размер и время изменения локальной копии
+type fileState struct {
+	SHA256  string    `json:"sha256"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+}
+
+type state struct {
+	Prefix string               `json:"prefix"`
+	Files  map[string]fileState `json:"files"`
+}
+
+func isInternal(name string) bool {
+	return strings.HasPrefix(filepath.Base(name), internalPrefix)
+}
+
+func loadState(dir, prefix string) (state, error) {
+	st := state{Prefix: prefix, Files: map[string]fileState{}}
+	data, err := os.ReadFile(filepath.Join(dir, stateFile))
+	if errors.Is(err, fs.ErrNotExist) {
+		return st, nil
+	}
+	if err != nil {
+		return st, err
+	}
+	if err = json.Unmarshal(data, &st); err != nil {
+		return st, fmt.Errorf("reading %s: %w", stateFile, err)
+	}
+	if st.Prefix != prefix {
+		return st, fmt.Errorf("%s is synced with prefix %q, not %q", dir, st.Prefix, prefix)
+	}
+	if st.Files == nil {
+		st.Files = map[string]fileState{}
+	}
+	return st, nil
+}
+
+// saveState пишет состояние через переименование, чтобы сбой не оставил его наполовину записанным
+func saveState(dir string, st state) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, internalPrefix+"-state-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(dir, stateFile))
+}
@@ -0,0 +1,127 @@
+package dirsync
+
+import (
+	"context"
+	"errors"
+	"time"
+	"web-storage-service/pkg/client"
+)
+
+// watcher сообщает, что в каталоге что-то изменилось; что именно, выясняет следующий проход
+type watcher interface {
+	Events() <-chan struct{}
+	// Add следит за каталогами; повторный вызов для тех же каталогов безопасен
+	Add(dirs []string) error
+	Close() error
+}
+
+// settle пауза после последнего локального события перед проходом,
+// чтобы серия записей в файл не запускала синхронизацию на каждую
+const settle = time.Second
+
+// changesWait сколько один запрос к ленте изменений ждет событий
+const changesWait = 60 * time.Second
+
+// Watch синхронизирует сразу и затем после каждого локального изменения и каждого
+// изменения на сервере. Локальные изменения приходят от inotify на Linux и от
+// опроса каталога на других системах, серверные из ленты /api/changes; если лента
+// недоступна, сервер опрашивается каждые interval. Ошибки проходов передаются в
+// onError, Watch продолжает работу до отмены ctx.
+func (s *Syncer) Watch(ctx context.Context, interval time.Duration, onError func(error)) error {
+	w, err := newWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+
+	// курсор берется до первого прохода, чтобы не пропустить изменения во время него
+	cursor, err := s.client.CurrentCursor(ctx)
+	if err != nil && ctx.Err() != nil {
+		return nil
+	}
+	remote := make(chan struct{}, 1)
+	go s.followChanges(ctx, cursor, err == nil, interval, remote)
+
+	pass := func() {
+		if _, err := s.Run(ctx); err != nil && ctx.Err() == nil {
+			onError(err)
+		}
+		if err := w.Add(s.dirs); err != nil {
+			onError(err)
+		}
+	}
+	pass()
+
+	debounce := time.NewTimer(settle)
+	debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case _, ok := <-w.Events():
+			if !ok {
+				return errWatcherClosed
+			}
+			debounce.Reset(settle)
+		case <-debounce.C:
+			pass()
+		case <-remote:
+			pass()
+		}
+	}
+}
+
+// followChanges сигналит в remote о событиях под префиксом из ленты изменений,
+// а если ленты нет или она отвечает ошибкой, каждые interval
+func (s *Syncer) followChanges(ctx context.Context, cursor int64, feed bool, interval time.Duration, remote chan<- struct{}) {
+	signal := func() {
+		select {
+		case remote <- struct{}{}:
+		default:
+		}
+	}
+	for ctx.Err() == nil {
+		if !feed {
+			if sleep(ctx, interval) != nil {
+				return
+			}
+			// сервер мог обновиться или восстановиться: пробуем ленту снова;
+			// курсор берется до прохода, как и в Watch
+			cursor, feed = s.resume(ctx)
+			signal()
+			continue
+		}
+
+		page, err := s.client.Changes(ctx, cursor, &client.ChangesOptions{Prefix: s.opts.Prefix, Wait: changesWait})
+		switch {
+		case err == nil:
+			if len(page.Events) > 0 {
+				signal()
+			}
+			cursor = page.Cursor
+		case errors.Is(err, client.ErrCursorExpired):
+			// пропущенные события неизвестны, но полный проход их и не требует
+			cursor, feed = s.resume(ctx)
+			signal()
+		default:
+			feed = false
+		}
+	}
+}
+
+func (s *Syncer) resume(ctx context.Context) (int64, bool) {
+	cursor, err := s.client.CurrentCursor(ctx)
+	return cursor, err == nil
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
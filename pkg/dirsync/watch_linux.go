@@ -0,0 +1,98 @@
+//go:build linux
+
+package dirsync
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+var errWatcherClosed = errors.New("inotify watcher stopped")
+
+const inotifyMask = syscall.IN_CREATE | syscall.IN_CLOSE_WRITE | syscall.IN_MODIFY | syscall.IN_DELETE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO
+
+type inotifyWatcher struct {
+	// file неблокирующий дескриптор inotify через os.File, чтобы Close прерывал чтение
+	file   *os.File
+	events chan struct{}
+}
+
+func newWatcher() (watcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	w := &inotifyWatcher{file: os.NewFile(uintptr(fd), "inotify"), events: make(chan struct{}, 1)}
+	go w.read()
+	return w, nil
+}
+
+// read сигналит о любом событии, кроме событий служебных файлов: иначе запись
+// состояния после прохода запускала бы следующий проход
+func (w *inotifyWatcher) read() {
+	defer close(w.events)
+	buf := make([]byte, 64<<10)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			return
+		}
+		if changed(buf[:n]) {
+			select {
+			case w.events <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// changed разбирает struct inotify_event: заголовок фиксированной длины и имя с нулями в конце
+func changed(buf []byte) bool {
+	for len(buf) >= syscall.SizeofInotifyEvent {
+		event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[0]))
+		end := syscall.SizeofInotifyEvent + int(event.Len)
+		if end > len(buf) {
+			return true
+		}
+		name := strings.TrimRight(string(buf[syscall.SizeofInotifyEvent:end]), "\x00")
+		if event.Mask&syscall.IN_IGNORED == 0 && !isInternal(name) {
+			return true
+		}
+		buf = buf[end:]
+	}
+	return false
+}
+
+func (w *inotifyWatcher) Events() <-chan struct{} {
+	return w.events
+}
+
+// Add ставит наблюдение на каждый каталог: inotify не рекурсивен. Удаленные
+// каталоги ядро снимает с наблюдения само, новые добавит следующий вызов.
+func (w *inotifyWatcher) Add(dirs []string) error {
+	conn, err := w.file.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var addErr error
+	err = conn.Control(func(fd uintptr) {
+		for _, dir := range dirs {
+			if _, err := syscall.InotifyAddWatch(int(fd), dir, inotifyMask); err != nil && !errors.Is(err, syscall.ENOENT) {
+				addErr = os.NewSyscallError("inotify_add_watch "+dir, err)
+				return
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return addErr
+}
+
+func (w *inotifyWatcher) Close() error {
+	return w.file.Close()
+}
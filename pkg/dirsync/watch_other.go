@@ -0,0 +1,53 @@
+//go:build !linux
+
+package dirsync
+
+import (
+	"errors"
+	"time"
+)
+
+var errWatcherClosed = errors.New("directory poller stopped")
+
+// pollInterval как часто проверяется каталог там, где нет inotify
+const pollInterval = 5 * time.Second
+
+// pollingWatcher без уведомлений файловой системы просто периодически запускает
+// проход: неизменившиеся файлы не перехэшируются, так что он дешевый
+type pollingWatcher struct {
+	ticker *time.Ticker
+	events chan struct{}
+	done   chan struct{}
+}
+
+func newWatcher() (watcher, error) {
+	w := &pollingWatcher{ticker: time.NewTicker(pollInterval), events: make(chan struct{}, 1), done: make(chan struct{})}
+	go func() {
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-w.ticker.C:
+				select {
+				case w.events <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+	return w, nil
+}
+
+func (w *pollingWatcher) Events() <-chan struct{} {
+	return w.events
+}
+
+func (w *pollingWatcher) Add(dirs []string) error {
+	return nil
+}
+
+func (w *pollingWatcher) Close() error {
+	w.ticker.Stop()
+	close(w.done)
+	return nil
+}
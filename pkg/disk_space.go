@@ -0,0 +1,11 @@
+package pkg
+
+import "errors"
+
+var ErrDiskSpaceUnsupported = errors.New("disk space check is not supported on this platform")
+
+// DiskSpace возвращает свободное для непривилегированного процесса и общее место
+// на файловой системе, где находится path
+func DiskSpace(path string) (free, total uint64, err error) {
+	return diskSpace(path)
+}
@@ -0,0 +1,30 @@
+package pkg
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ClientIP возвращает IP-адрес клиента из RemoteAddr, в том числе для IPv6
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// SameIP сравнивает адреса независимо от записи: значение INET из базы может прийти
+// с маской /32 или /128, а IPv4 у клиента может быть записан как IPv6
+func SameIP(a, b string) bool {
+	parse := func(s string) (netip.Addr, bool) {
+		host, _, _ := strings.Cut(s, "/")
+		addr, err := netip.ParseAddr(host)
+		return addr.Unmap(), err == nil
+	}
+	addrA, okA := parse(a)
+	addrB, okB := parse(b)
+	return okA && okB && addrA == addrB
+}
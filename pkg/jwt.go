@@ -0,0 +1,300 @@
+package pkg
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+const (
+	JWTAlgEdDSA = "EdDSA"
+	JWTAlgES256 = "ES256"
+	// RS256 только проверяем: его используют внешние провайдеры OIDC
+	JWTAlgRS256 = "RS256"
+)
+
+var (
+	ErrJWTMalformed = errors.New("malformed jwt")
+	ErrJWTSignature = errors.New("invalid jwt signature")
+	ErrJWTExpired   = errors.New("jwt expired")
+	ErrJWTAlgorithm = errors.New("unsupported jwt algorithm")
+)
+
+var b64 = base64.RawURLEncoding
+
+// JWTClaims набор claim-ов, которые выпускает и проверяет сервис
+type JWTClaims struct {
+	Issuer    string `json:"iss,omitempty"`
+	Subject   string `json:"sub"`
+	Audience  string `json:"aud,omitempty"`
+	ExpiresAt int64  `json:"exp"`
+	IssuedAt  int64  `json:"iat"`
+	NotBefore int64  `json:"nbf,omitempty"`
+	ID        string `json:"jti"`
+	Scope     string `json:"scope,omitempty"`
+	Role      string `json:"role,omitempty"`
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ,omitempty"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// SignJWT подписывает claims ключом key; поддерживаются ed25519 и ecdsa P-256
+func SignJWT(claims JWTClaims, kid string, key crypto.Signer) (string, error) {
+	alg, err := jwtAlgForKey(key.Public())
+	if err != nil {
+		return "", err
+	}
+
+	header, err := json.Marshal(jwtHeader{Alg: alg, Typ: "JWT", Kid: kid})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := b64.EncodeToString(header) + "." + b64.EncodeToString(payload)
+
+	var sig []byte
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, []byte(signingInput))
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256([]byte(signingInput))
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		if err != nil {
+			return "", err
+		}
+		// JWS требует фиксированный формат r||s, а не ASN.1
+		sig = make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+	default:
+		return "", ErrJWTAlgorithm
+	}
+
+	return signingInput + "." + b64.EncodeToString(sig), nil
+}
+
+// ParseJWT проверяет подпись и срок действия токена. keyFunc по kid и alg
+// из заголовка возвращает публичный ключ для проверки.
+func ParseJWT(token string, keyFunc func(kid, alg string) (crypto.PublicKey, error)) (JWTClaims, error) {
+	var claims JWTClaims
+
+	rawPayload, err := VerifyJWT(token, keyFunc)
+	if err != nil {
+		return claims, err
+	}
+	if err = json.Unmarshal(rawPayload, &claims); err != nil {
+		return claims, ErrJWTMalformed
+	}
+
+	now := time.Now().Unix()
+	if claims.ExpiresAt == 0 || now >= claims.ExpiresAt {
+		return claims, ErrJWTExpired
+	}
+	if claims.NotBefore != 0 && now < claims.NotBefore {
+		return claims, ErrJWTExpired
+	}
+
+	return claims, nil
+}
+
+// VerifyJWT проверяет только подпись и возвращает payload без разбора claim-ов
+func VerifyJWT(token string, keyFunc func(kid, alg string) (crypto.PublicKey, error)) ([]byte, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrJWTMalformed
+	}
+
+	rawHeader, err := b64.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrJWTMalformed
+	}
+	var header jwtHeader
+	if err = json.Unmarshal(rawHeader, &header); err != nil {
+		return nil, ErrJWTMalformed
+	}
+
+	sig, err := b64.DecodeString(parts[2])
+	if err != nil {
+		return nil, ErrJWTMalformed
+	}
+
+	key, err := keyFunc(header.Kid, header.Alg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = VerifyJWS(header.Alg, key, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, err
+	}
+
+	rawPayload, err := b64.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrJWTMalformed
+	}
+	return rawPayload, nil
+}
+
+// VerifyJWS проверяет подпись signingInput алгоритмом alg
+func VerifyJWS(alg string, key crypto.PublicKey, signingInput, sig []byte) error {
+	switch alg {
+	case JWTAlgEdDSA:
+		pub, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return ErrJWTAlgorithm
+		}
+		if !ed25519.Verify(pub, signingInput, sig) {
+			return ErrJWTSignature
+		}
+	case JWTAlgES256:
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(sig) != 64 {
+			return ErrJWTSignature
+		}
+		digest := sha256.Sum256(signingInput)
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(pub, digest[:], r, s) {
+			return ErrJWTSignature
+		}
+	case JWTAlgRS256:
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return ErrJWTAlgorithm
+		}
+		digest := sha256.Sum256(signingInput)
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], sig) != nil {
+			return ErrJWTSignature
+		}
+	default:
+		return ErrJWTAlgorithm
+	}
+	return nil
+}
+
+// GenerateSigningKey создает новый ключ подписи для алгоритма alg
+func GenerateSigningKey(alg string) (crypto.Signer, error) {
+	switch alg {
+	case JWTAlgEdDSA:
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		return priv, err
+	case JWTAlgES256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	default:
+		return nil, ErrJWTAlgorithm
+	}
+}
+
+func jwtAlgForKey(pub crypto.PublicKey) (string, error) {
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		return JWTAlgEdDSA, nil
+	case *ecdsa.PublicKey:
+		if k.Curve == elliptic.P256() {
+			return JWTAlgES256, nil
+		}
+	}
+	return "", ErrJWTAlgorithm
+}
+
+// JWK публичный ключ в формате RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+}
+
+// JWKS набор ключей, отдаваемый на /.well-known/jwks.json
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewJWK описывает публичный ключ pub в формате JWK
+func NewJWK(kid string, pub crypto.PublicKey) (JWK, error) {
+	alg, err := jwtAlgForKey(pub)
+	if err != nil {
+		return JWK{}, err
+	}
+
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		return JWK{Kty: "OKP", Crv: "Ed25519", X: b64.EncodeToString(k), Kid: kid, Alg: alg, Use: "sig"}, nil
+	case *ecdsa.PublicKey:
+		x := make([]byte, 32)
+		y := make([]byte, 32)
+		k.X.FillBytes(x)
+		k.Y.FillBytes(y)
+		return JWK{Kty: "EC", Crv: "P-256", X: b64.EncodeToString(x), Y: b64.EncodeToString(y), Kid: kid, Alg: alg, Use: "sig"}, nil
+	}
+	return JWK{}, ErrJWTAlgorithm
+}
+
+// PublicKey восстанавливает публичный ключ из JWK
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch {
+	case k.Kty == "OKP" && k.Crv == "Ed25519":
+		x, err := b64.DecodeString(k.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 key %q", k.Kid)
+		}
+		return ed25519.PublicKey(x), nil
+	case k.Kty == "EC" && k.Crv == "P-256":
+		x, errX := b64.DecodeString(k.X)
+		y, errY := b64.DecodeString(k.Y)
+		if errX != nil || errY != nil {
+			return nil, fmt.Errorf("invalid P-256 key %q", k.Kid)
+		}
+		pub := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, fmt.Errorf("invalid P-256 key %q", k.Kid)
+		}
+		return pub, nil
+	case k.Kty == "RSA":
+		n, errN := b64.DecodeString(k.N)
+		e, errE := b64.DecodeString(k.E)
+		if errN != nil || errE != nil || len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("invalid RSA key %q", k.Kid)
+		}
+		exponent := 0
+		for _, b := range e {
+			exponent = exponent<<8 | int(b)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}, nil
+	}
+	return nil, ErrJWTAlgorithm
+}
+
+// LooksLikeJWT отличает JWT от непрозрачного токена сессии
+func LooksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// GenerateRandomID возвращает случайный идентификатор в hex
+func GenerateRandomID(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("%x", b)
+}
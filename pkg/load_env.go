@@ -8,12 +8,29 @@ import (
 
 // LoadEnv загружает переменные окружения из указанного файла
 func LoadEnv(filename string) error {
-	file, err := os.Open(filename)
+	values, err := ReadEnvFile(filename)
 	if err != nil {
 		return err
 	}
+
+	for key, value := range values {
+		if err = os.Setenv(key, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ReadEnvFile читает пары KEY=VALUE из файла, не трогая окружение процесса
+func ReadEnvFile(filename string) (map[string]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
 	defer file.Close()
 
+	values := make(map[string]string)
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
@@ -29,10 +46,8 @@ func LoadEnv(filename string) error {
 		key := strings.TrimSpace(parts[0])
 		value := strings.TrimSpace(parts[1])
 
-		if err = os.Setenv(key, value); err != nil {
-			return err
-		}
+		values[key] = value
 	}
 
-	return scanner.Err()
+	return values, scanner.Err()
 }
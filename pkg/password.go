@@ -3,15 +3,19 @@ package pkg
 import (
 	"crypto/md5"
 	"encoding/hex"
-	"log"
+	"log/slog"
 )
 
+// UnusablePasswordHash ставится пользователям, которые входят только через
+// внешнего провайдера: ни один пароль не дает такой хэш
+const UnusablePasswordHash = "!"
+
 func HashPassword(input []byte) (string, error) {
 	hasher := md5.New()
 
 	_, err := hasher.Write(input)
 	if err != nil {
-		log.Println("error hashing password")
+		slog.Error("error hashing password", "error", err)
 		return "", err
 	}
 
@@ -20,3 +20,10 @@ func ExtractBearerToken(r *http.Request) (string, error) {
 	}
 	return strings.TrimPrefix(authHeader, "Bearer "), nil
 }
+
+// CSRFToken значение X-CSRF-Token для сессии в cookie. Оно выводится из самого токена,
+// поэтому чужой сайт, не видя HttpOnly cookie, не может его получить.
+func CSRFToken(sessionToken string) string {
+	hash := sha256.Sum256([]byte("csrf:" + sessionToken))
+	return hex.EncodeToString(hash[:])
+}